@@ -0,0 +1,64 @@
+package general
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// minSuccessRate caps the failure penalty of the adaptive score.
+const minSuccessRate = 0.05
+
+// RouteAdaptive picks a configured target using the Command's Stats. With
+// probability exploration (0 to 1) a random target is picked; otherwise
+// targets without statistics are tried first, then the target with the
+// lowest median latency divided by its success rate.
+func (c *Command) RouteAdaptive(exploration float64) (Target, error) {
+	if len(c.targets) == 0 {
+		return Target{}, fmt.Errorf("no targets configured")
+	}
+	if rand.Float64() < exploration {
+		return c.targets[rand.IntN(len(c.targets))], nil
+	}
+
+	var (
+		best      Target
+		bestScore time.Duration
+		found     bool
+	)
+	for _, target := range c.targets {
+		resolved, err := DefaultAliases.ResolveTarget(target)
+		if err != nil {
+			continue
+		}
+		stats, ok := c.stats.lookup(resolved)
+		if !ok || stats.Requests == 0 {
+			return target, nil
+		}
+
+		// Targets that never succeeded have no latency and rank last.
+		score := time.Duration(math.MaxInt64)
+		if stats.Successes > 0 {
+			score = time.Duration(float64(stats.P50) / max(stats.SuccessRate(), minSuccessRate))
+		}
+		if !found || score < bestScore {
+			best, bestScore, found = target, score, true
+		}
+	}
+	if !found {
+		return c.targets[0], nil
+	}
+	return best, nil
+}
+
+// ExecuteAdaptive sends req to the target chosen by RouteAdaptive and
+// blocks until it completes.
+func (c *Command) ExecuteAdaptive(ctx context.Context, req ChatCompletionRequest, exploration float64) Result {
+	target, err := c.RouteAdaptive(exploration)
+	if err != nil {
+		return Result{Error: err}
+	}
+	return c.executeResult(ctx, target, req)
+}
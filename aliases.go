@@ -0,0 +1,128 @@
+package general
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// AliasPrefix marks a Target.Model as an alias such as "@cheap".
+const AliasPrefix = "@"
+
+// Built-in model tiers available as aliases for the well-known providers.
+const (
+	TierFast  = "fast"
+	TierCheap = "cheap"
+	TierBest  = "best"
+)
+
+// AliasTable maps model aliases to concrete models per provider name.
+// Aliases let callers name a tier instead of a model that may be deprecated.
+type AliasTable struct {
+	mu      sync.RWMutex
+	entries map[string]string
+}
+
+// builtinAliases seeds new alias tables, keyed by provider name and alias.
+var builtinAliases = map[string]map[string]string{
+	ProviderOpenAI: {
+		TierFast:  "gpt-4o-mini",
+		TierCheap: "gpt-4o-mini",
+		TierBest:  "gpt-4o",
+	},
+	ProviderOpenRouter: {
+		TierFast:  "google/gemini-2.0-flash-001",
+		TierCheap: "openai/gpt-4o-mini",
+		TierBest:  "anthropic/claude-3.5-sonnet",
+	},
+	ProviderGroq: {
+		TierFast:  "llama-3.1-8b-instant",
+		TierCheap: "llama-3.1-8b-instant",
+		TierBest:  "llama-3.3-70b-versatile",
+	},
+	ProviderGemini: {
+		TierFast:  "gemini-2.0-flash",
+		TierCheap: "gemini-2.0-flash",
+		TierBest:  "gemini-2.5-pro",
+	},
+}
+
+// NewAliasTable creates an alias table seeded with the built-in tiers.
+func NewAliasTable() *AliasTable {
+	t := &AliasTable{entries: make(map[string]string)}
+	for provider, aliases := range builtinAliases {
+		for alias, model := range aliases {
+			t.entries[aliasKey(provider, alias)] = model
+		}
+	}
+	return t
+}
+
+// DefaultAliases is the alias table used when executing requests.
+var DefaultAliases = NewAliasTable()
+
+// IsAlias reports whether model names an alias rather than a concrete model.
+func IsAlias(model string) bool {
+	return strings.HasPrefix(model, AliasPrefix)
+}
+
+func aliasKey(provider, alias string) string {
+	return strings.ToLower(provider + "/" + strings.TrimPrefix(alias, AliasPrefix))
+}
+
+// Set maps an alias to a model for a provider name. The alias may be given
+// with or without the leading "@". An empty provider applies the alias to
+// every provider without its own entry.
+func (t *AliasTable) Set(provider, alias, model string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[aliasKey(provider, alias)] = model
+}
+
+// Delete removes an alias set with Set. A built-in tier reverts to its
+// default model.
+func (t *AliasTable) Delete(provider, alias string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := aliasKey(provider, alias)
+	for p, aliases := range builtinAliases {
+		for a, model := range aliases {
+			if aliasKey(p, a) == key {
+				t.entries[key] = model
+				return
+			}
+		}
+	}
+	delete(t.entries, key)
+}
+
+// Resolve returns the concrete model for model on the named provider.
+// Models that are not aliases are returned unchanged.
+func (t *AliasTable) Resolve(provider, model string) (string, error) {
+	if !IsAlias(model) {
+		return model, nil
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if resolved, ok := t.entries[aliasKey(provider, model)]; ok {
+		return resolved, nil
+	}
+	if resolved, ok := t.entries[aliasKey("", model)]; ok {
+		return resolved, nil
+	}
+	if provider == "" {
+		provider = "custom provider"
+	}
+	return "", fmt.Errorf("unknown model alias %q for %s", model, provider)
+}
+
+// ResolveTarget returns target with an aliased model replaced by its concrete model.
+func (t *AliasTable) ResolveTarget(target Target) (Target, error) {
+	model, err := t.Resolve(target.Provider.Name(), target.Model)
+	if err != nil {
+		return Target{}, err
+	}
+	target.Model = model
+	return target, nil
+}
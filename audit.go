@@ -0,0 +1,149 @@
+package general
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// redactedText replaces content removed by AuditOmitContent.
+const redactedText = "[redacted]"
+
+// AuditEntry is one request/response pair in an audit log.
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Provider string    `json:"provider,omitempty"`
+	Endpoint string    `json:"endpoint"`
+	Model    string    `json:"model"`
+	Stream   bool      `json:"stream,omitempty"`
+	Cached   bool      `json:"cached,omitempty"`
+	// Request is the body sent to the provider.
+	Request    map[string]any          `json:"request"`
+	Response   *ChatCompletionResponse `json:"response,omitempty"`
+	Error      string                  `json:"error,omitempty"`
+	DurationMS int64                   `json:"duration_ms"`
+}
+
+// AuditLog writes every request/response pair of the Commands using it as
+// one JSON line. It is safe for concurrent use.
+type AuditLog struct {
+	mu      sync.Mutex
+	w       io.Writer
+	closer  io.Closer
+	redact  []func(*AuditEntry)
+	onError func(error)
+}
+
+// AuditOption configures an AuditLog.
+type AuditOption func(*AuditLog)
+
+// AuditRedact runs redact on each entry before it is written, for example
+// to mask customer identifiers in the messages.
+func AuditRedact(redact func(*AuditEntry)) AuditOption {
+	return func(l *AuditLog) { l.redact = append(l.redact, redact) }
+}
+
+// AuditOmitContent replaces the message contents of requests and responses
+// with a placeholder, keeping parameters, usage and errors.
+func AuditOmitContent() AuditOption {
+	return AuditRedact(func(e *AuditEntry) {
+		for _, key := range []string{"messages", "contents", "systemInstruction", "prompt", "suffix"} {
+			if _, ok := e.Request[key]; ok {
+				e.Request[key] = redactedText
+			}
+		}
+		if e.Response != nil {
+			resp := *e.Response
+			resp.Choices = make([]ChatCompletionChoice, len(e.Response.Choices))
+			for i, choice := range e.Response.Choices {
+				choice.Message = ChatCompletionMessage{Role: choice.Message.Role, Content: redactedText}
+				resp.Choices[i] = choice
+			}
+			e.Response = &resp
+		}
+	})
+}
+
+// AuditOnError sets a function called when an entry cannot be written. By
+// default write errors are ignored so auditing never fails a request.
+func AuditOnError(f func(error)) AuditOption {
+	return func(l *AuditLog) { l.onError = f }
+}
+
+// NewAuditLog returns an audit log writing to w.
+func NewAuditLog(w io.Writer, opts ...AuditOption) *AuditLog {
+	l := &AuditLog{w: w}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// OpenAuditLog returns an audit log appending to the file at path, which is
+// created readable by the owner only.
+func OpenAuditLog(path string, opts ...AuditOption) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	l := NewAuditLog(f, opts...)
+	l.closer = f
+	return l, nil
+}
+
+// Close closes the file of a log opened with OpenAuditLog.
+func (l *AuditLog) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// WithAuditLog records every request of the Command in log.
+func WithAuditLog(log *AuditLog) Option {
+	return func(c *Command) { c.audit = log }
+}
+
+// write redacts and appends entry.
+func (l *AuditLog) write(entry AuditEntry) {
+	for _, redact := range l.redact {
+		redact(&entry)
+	}
+	line, err := json.Marshal(entry)
+	if err == nil {
+		l.mu.Lock()
+		_, err = l.w.Write(append(line, '\n'))
+		l.mu.Unlock()
+	}
+	if err != nil && l.onError != nil {
+		l.onError(fmt.Errorf("failed to write audit entry: %w", err))
+	}
+}
+
+// auditRequest records a completed request to target if the Command has an
+// audit log.
+func (c *Command) auditRequest(target Target, body []byte, resp ChatCompletionResponse, err error, start time.Time, stream, cached bool) {
+	if c.audit == nil {
+		return
+	}
+	entry := AuditEntry{
+		Time:       start,
+		Provider:   target.Provider.Name(),
+		Endpoint:   target.Provider.Endpoint,
+		Model:      target.Model,
+		Stream:     stream,
+		Cached:     cached,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	json.Unmarshal(body, &entry.Request)
+	if len(resp.Choices) > 0 || resp.Usage != nil {
+		entry.Response = &resp
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	c.audit.write(entry)
+}
@@ -0,0 +1,66 @@
+package general
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// WeightedTarget is a target with its share of traffic in a Balancer.
+type WeightedTarget struct {
+	Target Target
+	Weight float64
+}
+
+// Balancer spreads requests across equivalent targets in proportion to
+// their weights, e.g. 70% to one account and 30% to another. It uses smooth
+// weighted round-robin, so the split holds over any short run of requests.
+// A Balancer is safe for concurrent use.
+type Balancer struct {
+	mu      sync.Mutex
+	targets []WeightedTarget
+	current []float64
+	total   float64
+}
+
+// NewBalancer creates a balancer. Targets with a weight of zero or less are
+// never picked.
+func NewBalancer(targets ...WeightedTarget) *Balancer {
+	b := &Balancer{current: make([]float64, len(targets))}
+	for _, t := range targets {
+		b.targets = append(b.targets, t)
+		b.total += max(t.Weight, 0)
+	}
+	return b
+}
+
+// Next returns the target for the next request.
+func (b *Balancer) Next() (Target, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.total == 0 {
+		return Target{}, fmt.Errorf("no targets with positive weight")
+	}
+
+	best := -1
+	for i, t := range b.targets {
+		if t.Weight <= 0 {
+			continue
+		}
+		b.current[i] += t.Weight
+		if best < 0 || b.current[i] > b.current[best] {
+			best = i
+		}
+	}
+	b.current[best] -= b.total
+	return b.targets[best].Target, nil
+}
+
+// Balance sends req to the next target of b and blocks until it completes.
+func (c *Command) Balance(ctx context.Context, b *Balancer, req ChatCompletionRequest) Result {
+	target, err := b.Next()
+	if err != nil {
+		return Result{Error: err}
+	}
+	return c.executeResult(ctx, target, req)
+}
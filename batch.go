@@ -0,0 +1,159 @@
+package general
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// defaultBatchConcurrency is the number of requests a batch has in flight
+// without WithConcurrency.
+const defaultBatchConcurrency = 8
+
+// BatchProgress describes a batch after one of its requests completed.
+type BatchProgress struct {
+	// Done counts the completed requests, Failed those among them with an
+	// error, Resumed those taken from a checkpoint, and Total all requests
+	// of the batch, one per prompt and target.
+	Done, Failed, Resumed, Total int
+	Elapsed                      time.Duration
+	// Request is the index of the prompt of the request that completed, and
+	// Result its result.
+	Request int
+	Result  Result
+}
+
+// WithConcurrency bounds the requests a Batch has in flight to n. It
+// defaults to 8. The Command's rate limits apply on top of it.
+func WithConcurrency(n int) CallOption {
+	return func(cfg *callConfig) { cfg.concurrency = n }
+}
+
+// WithProgress calls report each time a request of a Batch completes. The
+// calls are serialized.
+func WithProgress(report func(BatchProgress)) CallOption {
+	return func(cfg *callConfig) { cfg.progress = report }
+}
+
+// Batch sends each of reqs to every target of the Command, with at most
+// WithConcurrency requests in flight. The result of reqs[i] on target j is
+// results[i][j]. Prompts are started in order, each on all targets before
+// the next. Batch requests queue for rate limits at PriorityLow unless
+// WithPriority says otherwise. Requests not started when ctx is done get
+// its error. With WithCheckpoint, an interrupted Batch can be run again to
+// resume it.
+func (c *Command) Batch(ctx context.Context, reqs []ChatCompletionRequest, opts ...CallOption) [][]Result {
+	flat := c.runBatch(ctx, c.targets, reqs, opts)
+	results := make([][]Result, len(reqs))
+	for i := range reqs {
+		results[i] = flat[i*len(c.targets) : (i+1)*len(c.targets)]
+	}
+	return results
+}
+
+// BatchTarget sends each of reqs to target like Batch; results[i] is the
+// result of reqs[i].
+func (c *Command) BatchTarget(ctx context.Context, target Target, reqs []ChatCompletionRequest, opts ...CallOption) []Result {
+	return c.runBatch(ctx, []Target{target}, reqs, opts)
+}
+
+// runBatch sends every request to every target and returns the results in
+// request-major order.
+func (c *Command) runBatch(ctx context.Context, targets []Target, reqs []ChatCompletionRequest, opts []CallOption) []Result {
+	cfg := newCallConfig(append([]CallOption{WithPriority(PriorityLow)}, opts...))
+	ctx, cancel := withCallConfig(ctx, cfg)
+	defer cancel()
+	concurrency := cfg.concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	start := time.Now()
+	results := make([]Result, len(reqs)*len(targets))
+	var (
+		mu       sync.Mutex
+		progress = BatchProgress{Total: len(results)}
+	)
+	complete := func(i int, r Result, resumed bool) {
+		results[i] = r
+		if cfg.progress == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		progress.Done++
+		if r.Error != nil {
+			progress.Failed++
+		}
+		if resumed {
+			progress.Resumed++
+		}
+		progress.Elapsed = time.Since(start)
+		progress.Request, progress.Result = i/len(targets), r
+		cfg.progress(progress)
+	}
+
+	var saved map[string]CheckpointEntry
+	if cfg.checkpoint != nil {
+		var err error
+		if saved, err = cfg.checkpoint.Load(ctx); err != nil {
+			// Without the checkpoint every request would be paid for again.
+			for i := range results {
+				results[i] = Result{Target: targets[i%len(targets)], Error: err}
+			}
+			return results
+		}
+	}
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		req, target := i/len(targets), targets[i%len(targets)]
+		var key string
+		if cfg.checkpoint != nil {
+			key = checkpointKey(req, target, reqs[req])
+			if entry, ok := saved[key]; ok {
+				entry.Response.Cached = true
+				complete(i, Result{Target: target, Response: entry.Response, Duration: entry.Duration}, true)
+				continue
+			}
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			complete(i, Result{Target: target, Error: ctx.Err()}, false)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			result := c.executeAndLog(ctx, target, reqs[req])
+			if key != "" && result.Error == nil {
+				c.saveCheckpoint(ctx, cfg.checkpoint, key, req, result)
+			}
+			complete(i, result, false)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// saveCheckpoint records the successful result of the req-th request of a
+// batch in cp. Failures to save are logged, not returned: the result is
+// still good, only a resumed run would send the request again.
+func (c *Command) saveCheckpoint(ctx context.Context, cp Checkpoint, key string, req int, result Result) {
+	entry := CheckpointEntry{
+		Key:      key,
+		Request:  req,
+		Endpoint: result.Target.Provider.Endpoint,
+		Model:    result.Target.Model,
+		Response: result.Response,
+		Duration: result.Duration,
+		Time:     time.Now(),
+	}
+	if err := cp.Save(context.WithoutCancel(ctx), entry); err != nil {
+		c.log(slog.LevelWarn, "failed to save checkpoint", "error", err)
+	}
+}
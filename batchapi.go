@@ -0,0 +1,293 @@
+package general
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// batchWindow is the completion window requested for batches, the only
+	// one OpenAI and Groq accept.
+	batchWindow = "24h"
+	// batchIDPrefix starts the custom_id of each batch line, followed by the
+	// index of its request.
+	batchIDPrefix = "request-"
+	// batchEndpoint is the URL of batch lines, relative to the API host.
+	batchEndpoint = "/v1" + chatCompletionsPath
+	// batchDiscount is the share of the regular price batches are billed.
+	batchDiscount = 0.5
+	// defaultBatchPollInterval is how often WaitBatch polls by default.
+	defaultBatchPollInterval = 30 * time.Second
+)
+
+// Statuses of a BatchJob.
+const (
+	BatchValidating = "validating"
+	BatchInProgress = "in_progress"
+	BatchFinalizing = "finalizing"
+	BatchCompleted  = "completed"
+	BatchFailed     = "failed"
+	BatchExpired    = "expired"
+	BatchCancelling = "cancelling"
+	BatchCancelled  = "cancelled"
+)
+
+// BatchJob is a batch submitted to the asynchronous Batch API of OpenAI or
+// Groq, which run requests within 24 hours at half the price.
+type BatchJob struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	InputFileID   string `json:"input_file_id"`
+	OutputFileID  string `json:"output_file_id,omitempty"`
+	ErrorFileID   string `json:"error_file_id,omitempty"`
+	CreatedAt     int64  `json:"created_at"`
+	RequestCounts struct {
+		Total     int `json:"total"`
+		Completed int `json:"completed"`
+		Failed    int `json:"failed"`
+	} `json:"request_counts"`
+	Errors *struct {
+		Data []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"data"`
+	} `json:"errors,omitempty"`
+}
+
+// Done reports whether the batch has reached a final status.
+func (j BatchJob) Done() bool {
+	switch j.Status {
+	case BatchCompleted, BatchFailed, BatchExpired, BatchCancelled:
+		return true
+	}
+	return false
+}
+
+// Err returns the validation errors of a failed batch, or nil.
+func (j BatchJob) Err() error {
+	if j.Status != BatchFailed {
+		return nil
+	}
+	if j.Errors == nil || len(j.Errors.Data) == 0 {
+		return errors.New("batch failed")
+	}
+	messages := make([]string, len(j.Errors.Data))
+	for i, e := range j.Errors.Data {
+		messages[i] = e.Message
+	}
+	return fmt.Errorf("batch failed: %s", strings.Join(messages, "; "))
+}
+
+// batchLine is one request of a batch input file.
+type batchLine struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// batchOutputLine is one result of a batch output or error file.
+type batchOutputLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// SubmitBatch uploads reqs as a batch input file and creates a batch that
+// sends them to target through the provider's Batch API. The requests are
+// encoded as they would be sent directly and pass the scrubbing and
+// moderation of WithScrubbers and SetModeration, but added middleware,
+// caching and the result store do not see them.
+func (c *Command) SubmitBatch(ctx context.Context, target Target, reqs []ChatCompletionRequest) (BatchJob, error) {
+	p := target.Provider
+	if p.GeminiNative || p.TextCompletion || p.baseURL() == strings.TrimRight(p.Endpoint, "/") {
+		return BatchJob{}, errors.New("the Batch API needs an OpenAI-compatible chat completions endpoint")
+	}
+	target, err := DefaultAliases.ResolveTarget(target)
+	if err != nil {
+		return BatchJob{}, err
+	}
+
+	// The lines pass through the built-in scrubbing and moderation, which
+	// share their checks, and are encoded instead of sent.
+	ctx, cancel := withCallConfig(ctx, callConfig{})
+	defer cancel()
+	var body []byte
+	encode := Handler(func(ctx context.Context, call Call) (ChatCompletionResponse, error) {
+		var err error
+		body, err = marshalRequest(call.Target, call.Request)
+		return ChatCompletionResponse{}, err
+	})
+	guards := c.guards()
+	for i := len(guards) - 1; i >= 0; i-- {
+		encode = guards[i](encode)
+	}
+
+	var input bytes.Buffer
+	enc := json.NewEncoder(&input)
+	for i, req := range reqs {
+		req.Model = target.Model
+		if _, err := encode(ctx, Call{Target: target, Request: req}); err != nil {
+			return BatchJob{}, fmt.Errorf("request %d: %w", i, err)
+		}
+		line := batchLine{CustomID: batchIDPrefix + strconv.Itoa(i), Method: http.MethodPost, URL: batchEndpoint, Body: body}
+		if err := enc.Encode(line); err != nil {
+			return BatchJob{}, fmt.Errorf("failed to marshal request %d: %w", i, err)
+		}
+	}
+
+	fileID, err := c.uploadBatchFile(ctx, target.Provider, input.Bytes())
+	if err != nil {
+		return BatchJob{}, err
+	}
+	var job BatchJob
+	create := map[string]string{"input_file_id": fileID, "endpoint": batchEndpoint, "completion_window": batchWindow}
+	if err := c.doJSON(ctx, target.Provider, http.MethodPost, target.Provider.baseURL()+"/batches", create, &job); err != nil {
+		return BatchJob{}, fmt.Errorf("failed to create batch: %w", err)
+	}
+	c.log(slog.LevelInfo, "submitted batch", "id", job.ID, "requests", len(reqs), "model", target.Model)
+	return job, nil
+}
+
+// uploadBatchFile uploads a batch input file and returns its ID.
+func (c *Command) uploadBatchFile(ctx context.Context, provider Provider, data []byte) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("purpose", "batch")
+	part, err := form.CreateFormFile("file", "batch.jsonl")
+	if err != nil {
+		return "", fmt.Errorf("failed to upload batch: %w", err)
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("failed to upload batch: %w", err)
+	}
+
+	var file struct {
+		ID string `json:"id"`
+	}
+	err = c.doRaw(ctx, provider, http.MethodPost, provider.baseURL()+"/files", form.FormDataContentType(), &body, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&file)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload batch: %w", err)
+	}
+	return file.ID, nil
+}
+
+// PollBatch returns the current state of the batch with the given ID.
+func (c *Command) PollBatch(ctx context.Context, target Target, id string) (BatchJob, error) {
+	var job BatchJob
+	if err := c.doJSON(ctx, target.Provider, http.MethodGet, target.Provider.baseURL()+"/batches/"+id, nil, &job); err != nil {
+		return BatchJob{}, fmt.Errorf("failed to poll batch: %w", err)
+	}
+	return job, nil
+}
+
+// WaitBatch polls the batch with the given ID every interval, or every 30
+// seconds if interval is 0, until it reaches a final status or ctx is done.
+func (c *Command) WaitBatch(ctx context.Context, target Target, id string, interval time.Duration) (BatchJob, error) {
+	if interval <= 0 {
+		interval = defaultBatchPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job, err := c.PollBatch(ctx, target, id)
+		if err != nil || job.Done() {
+			return job, err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return job, ctx.Err()
+		}
+	}
+}
+
+// BatchResults downloads the results of a finished batch. results[i] is
+// the result of the i-th request passed to SubmitBatch; requests that
+// failed carry an error and those without a result ErrEmptyResponse.
+// Unless the provider reports a cost, usage is priced at half the catalog
+// price, as batches are billed.
+func (c *Command) BatchResults(ctx context.Context, target Target, job BatchJob) ([]Result, error) {
+	if !job.Done() {
+		return nil, fmt.Errorf("batch %s is still %s", job.ID, job.Status)
+	}
+	if err := job.Err(); err != nil {
+		return nil, err
+	}
+	results := make([]Result, job.RequestCounts.Total)
+	for i := range results {
+		results[i] = Result{Target: target, Error: ErrEmptyResponse}
+	}
+	for _, fileID := range []string{job.OutputFileID, job.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		url := target.Provider.baseURL() + "/files/" + fileID + "/content"
+		err := c.doRaw(ctx, target.Provider, http.MethodGet, url, "", nil, func(r io.Reader) error {
+			return c.readBatchOutput(r, target, results)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to download batch results: %w", err)
+		}
+	}
+	return results, nil
+}
+
+// readBatchOutput fills results from the lines of a batch output file.
+func (c *Command) readBatchOutput(r io.Reader, target Target, results []Result) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var line batchOutputLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("invalid batch output line: %w", err)
+		}
+		i, err := strconv.Atoi(strings.TrimPrefix(line.CustomID, batchIDPrefix))
+		if err != nil || i < 0 || i >= len(results) {
+			return fmt.Errorf("unknown batch request %q", line.CustomID)
+		}
+
+		result := Result{Target: target}
+		switch {
+		case line.Error != nil:
+			result.Error = fmt.Errorf("batch request failed (%s): %s", line.Error.Code, line.Error.Message)
+		case line.Response == nil:
+			result.Error = ErrEmptyResponse
+		case line.Response.StatusCode != http.StatusOK:
+			result.Error = c.apiError(line.Response.StatusCode, line.Response.Body)
+		default:
+			resp, err := decodeResponse(target, bytes.NewReader(line.Response.Body))
+			if err == nil && resp.Usage != nil && resp.Usage.Cost == 0 {
+				if cost, ok := estimateCost(target, resp.Usage); ok {
+					resp.Usage.Cost = cost * batchDiscount
+				}
+			}
+			result.Response, result.Error = resp, err
+		}
+		results[i] = result
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,122 @@
+package general
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Reasoning effort levels for ChatCompletionRequest.ReasoningEffort.
+const (
+	ReasoningLow    = "low"
+	ReasoningMedium = "medium"
+	ReasoningHigh   = "high"
+)
+
+// requestBody is a chat completion body under construction, keyed by JSON field.
+type requestBody map[string]json.RawMessage
+
+func (b requestBody) set(key string, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+	b[key] = raw
+	return nil
+}
+
+func (b requestBody) merge(fields map[string]any) error {
+	for k, v := range fields {
+		if err := b.set(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildRequestBody marshals req for target, translating provider-neutral
+// fields into the provider's own parameters.
+func buildRequestBody(target Target, req ChatCompletionRequest) ([]byte, error) {
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	body := requestBody{}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+
+	// Models such as the o-series reject max_tokens; send the limit as max_completion_tokens.
+	if req.MaxTokens > 0 && requiresMaxCompletionTokens(req.Model) {
+		delete(body, "max_tokens")
+		if req.MaxCompletionTokens == 0 {
+			if err := body.set("max_completion_tokens", req.MaxTokens); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := applyProviderFields(target.Provider.Name(), req, body); err != nil {
+		return nil, err
+	}
+	if err := body.merge(req.Extra); err != nil {
+		return nil, err
+	}
+	if err := body.merge(target.Extra); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(body)
+}
+
+// applyProviderFields writes the provider-specific translation of req into body.
+func applyProviderFields(provider string, req ChatCompletionRequest, body requestBody) error {
+	switch provider {
+	case ProviderOpenRouter:
+		// OpenRouter maps reasoning onto each upstream, including Anthropic's thinking budget.
+		reasoning := map[string]any{}
+		if req.ThinkingBudget > 0 {
+			reasoning["max_tokens"] = req.ThinkingBudget
+		} else if req.ReasoningEffort != "" {
+			reasoning["effort"] = req.ReasoningEffort
+		}
+		if len(reasoning) > 0 {
+			if err := body.set("reasoning", reasoning); err != nil {
+				return err
+			}
+		}
+		// Ask for usage accounting so the response reports its cost.
+		if err := body.set("usage", map[string]any{"include": true}); err != nil {
+			return err
+		}
+
+	case ProviderGemini:
+		google := map[string]any{}
+		if req.ThinkingBudget > 0 {
+			google["thinking_config"] = map[string]any{"thinking_budget": req.ThinkingBudget}
+		} else if req.ReasoningEffort != "" {
+			if err := body.set("reasoning_effort", req.ReasoningEffort); err != nil {
+				return err
+			}
+		}
+		if req.Gemini != nil && len(req.Gemini.SafetySettings) > 0 {
+			google["safety_settings"] = req.Gemini.SafetySettings
+		}
+		if len(google) > 0 {
+			if err := body.set("extra_body", map[string]any{"google": google}); err != nil {
+				return err
+			}
+		}
+
+	case ProviderGroq:
+		return applyGroqFields(req, body)
+
+	default:
+		// OpenAI-style APIs take only an effort level; ThinkingBudget has no equivalent.
+		if req.ReasoningEffort != "" {
+			if err := body.set("reasoning_effort", req.ReasoningEffort); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
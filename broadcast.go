@@ -0,0 +1,192 @@
+package general
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrDeadline is the error of results for targets that had not responded
+// when the context deadline of a Broadcast with WithPartialResults passed.
+var ErrDeadline = errors.New("deadline exceeded before target responded")
+
+// ErrSuperseded is the error of results for targets whose requests were
+// aborted by WithCancelOnFirstSuccess.
+var ErrSuperseded = errors.New("cancelled after another target succeeded")
+
+// CallOption configures a single Execute or Broadcast call, overriding the
+// defaults of the Command for that call only.
+type CallOption func(*callConfig)
+
+type callConfig struct {
+	partial       bool
+	cancelOnFirst bool
+	budget        *RetryBudget
+	timeout       time.Duration
+	retry         *RetryPolicy
+	noCache       bool
+	headers       map[string]string
+	continues     int
+	schema        Schema
+	fallback      FallbackPolicy
+	checkResponse bool
+	priority      Priority
+	concurrency   int
+	progress      func(BatchProgress)
+	checkpoint    Checkpoint
+	targets       []Target
+	// moderations holds the moderation checks of the call by prompt, so
+	// that its targets share them.
+	moderations *sync.Map
+}
+
+func newCallConfig(opts []CallOption) callConfig {
+	var cfg callConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+type callConfigKey struct{}
+
+// withCallConfig attaches cfg to ctx and applies its timeout. The returned
+// cancel function must be called when the call is complete.
+func withCallConfig(ctx context.Context, cfg callConfig) (context.Context, context.CancelFunc) {
+	cfg.moderations = new(sync.Map)
+	ctx = context.WithValue(ctx, callConfigKey{}, cfg)
+	if cfg.timeout > 0 {
+		return context.WithTimeout(ctx, cfg.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// callOptions returns the call configuration carried by ctx.
+func callOptions(ctx context.Context) callConfig {
+	cfg, _ := ctx.Value(callConfigKey{}).(callConfig)
+	return cfg
+}
+
+// WithPartialResults makes Broadcast stop waiting when its context is done:
+// every target still outstanding gets a result with ErrDeadline (or the
+// context error if it was cancelled) and the channel is closed at once,
+// instead of after the slowest target's retries have run out.
+func WithPartialResults() CallOption {
+	return func(cfg *callConfig) { cfg.partial = true }
+}
+
+// WithCancelOnFirstSuccess aborts the requests still in flight once one
+// target succeeds. Every target still gets a result; the aborted ones carry
+// ErrSuperseded. Use it to avoid paying for responses that are only logged.
+func WithCancelOnFirstSuccess() CallOption {
+	return func(cfg *callConfig) { cfg.cancelOnFirst = true }
+}
+
+// WithRetryBudget makes the retries of all targets draw from budget. Once it
+// is spent, failed requests are not retried.
+func WithRetryBudget(budget *RetryBudget) CallOption {
+	return func(cfg *callConfig) { cfg.budget = budget }
+}
+
+// WithCallTimeout bounds the whole call, including retries, by timeout.
+// Combine it with WithPartialResults to get results for the targets that
+// made it in time.
+func WithCallTimeout(timeout time.Duration) CallOption {
+	return func(cfg *callConfig) { cfg.timeout = timeout }
+}
+
+// WithRetries overrides the retry policy of the Command.
+func WithRetries(policy RetryPolicy) CallOption {
+	return func(cfg *callConfig) {
+		policy.MaxAttempts = max(policy.MaxAttempts, 1)
+		cfg.retry = &policy
+	}
+}
+
+// WithoutCache bypasses the Command cache, neither reading nor storing
+// responses.
+func WithoutCache() CallOption {
+	return func(cfg *callConfig) { cfg.noCache = true }
+}
+
+// WithHeaders sends extra HTTP headers, overriding provider headers of the
+// same name.
+func WithHeaders(headers map[string]string) CallOption {
+	return func(cfg *callConfig) {
+		if cfg.headers == nil {
+			cfg.headers = make(map[string]string, len(headers))
+		}
+		maps.Copy(cfg.headers, headers)
+	}
+}
+
+// WithAutoContinue makes streams that drop mid-generation continue up to n
+// times with a follow-up request asking the model to resume, appending the
+// new content to the partial one. It applies to streaming calls only.
+func WithAutoContinue(n int) CallOption {
+	return func(cfg *callConfig) { cfg.continues = n }
+}
+
+// Broadcast is like Execute but bound to ctx, which cancels outstanding
+// requests.
+func (c *Command) Broadcast(ctx context.Context, req ChatCompletionRequest, opts ...CallOption) <-chan Result {
+	cfg := newCallConfig(opts)
+	return c.executeTargets(ctx, c.callTargets(cfg), req, cfg)
+}
+
+// Race sends req to every target at once and returns the first successful
+// result, aborting the requests still in flight. If all targets fail, the
+// result carries the errors of every target.
+func (c *Command) Race(ctx context.Context, req ChatCompletionRequest, opts ...CallOption) Result {
+	cfg := newCallConfig(opts)
+	return c.race(ctx, c.callTargets(cfg), req, cfg)
+}
+
+// race is Race over targets.
+func (c *Command) race(ctx context.Context, targets []Target, req ChatCompletionRequest, cfg callConfig) Result {
+	if len(targets) == 0 {
+		return Result{Error: fmt.Errorf("no targets configured")}
+	}
+	cfg.cancelOnFirst = true
+	var winner *Result
+	var errs []error
+	for r := range c.executeTargets(ctx, targets, req, cfg) {
+		switch {
+		case r.Error == nil && winner == nil:
+			winner = &r
+		case r.Error != nil && !errors.Is(r.Error, ErrSuperseded):
+			errs = append(errs, fmt.Errorf("%s: %w", r.Target.Model, r.Error))
+		}
+	}
+	if winner != nil {
+		return *winner
+	}
+	return Result{Target: targets[0], Error: errors.Join(errs...)}
+}
+
+// retryPolicy returns the retry policy for a request made with ctx.
+func (c *Command) retryPolicy(ctx context.Context) RetryPolicy {
+	if policy := callOptions(ctx).retry; policy != nil {
+		return *policy
+	}
+	return c.retry
+}
+
+// contextError returns the error reported for targets cut off by ctx.
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrDeadline
+	}
+	return ctx.Err()
+}
+
+// setCallHeaders applies the extra headers of the call made with ctx.
+func setCallHeaders(ctx context.Context, h http.Header) {
+	for k, v := range callOptions(ctx).headers {
+		h.Set(k, v)
+	}
+}
@@ -0,0 +1,38 @@
+package general
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// RetryBudget caps the total number of retries across many requests, so a
+// systemic outage does not multiply into a retry storm over every target
+// and prompt. Share one budget across the Broadcasts of a batch. A
+// RetryBudget is safe for concurrent use.
+type RetryBudget struct {
+	remaining atomic.Int64
+}
+
+// NewRetryBudget creates a budget allowing n retries in total.
+func NewRetryBudget(n int) *RetryBudget {
+	b := &RetryBudget{}
+	b.remaining.Store(int64(n))
+	return b
+}
+
+// Remaining returns the number of retries left.
+func (b *RetryBudget) Remaining() int {
+	return int(max(b.remaining.Load(), 0))
+}
+
+// take consumes one retry and reports whether one was available.
+func (b *RetryBudget) take() bool {
+	return b.remaining.Add(-1) >= 0
+}
+
+// allowRetry reports whether the retry budget of the call, if any, permits
+// another retry, consuming it.
+func allowRetry(ctx context.Context) bool {
+	b := callOptions(ctx).budget
+	return b == nil || b.take()
+}
@@ -0,0 +1,88 @@
+package general
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Cache stores successful responses by request key.
+type Cache interface {
+	Get(key string) (ChatCompletionResponse, bool)
+	Set(key string, resp ChatCompletionResponse)
+}
+
+// cacheKey identifies a request body sent to target.
+func cacheKey(target Target, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(target.Provider.Endpoint))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MemoryCache is an in-process Cache. It is safe for concurrent use.
+type MemoryCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// sweepAt is the number of entries at which expired ones are dropped,
+	// so that long-running processes do not keep them forever.
+	sweepAt int
+}
+
+type cacheEntry struct {
+	resp    ChatCompletionResponse
+	expires time.Time
+}
+
+// minSweep is the fewest entries at which a MemoryCache drops expired ones.
+const minSweep = 1024
+
+// NewMemoryCache creates a cache whose entries expire after ttl, or never
+// if ttl is zero.
+func NewMemoryCache(ttl time.Duration) *MemoryCache {
+	return &MemoryCache{ttl: ttl, entries: make(map[string]cacheEntry), sweepAt: minSweep}
+}
+
+// Get returns the response stored under key, if it has not expired.
+func (m *MemoryCache) Get(key string) (ChatCompletionResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		return ChatCompletionResponse{}, false
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(m.entries, key)
+		return ChatCompletionResponse{}, false
+	}
+	return entry.resp, true
+}
+
+// Set stores resp under key.
+func (m *MemoryCache) Set(key string, resp ChatCompletionResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := cacheEntry{resp: resp}
+	if m.ttl > 0 {
+		entry.expires = time.Now().Add(m.ttl)
+	}
+	m.entries[key] = entry
+	if m.ttl > 0 && len(m.entries) >= m.sweepAt {
+		m.sweep()
+	}
+}
+
+// sweep drops the expired entries and doubles the number of live ones at
+// which it next runs, keeping its cost amortized. m.mu must be held.
+func (m *MemoryCache) sweep() {
+	now := time.Now()
+	for key, entry := range m.entries {
+		if now.After(entry.expires) {
+			delete(m.entries, key)
+		}
+	}
+	m.sweepAt = max(2*len(m.entries), minSweep)
+}
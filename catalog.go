@@ -0,0 +1,164 @@
+package general
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const openRouterModelsURL = "https://openrouter.ai/api/v1/models"
+
+// ModelDetails describes the capabilities and pricing of a model.
+type ModelDetails struct {
+	ContextWindow int
+	MaxOutput     int
+	Vision        bool
+	Tools         bool
+	Pricing       Pricing
+}
+
+// Pricing is the cost of a model in USD per million tokens.
+type Pricing struct {
+	Prompt     float64
+	Completion float64
+}
+
+// Cost returns the USD cost of usage at these prices.
+func (p Pricing) Cost(usage Usage) float64 {
+	return (float64(usage.PromptTokens)*p.Prompt + float64(usage.CompletionTokens)*p.Completion) / 1e6
+}
+
+// Catalog is a queryable table of ModelDetails keyed by provider name and model.
+type Catalog struct {
+	mu      sync.RWMutex
+	entries map[string]ModelDetails
+}
+
+// builtinModels seeds new catalogs. Values are approximate; use
+// Command.RefreshCatalog for current OpenRouter data.
+var builtinModels = map[string]ModelDetails{
+	"openai/gpt-4o":                          {ContextWindow: 128000, MaxOutput: 16384, Vision: true, Tools: true, Pricing: Pricing{2.5, 10}},
+	"openai/gpt-4o-mini":                     {ContextWindow: 128000, MaxOutput: 16384, Vision: true, Tools: true, Pricing: Pricing{0.15, 0.6}},
+	"openai/o3-mini":                         {ContextWindow: 200000, MaxOutput: 100000, Tools: true, Pricing: Pricing{1.1, 4.4}},
+	"groq/llama-3.3-70b-versatile":           {ContextWindow: 131072, MaxOutput: 32768, Tools: true, Pricing: Pricing{0.59, 0.79}},
+	"groq/llama-3.1-8b-instant":              {ContextWindow: 131072, MaxOutput: 8192, Tools: true, Pricing: Pricing{0.05, 0.08}},
+	"gemini/gemini-2.0-flash":                {ContextWindow: 1048576, MaxOutput: 8192, Vision: true, Tools: true, Pricing: Pricing{0.1, 0.4}},
+	"gemini/gemini-2.5-flash":                {ContextWindow: 1048576, MaxOutput: 65536, Vision: true, Tools: true, Pricing: Pricing{0.3, 2.5}},
+	"gemini/gemini-2.5-pro":                  {ContextWindow: 1048576, MaxOutput: 65536, Vision: true, Tools: true, Pricing: Pricing{1.25, 10}},
+	"openrouter/openai/gpt-4o":               {ContextWindow: 128000, MaxOutput: 16384, Vision: true, Tools: true, Pricing: Pricing{2.5, 10}},
+	"openrouter/openai/gpt-4o-mini":          {ContextWindow: 128000, MaxOutput: 16384, Vision: true, Tools: true, Pricing: Pricing{0.15, 0.6}},
+	"openrouter/anthropic/claude-3.5-sonnet": {ContextWindow: 200000, MaxOutput: 8192, Vision: true, Tools: true, Pricing: Pricing{3, 15}},
+	"openrouter/google/gemini-2.0-flash-001": {ContextWindow: 1048576, MaxOutput: 8192, Vision: true, Tools: true, Pricing: Pricing{0.1, 0.4}},
+}
+
+// NewCatalog creates a catalog seeded with built-in entries for common models.
+func NewCatalog() *Catalog {
+	c := &Catalog{entries: make(map[string]ModelDetails, len(builtinModels))}
+	for k, v := range builtinModels {
+		c.entries[k] = v
+	}
+	return c
+}
+
+// DefaultCatalog is the catalog used by ModelInfo.
+var DefaultCatalog = NewCatalog()
+
+// ModelInfo looks up a model in DefaultCatalog by provider name (see Provider.Name).
+func ModelInfo(provider, model string) (ModelDetails, bool) {
+	return DefaultCatalog.Lookup(provider, model)
+}
+
+func catalogKey(provider, model string) string {
+	return strings.ToLower(provider + "/" + model)
+}
+
+// Set adds or replaces the entry for a provider and model.
+func (c *Catalog) Set(provider, model string, details ModelDetails) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[catalogKey(provider, model)] = details
+}
+
+// Lookup returns the details for a provider and model. Models without their
+// own entry fall back to an OpenRouter entry with the same base name, so
+// "openai/gpt-4o" metadata also answers for provider "openai", model "gpt-4o".
+func (c *Catalog) Lookup(provider, model string) (ModelDetails, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if details, ok := c.entries[catalogKey(provider, model)]; ok {
+		return details, true
+	}
+
+	prefix := ProviderOpenRouter + "/"
+	base := baseModelName(model)
+	// Iterate in key order so the fallback is deterministic.
+	keys := make([]string, 0, len(c.entries))
+	for k := range c.entries {
+		if strings.HasPrefix(k, prefix) && baseModelName(k) == base {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ModelDetails{}, false
+	}
+	slices.Sort(keys)
+	return c.entries[keys[0]], true
+}
+
+// openRouterModels is the subset of OpenRouter's model metadata used by the catalog.
+type openRouterModels struct {
+	Data []struct {
+		ID            string `json:"id"`
+		ContextLength int    `json:"context_length"`
+		Pricing       struct {
+			Prompt     string `json:"prompt"`
+			Completion string `json:"completion"`
+		} `json:"pricing"`
+		Architecture struct {
+			InputModalities []string `json:"input_modalities"`
+		} `json:"architecture"`
+		TopProvider struct {
+			MaxCompletionTokens int `json:"max_completion_tokens"`
+		} `json:"top_provider"`
+		SupportedParameters []string `json:"supported_parameters"`
+	} `json:"data"`
+}
+
+// RefreshCatalog loads OpenRouter's public model metadata into catalog,
+// replacing existing OpenRouter entries with the same IDs.
+func (c *Command) RefreshCatalog(ctx context.Context, catalog *Catalog) error {
+	var response openRouterModels
+	if err := c.doJSON(ctx, Provider{}, "GET", openRouterModelsURL, nil, &response); err != nil {
+		return fmt.Errorf("failed to fetch model metadata: %w", err)
+	}
+
+	for _, m := range response.Data {
+		catalog.Set(ProviderOpenRouter, m.ID, ModelDetails{
+			ContextWindow: m.ContextLength,
+			MaxOutput:     m.TopProvider.MaxCompletionTokens,
+			Vision:        slices.Contains(m.Architecture.InputModalities, "image"),
+			Tools:         slices.Contains(m.SupportedParameters, "tools"),
+			Pricing: Pricing{
+				Prompt:     perMillion(m.Pricing.Prompt),
+				Completion: perMillion(m.Pricing.Completion),
+			},
+		})
+	}
+
+	c.log(slog.LevelDebug, "model catalog refreshed", "models", len(response.Data))
+	return nil
+}
+
+// perMillion converts OpenRouter's per-token USD price string to USD per million tokens.
+func perMillion(perToken string) float64 {
+	price, err := strconv.ParseFloat(perToken, 64)
+	if err != nil {
+		return 0
+	}
+	return price * 1e6
+}
@@ -0,0 +1,234 @@
+package general
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// checkpointSchema creates the table of a SQLCheckpoint, in SQLite syntax.
+const checkpointSchema = `
+CREATE TABLE IF NOT EXISTS checkpoints (
+	job         TEXT NOT NULL,
+	key         TEXT NOT NULL,
+	request     INTEGER NOT NULL,
+	endpoint    TEXT NOT NULL,
+	model       TEXT NOT NULL,
+	response    TEXT NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	time        INTEGER NOT NULL,
+	PRIMARY KEY (job, key)
+);
+`
+
+// CheckpointEntry is a completed batch request saved in a Checkpoint.
+type CheckpointEntry struct {
+	// Key identifies the request by its position in the batch, its target
+	// and its content, so a changed batch does not pick up stale results.
+	Key      string                 `json:"key"`
+	Request  int                    `json:"request"`
+	Endpoint string                 `json:"endpoint"`
+	Model    string                 `json:"model"`
+	Response ChatCompletionResponse `json:"response"`
+	Duration time.Duration          `json:"duration_ns"`
+	Time     time.Time              `json:"time"`
+}
+
+// Checkpoint durably records the completed requests of a batch, so that a
+// crashed or interrupted run resumes where it left off instead of sending
+// finished requests again. Implementations must be safe for concurrent use.
+type Checkpoint interface {
+	// Load returns the saved entries by key.
+	Load(ctx context.Context) (map[string]CheckpointEntry, error)
+	// Save records entry, replacing any entry with the same key.
+	Save(ctx context.Context, entry CheckpointEntry) error
+}
+
+// WithCheckpoint makes a Batch skip the requests saved in cp and save each
+// request that succeeds as it completes. Failed requests are not saved, so
+// they are sent again on the next run. Resumed results report Cached.
+func WithCheckpoint(cp Checkpoint) CallOption {
+	return func(cfg *callConfig) { cfg.checkpoint = cp }
+}
+
+// checkpointKey identifies the i-th request of a batch sent to target.
+func checkpointKey(i int, target Target, req ChatCompletionRequest) string {
+	if resolved, err := DefaultAliases.ResolveTarget(target); err == nil {
+		target = resolved
+	}
+	body, _ := json.Marshal(req)
+	extra, _ := json.Marshal(target.Extra)
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(strconv.Itoa(i)), []byte(target.Provider.Endpoint), []byte(target.Model), extra, body} {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// FileCheckpoint is a Checkpoint kept as a JSONL file, one entry per line.
+// A line cut short by a crash is ignored.
+type FileCheckpoint struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// OpenFileCheckpoint opens the checkpoint in path, creating it if needed.
+func OpenFileCheckpoint(path string) (*FileCheckpoint, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	// Terminate a line cut short by a crash so the next entry starts afresh.
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			f.Write([]byte{'\n'})
+		}
+	}
+	return &FileCheckpoint{path: path, f: f}, nil
+}
+
+// Load reads the entries of the file. Later entries replace earlier ones
+// with the same key.
+func (c *FileCheckpoint) Load(ctx context.Context) (map[string]CheckpointEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	entries := make(map[string]CheckpointEntry)
+	scanner := bufio.NewScanner(c.f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry CheckpointEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		entries[entry.Key] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	return entries, nil
+}
+
+// Save appends entry to the file.
+func (c *FileCheckpoint) Save(ctx context.Context, entry CheckpointEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint entry: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the checkpoint file, once its batch is done with it.
+func (c *FileCheckpoint) Remove() error {
+	if err := c.Close(); err != nil {
+		return err
+	}
+	return os.Remove(c.path)
+}
+
+// Close closes the file.
+func (c *FileCheckpoint) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.f.Close()
+}
+
+// SQLCheckpoint is a Checkpoint kept in a SQL database, written for SQLite
+// like ResultStore. One database holds the checkpoints of many jobs.
+type SQLCheckpoint struct {
+	mu  sync.Mutex
+	db  *sql.DB
+	job string
+}
+
+// NewSQLCheckpoint returns the checkpoint of the named job in db, creating
+// its table if needed.
+func NewSQLCheckpoint(ctx context.Context, db *sql.DB, job string) (*SQLCheckpoint, error) {
+	if _, err := db.ExecContext(ctx, checkpointSchema); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint table: %w", err)
+	}
+	return &SQLCheckpoint{db: db, job: job}, nil
+}
+
+// Load returns the entries of the job.
+func (c *SQLCheckpoint) Load(ctx context.Context) (map[string]CheckpointEntry, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT key, request, endpoint, model, response, duration_ms, time
+		FROM checkpoints WHERE job = ?`, c.job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	defer rows.Close()
+	entries := make(map[string]CheckpointEntry)
+	for rows.Next() {
+		var (
+			entry             CheckpointEntry
+			response          string
+			durationMS, nanos int64
+		)
+		if err := rows.Scan(&entry.Key, &entry.Request, &entry.Endpoint, &entry.Model, &response, &durationMS, &nanos); err != nil {
+			return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+		}
+		if err := json.Unmarshal([]byte(response), &entry.Response); err != nil {
+			return nil, fmt.Errorf("failed to decode checkpoint entry: %w", err)
+		}
+		entry.Duration = time.Duration(durationMS) * time.Millisecond
+		entry.Time = time.Unix(0, nanos)
+		entries[entry.Key] = entry
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	return entries, nil
+}
+
+// Save records entry for the job.
+func (c *SQLCheckpoint) Save(ctx context.Context, entry CheckpointEntry) error {
+	response, err := json.Marshal(entry.Response)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint entry: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.db.ExecContext(ctx, `INSERT OR REPLACE INTO checkpoints
+		(job, key, request, endpoint, model, response, duration_ms, time) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.job, entry.Key, entry.Request, entry.Endpoint, entry.Model, string(response),
+		entry.Duration.Milliseconds(), entry.Time.UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Clear deletes the entries of the job, once its batch is done with them.
+func (c *SQLCheckpoint) Clear(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM checkpoints WHERE job = ?", c.job); err != nil {
+		return fmt.Errorf("failed to clear checkpoint: %w", err)
+	}
+	return nil
+}
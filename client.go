@@ -1,9 +1,16 @@
 package general
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"regexp"
+	"slices"
+	"sync"
 	"time"
 )
 
@@ -11,29 +18,117 @@ const defaultTimeout = 60 * time.Second
 
 // Command manages LLM API requests.
 type Command struct {
-	targets []Target
-	client  *http.Client
-	logger  *slog.Logger
-}
+	targets    []Target
+	client     *http.Client
+	logger     *slog.Logger
+	moderation *Provider
+
+	mu        sync.Mutex
+	proxy     string
+	tls       TLSConfig
+	transport TransportConfig
+	clients   map[transportKey]*http.Client
+	keys      map[string]int
 
-// NewCommand creates a new Command with the given targets and optional logger.
-// Pass nil for logger to disable logging.
-func NewCommand(targets []Target, logger *slog.Logger) *Command {
-	return NewCommandWithTimeout(targets, logger, defaultTimeout)
+	timeouts    Timeouts
+	retry       RetryPolicy
+	idleTimeout time.Duration
+	cache       Cache
+	rateLimit   rateLimit
+	limiters    map[string]*tokenBucket
+	stats       statsCollector
+	fallback    FallbackPolicy
+	limiter     *ConcurrencyLimiter
+	tracer      Tracer
+	audit       *AuditLog
+	secrets     []*regexp.Regexp
+	scrubbers   []Scrubber
+	middleware  []Middleware
+	compaction  *Compaction
+	store       *ResultStore
 }
 
-// NewCommandWithTimeout creates a new Command with a custom timeout.
-func NewCommandWithTimeout(targets []Target, logger *slog.Logger, timeout time.Duration) *Command {
-	return &Command{
-		targets: targets,
-		client:  &http.Client{Timeout: timeout},
-		logger:  logger,
+// NewCommand creates a new Command with the given targets, configured by opts.
+func NewCommand(targets []Target, opts ...Option) *Command {
+	c := &Command{
+		targets:  targets,
+		client:   &http.Client{},
+		timeouts: Timeouts{Total: defaultTimeout},
+		retry:    DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
+}
+
+// Targets returns the targets of the Command.
+func (c *Command) Targets() []Target {
+	return slices.Clone(c.targets)
 }
 
-// log logs a message if logger is configured.
+// log logs a message if logger is configured, with secrets redacted.
 func (c *Command) log(level slog.Level, msg string, args ...any) {
 	if c.logger != nil {
-		c.logger.Log(context.Background(), level, msg, args...)
+		c.logger.Log(context.Background(), level, msg, c.redactArgs(args)...)
+	}
+}
+
+// doJSON sends a request to provider with an optional JSON body and decodes
+// a JSON response into out.
+func (c *Command) doJSON(ctx context.Context, provider Provider, method, url string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		requestBody, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(requestBody)
+	}
+	return c.doRaw(ctx, provider, method, url, "", reader, func(r io.Reader) error {
+		if err := json.NewDecoder(r).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil
+	})
+}
+
+// doRaw sends a request to provider with an optional body and passes the
+// body of a successful response to read. A contentType other than ""
+// replaces the default JSON content type.
+func (c *Command) doRaw(ctx context.Context, provider Provider, method, url, contentType string, body io.Reader, read func(io.Reader) error) error {
+	// Time queued for a slot does not count towards the request timeout.
+	release, err := c.acquireSlot(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, cancel := c.requestContext(ctx, false)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	provider = c.selectKey(provider)
+	provider.setHeaders(httpReq.Header)
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+
+	client, err := c.httpClient(provider)
+	if err != nil {
+		return err
+	}
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", timeoutCause(ctx, err))
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(httpResp.Body)
+		return c.responseError(httpResp, responseBody)
 	}
+	return read(httpResp.Body)
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// attachment is a piece of context included ahead of the question.
+type attachment struct {
+	name    string
+	content string
+}
+
+// readAttachments reads the --file paths and, if requested, stdin.
+func readAttachments(paths []string, stdin bool) ([]attachment, error) {
+	var attachments []attachment
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %w", err)
+		}
+		attachments = append(attachments, attachment{name: path, content: string(data)})
+	}
+	if stdin {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		attachments = append(attachments, attachment{name: "stdin", content: string(data)})
+	}
+	return attachments, nil
+}
+
+// withAttachments prefixes prompt with each attachment under a filename header.
+func withAttachments(prompt string, attachments []attachment) string {
+	if len(attachments) == 0 {
+		return prompt
+	}
+
+	var b strings.Builder
+	for _, a := range attachments {
+		fence := codeFence(a.content)
+		fmt.Fprintf(&b, "File: %s\n%s\n%s\n%s\n\n", a.name, fence, strings.TrimRight(a.content, "\n"), fence)
+	}
+	b.WriteString(prompt)
+	return b.String()
+}
+
+// codeFence returns a backtick fence longer than any backtick run in content.
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
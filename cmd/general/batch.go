@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/festeh/general"
+)
+
+// batchRecord is a result of a batch, tagged with the line of its prompt.
+type batchRecord struct {
+	Index  int    `json:"index"`
+	Prompt string `json:"prompt,omitempty"`
+	record
+}
+
+// lastUserText returns the text of the last user message of req.
+func lastUserText(req general.ChatCompletionRequest) string {
+	for _, m := range slices.Backward(req.Messages) {
+		if m.Role == general.RoleUser {
+			return m.Text()
+		}
+	}
+	return ""
+}
+
+// runBatch implements `general batch`, which runs the prompts of a JSONL
+// file across targets, and `general batch submit|status|results`, which
+// run them through the asynchronous Batch API at half the price.
+func runBatch(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		runBatchLocal(args)
+		return
+	}
+	switch args[0] {
+	case "submit":
+		runBatchSubmit(args[1:])
+	case "status":
+		runBatchStatus(args[1:])
+	case "results":
+		runBatchResults(args[1:])
+	default:
+		fail("unknown batch action %q, expected submit, status or results", args[0])
+	}
+}
+
+// runBatchLocal implements `general batch --input path --output path`,
+// sending every prompt to every target and writing each result as a JSONL
+// line as soon as it completes.
+func runBatchLocal(args []string) {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	flags := addRequestFlags(fs)
+	input := fs.String("input", "", "JSONL file with one prompt or request per line (default: stdin)")
+	output := fs.String("output", "", "File to write the results to as JSONL (default: stdout)")
+	concurrency := fs.Int("concurrency", 8, "Requests in flight at once, across all targets")
+	checkpoint := fs.String("checkpoint", "", "File recording completed requests, to resume an interrupted run")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fail("unexpected arguments %q; prompts are read from --input", fs.Args())
+	}
+	if *concurrency < 1 {
+		fail("--concurrency must be positive")
+	}
+
+	targets := flags.resolveTargets()
+	reqs, err := readBatchInput(*input, flags.systemPrompt(), flags.params())
+	if err != nil {
+		fail("%v", err)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			fail("failed to create output file: %v", err)
+		}
+		defer out.Close()
+	}
+	opts := []general.CallOption{general.WithConcurrency(*concurrency)}
+	if *checkpoint != "" {
+		cp, err := general.OpenFileCheckpoint(*checkpoint)
+		if err != nil {
+			fail("%v", err)
+		}
+		defer cp.Close()
+		opts = append(opts, general.WithCheckpoint(cp))
+	}
+
+	// Stop starting requests on Ctrl+C; those in flight still complete
+	// and are written out.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	enc := json.NewEncoder(out)
+	live := isTerminal(os.Stderr)
+	var writeErr error
+	opts = append(opts, general.WithProgress(func(p general.BatchProgress) {
+		r := newRecord(p.Result, p.Elapsed, true, false)
+		line := batchRecord{Index: p.Request, Prompt: lastUserText(reqs[p.Request]), record: r}
+		if err := enc.Encode(line); err != nil && writeErr == nil {
+			writeErr = err
+		}
+		if live {
+			fmt.Fprintf(os.Stderr, "\r%d/%d done, %d failed, %d resumed, %s",
+				p.Done, p.Total, p.Failed, p.Resumed, p.Elapsed.Round(time.Second))
+		}
+	}))
+
+	fmt.Fprintf(os.Stderr, "Sending %d prompt(s) to %d target(s)...\n", len(reqs), len(targets))
+	var results []general.Result
+	for _, row := range flags.command(targets).Batch(ctx, reqs, opts...) {
+		results = append(results, row...)
+	}
+	if live {
+		fmt.Fprintln(os.Stderr)
+	}
+	if writeErr != nil {
+		fail("failed to write results: %v", writeErr)
+	}
+	printSummary(results)
+	if ctx.Err() != nil {
+		fail("interrupted")
+	}
+}
+
+// runBatchSubmit implements `general batch submit -t provider:model --input path`.
+func runBatchSubmit(args []string) {
+	fs := flag.NewFlagSet("batch submit", flag.ExitOnError)
+	flags := addRequestFlags(fs)
+	input := fs.String("input", "", "JSONL file with one prompt or request per line (default: stdin)")
+	fs.Parse(args)
+
+	targets := flags.resolveTargets()
+	if len(targets) != 1 {
+		fail("batch submit needs exactly one target, got %d", len(targets))
+	}
+	reqs, err := readBatchInput(*input, flags.systemPrompt(), flags.params())
+	if err != nil {
+		fail("%v", err)
+	}
+
+	job, err := flags.command(targets).SubmitBatch(context.Background(), targets[0], reqs)
+	if err != nil {
+		fail("%v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Submitted %d request(s) as batch %s\n", len(reqs), job.ID)
+	fmt.Println(job.ID)
+}
+
+// runBatchStatus implements `general batch status <id> -t provider`.
+func runBatchStatus(args []string) {
+	fs := flag.NewFlagSet("batch status", flag.ExitOnError)
+	spec := fs.String("t", "", "Provider (or provider:model) the batch was submitted to")
+	id := parseIDArg(fs, args, "usage: general batch status <id> -t provider")
+	target := batchTarget(*spec)
+
+	job, err := general.NewCommand(nil).PollBatch(context.Background(), target, id)
+	if err != nil {
+		fail("%v", err)
+	}
+	printBatchJob(job)
+}
+
+// runBatchResults implements `general batch results <id> -t provider:model`,
+// writing the results of a finished batch as JSONL in input order.
+func runBatchResults(args []string) {
+	fs := flag.NewFlagSet("batch results", flag.ExitOnError)
+	spec := fs.String("t", "", "Target the batch was submitted to, as provider:model")
+	output := fs.String("output", "", "File to write the results to (default: stdout)")
+	wait := fs.Bool("wait", false, "Wait for the batch to finish")
+	interval := fs.Duration("interval", 30*time.Second, "Polling interval for --wait")
+	id := parseIDArg(fs, args, "usage: general batch results <id> -t provider:model [--wait] [--output path]")
+	target := batchTarget(*spec)
+
+	ctx := context.Background()
+	cmd := general.NewCommand(nil)
+	var job general.BatchJob
+	var err error
+	if *wait {
+		job, err = cmd.WaitBatch(ctx, target, id, *interval)
+	} else {
+		job, err = cmd.PollBatch(ctx, target, id)
+	}
+	if err != nil {
+		fail("%v", err)
+	}
+	results, err := cmd.BatchResults(ctx, target, job)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fail("failed to create output file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeBatchResults(w, results); err != nil {
+		fail("%v", err)
+	}
+	printSummary(results)
+}
+
+// batchTarget parses the -t flag of batch subcommands, which names the
+// provider and optionally the model a batch was submitted to.
+func batchTarget(spec string) general.Target {
+	if spec == "" {
+		fail("-t is required")
+	}
+	if strings.Contains(spec, ":") {
+		target, err := parseTarget(spec)
+		if err != nil {
+			fail("%v", err)
+		}
+		return target
+	}
+	provider, err := resolveProvider(spec)
+	if err != nil {
+		fail("%v", err)
+	}
+	return general.Target{Provider: provider}
+}
+
+// printBatchJob writes the status and progress of job.
+func printBatchJob(job general.BatchJob) {
+	fmt.Printf("%s: %s, %d/%d done, %d failed (created %s)\n",
+		job.ID, job.Status, job.RequestCounts.Completed+job.RequestCounts.Failed, job.RequestCounts.Total,
+		job.RequestCounts.Failed, time.Unix(job.CreatedAt, 0).Format(time.DateTime))
+	if err := job.Err(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// writeBatchResults writes results as JSONL, one record per prompt.
+func writeBatchResults(w io.Writer, results []general.Result) error {
+	enc := json.NewEncoder(w)
+	for i, result := range results {
+		if err := enc.Encode(batchRecord{Index: i, record: newRecord(result, result.Duration, true, false)}); err != nil {
+			return fmt.Errorf("failed to write results: %w", err)
+		}
+	}
+	return nil
+}
+
+// readBatchInput reads the prompts of a batch from path, or stdin if path
+// is empty. Each non-blank line is a JSON request with messages, a JSON
+// object with a prompt field, a JSON string, or else plain text taken as
+// the prompt. Prompts get the system prompt and params; full requests are
+// sent as they are.
+func readBatchInput(path, system string, params genParams) ([]general.ChatCompletionRequest, error) {
+	r := io.Reader(os.Stdin)
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open input: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var reqs []general.ChatCompletionRequest
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		req, err := parseBatchLine(text, system, params)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		reqs = append(reqs, req)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+	if len(reqs) == 0 {
+		return nil, errors.New("no prompts in input")
+	}
+	return reqs, nil
+}
+
+// parseBatchLine decodes one line of batch input.
+func parseBatchLine(text, system string, params genParams) (general.ChatCompletionRequest, error) {
+	prompt := text
+	switch text[0] {
+	case '{':
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(text), &fields); err != nil {
+			return general.ChatCompletionRequest{}, fmt.Errorf("invalid JSON: %w", err)
+		}
+		if fields["messages"] != nil {
+			var req general.ChatCompletionRequest
+			if err := json.Unmarshal([]byte(text), &req); err != nil {
+				return general.ChatCompletionRequest{}, fmt.Errorf("invalid request: %w", err)
+			}
+			return req, nil
+		}
+		if err := json.Unmarshal(fields["prompt"], &prompt); err != nil || prompt == "" {
+			return general.ChatCompletionRequest{}, errors.New("expected a prompt or messages field")
+		}
+	case '"':
+		if err := json.Unmarshal([]byte(text), &prompt); err != nil {
+			return general.ChatCompletionRequest{}, fmt.Errorf("invalid JSON string: %w", err)
+		}
+	}
+
+	var req general.ChatCompletionRequest
+	if system != "" {
+		req.Messages = append(req.Messages, general.SystemMessage(system))
+	}
+	req.Messages = append(req.Messages, general.UserMessage(prompt))
+	params.apply(&req)
+	return req, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/festeh/general"
+)
+
+// benchRun is the measurement of one benchmark request.
+type benchRun struct {
+	latency time.Duration
+	ttft    time.Duration
+	usage   *general.Usage
+	tps     float64
+	err     error
+}
+
+// runBench implements `general bench`, which sends every target the same
+// prompts repeatedly and summarizes latency, throughput, errors and cost.
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	flags := addRequestFlags(fs)
+	runs := fs.Int("n", 10, "Requests per target")
+	concurrency := fs.Int("concurrency", 1, "Concurrent requests per target")
+	promptFile := fs.String("prompt-file", "", "File with one prompt per line, used in turn")
+	fs.Parse(args)
+
+	targets := flags.resolveTargets()
+	prompts := benchPrompts(*promptFile, fs.Args())
+	if *runs < 1 || *concurrency < 1 {
+		fail("-n and --concurrency must be positive")
+	}
+
+	var base general.ChatCompletionRequest
+	flags.params().apply(&base)
+	system := flags.systemPrompt()
+
+	fmt.Fprintf(os.Stderr, "Benchmarking %d target(s) × %d requests...\n", len(targets), *runs)
+
+	measurements := make([][]benchRun, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		cmd := flags.command([]general.Target{target})
+		measurements[i] = make([]benchRun, *runs)
+		next := make(chan int)
+		for range *concurrency {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for run := range next {
+					req := base
+					if system != "" {
+						req.Messages = append(req.Messages, general.SystemMessage(system))
+					}
+					req.Messages = append(req.Messages, general.UserMessage(prompts[run%len(prompts)]))
+					measurements[i][run] = benchOnce(cmd, req)
+				}
+			}()
+		}
+		go func() {
+			for run := range *runs {
+				next <- run
+			}
+			close(next)
+		}()
+	}
+	wg.Wait()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "target\tok\terrors\tp50\tp95\tttft p50\ttok/s\tcost\t")
+	for i, target := range targets {
+		printBenchRow(w, target, measurements[i])
+	}
+	w.Flush()
+}
+
+// benchPrompts loads prompts from path, or uses the positional prompt.
+func benchPrompts(path string, args []string) []string {
+	if path == "" {
+		if len(args) == 0 {
+			fail("bench needs a prompt or --prompt-file")
+		}
+		return []string{strings.Join(args, " ")}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fail("failed to read prompts: %v", err)
+	}
+	var prompts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			prompts = append(prompts, line)
+		}
+	}
+	if len(prompts) == 0 {
+		fail("no prompts in %s", path)
+	}
+	return prompts
+}
+
+// benchOnce streams one request to the single target of cmd.
+func benchOnce(cmd *general.Command, req general.ChatCompletionRequest) benchRun {
+	start := time.Now()
+	var run benchRun
+	for ev := range cmd.ExecuteStream(req) {
+		if ev.Delta != "" && run.ttft == 0 {
+			run.ttft = time.Since(start)
+		}
+		if ev.Result != nil {
+			run.latency = time.Since(start)
+			run.usage = ev.Result.Response.Usage
+			run.tps = ev.Result.TokensPerSecond()
+			run.err = ev.Result.Error
+		}
+	}
+	return run
+}
+
+func printBenchRow(w *tabwriter.Writer, target general.Target, runs []benchRun) {
+	var latencies, ttfts []time.Duration
+	var tps []float64
+	var cost float64
+	priced := false
+	errors := 0
+
+	for _, r := range runs {
+		if r.err != nil {
+			errors++
+			continue
+		}
+		latencies = append(latencies, r.latency)
+		if r.ttft > 0 {
+			ttfts = append(ttfts, r.ttft)
+		}
+		if r.tps > 0 {
+			tps = append(tps, r.tps)
+		}
+		if r.usage != nil {
+			if c, found := usageCost(target, *r.usage); found {
+				cost += c
+				priced = true
+			}
+		}
+	}
+
+	throughput, costText := "-", "-"
+	if len(tps) > 0 {
+		sum := 0.0
+		for _, v := range tps {
+			sum += v
+		}
+		throughput = fmt.Sprintf("%.1f", sum/float64(len(tps)))
+	}
+	if priced {
+		costText = fmt.Sprintf("$%.4f", cost)
+	}
+	fmt.Fprintf(w, "%s\t%d\t%.0f%%\t%s\t%s\t%s\t%s\t%s\t\n",
+		targetLabel(target), len(latencies), 100*float64(errors)/float64(len(runs)),
+		percentile(latencies, 50), percentile(latencies, 95), percentile(ttfts, 50),
+		throughput, costText)
+}
+
+// percentile returns the p-th percentile of durations by nearest rank, or "-".
+func percentile(durations []time.Duration, p int) string {
+	if len(durations) == 0 {
+		return "-"
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	rank := max((p*len(sorted)+99)/100, 1)
+	return sorted[rank-1].Round(time.Millisecond).String()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/festeh/general"
+)
+
+const chatHelp = `Commands:
+  /system [text]          show or set the system prompt
+  /model [provider:model] show or switch the target
+  /retry                  regenerate the last reply
+  /save <path>            save the conversation as JSON, or Markdown for a .md path
+  /clear                  forget the conversation, keeping the system prompt
+  /quit                   exit`
+
+// runChat implements `general chat`, an interactive multi-turn session.
+func runChat(args []string) {
+	fs := flag.NewFlagSet("chat", flag.ExitOnError)
+	flags := addRequestFlags(fs)
+	render := fs.Bool("render", false, "Render markdown in responses when stdout is a terminal")
+	showReasoning := fs.Bool("show-reasoning", false, "Show the model's reasoning (<think> blocks) instead of hiding it")
+	resume := fs.String("resume", "", "Resume the session with this ID")
+	fs.Parse(args)
+
+	store := sessionStore()
+	var (
+		session *general.Session
+		target  general.Target
+		conv    *general.Conversation
+	)
+	if *resume != "" {
+		var err error
+		if session, err = store.Load(*resume); err != nil {
+			fail("%v", err)
+		}
+		conv = session.Conversation()
+		if len(flags.targets) == 0 {
+			if target, err = sessionTarget(session); err != nil {
+				fail("%v", err)
+			}
+		}
+	} else {
+		conv = general.NewConversation(flags.systemPrompt())
+		session = general.NewSession(conv)
+		flags.params().apply(&session.Params)
+	}
+	if session.Targets == nil || len(flags.targets) > 0 {
+		targets := flags.resolveTargets()
+		if len(targets) != 1 {
+			fail("chat needs exactly one target, got %d; switch later with /model", len(targets))
+		}
+		target = targets[0]
+	}
+	cmd := flags.command(nil)
+	base := session.Params
+	out := textPrinter{render: *render && isTerminal(os.Stdout), reasoning: *showReasoning}
+
+	// save records the conversation after every change that should survive a restart.
+	save := func() {
+		session.Messages = conv.Messages
+		session.Targets = []general.SessionTarget{{
+			Provider: providerName(target.Provider),
+			Endpoint: target.Provider.Endpoint,
+			Model:    target.Model,
+		}}
+		if err := store.Save(session); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Chatting with %s/%s in session %s. Type /help for commands, Ctrl+D to exit.\n",
+		providerName(target.Provider), target.Model, session.ID)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for {
+		fmt.Fprint(os.Stderr, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(os.Stderr)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var send func() (general.ChatCompletionResponse, error)
+		if strings.HasPrefix(line, "/") {
+			name, arg, _ := strings.Cut(line, " ")
+			arg = strings.TrimSpace(arg)
+			switch name {
+			case "/help":
+				fmt.Fprintln(os.Stderr, chatHelp)
+			case "/quit", "/exit":
+				return
+			case "/system":
+				if arg == "" {
+					fmt.Fprintf(os.Stderr, "System prompt: %q\n", conv.System())
+				} else {
+					conv.SetSystem(arg)
+					save()
+				}
+			case "/model":
+				if arg != "" {
+					next, err := parseTarget(arg)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+						continue
+					}
+					target = next
+				}
+				fmt.Fprintf(os.Stderr, "Target: %s/%s\n", providerName(target.Provider), target.Model)
+			case "/retry":
+				send = func() (general.ChatCompletionResponse, error) {
+					return cmd.Retry(context.Background(), target, conv, base)
+				}
+			case "/save":
+				if err := saveConversation(arg, conv); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				}
+			case "/clear":
+				conv = general.NewConversation(conv.System())
+				save()
+			default:
+				fmt.Fprintf(os.Stderr, "Unknown command %s; type /help\n", name)
+			}
+			if send == nil {
+				continue
+			}
+		} else {
+			send = func() (general.ChatCompletionResponse, error) {
+				return cmd.Send(context.Background(), target, conv, base, line)
+			}
+		}
+
+		start := time.Now()
+		resp, err := send()
+		out.print(general.Result{Target: target, Response: resp, Error: err, Duration: time.Since(start)}, time.Since(start))
+		if err == nil {
+			save()
+		}
+	}
+}
+
+// sessionTarget rebuilds the target a session was last using.
+func sessionTarget(session *general.Session) (general.Target, error) {
+	if len(session.Targets) == 0 {
+		return general.Target{}, fmt.Errorf("session %s has no target; pass -t", session.ID)
+	}
+	st := session.Targets[0]
+	provider, err := resolveProvider(st.Provider)
+	if err != nil {
+		return general.Target{}, fmt.Errorf("cannot resume session %s: %w", session.ID, err)
+	}
+	return general.Target{Provider: provider, Model: st.Model}, nil
+}
+
+// saveConversation exports the conversation to path as Markdown if it ends
+// in .md and as JSON otherwise.
+func saveConversation(path string, conv *general.Conversation) error {
+	if path == "" {
+		return fmt.Errorf("usage: /save <path>")
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+	if strings.HasSuffix(path, ".md") {
+		err = conv.ExportMarkdown(f)
+	} else {
+		err = conv.ExportJSON(f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Saved %d messages to %s\n", len(conv.Messages), path)
+	return nil
+}
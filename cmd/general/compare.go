@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/festeh/general"
+)
+
+const diffContext = 3
+
+// printComparison prints a summary table, pairwise agreement and unified
+// diffs of each successful result against the first one.
+func printComparison(results []general.Result) {
+	var ok []general.Result
+	for _, r := range results {
+		if r.Error == nil {
+			ok = append(ok, r)
+		}
+	}
+	if len(ok) < 2 {
+		fmt.Fprintln(os.Stderr, "Nothing to compare: fewer than two successful results")
+		return
+	}
+
+	fmt.Println("\n=== Comparison ===")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\ttarget\tchars\tlines\tlatency\ttokens\ttok/s\tcost")
+	for i, r := range ok {
+		content := resultContent(r)
+		tokens, throughput, cost := "-", "-", "-"
+		if tps := r.TokensPerSecond(); tps > 0 {
+			throughput = fmt.Sprintf("%.1f", tps)
+		}
+		if usage := r.Response.Usage; usage != nil {
+			tokens = fmt.Sprintf("%d→%d", usage.PromptTokens, usage.CompletionTokens)
+			if c, found := r.EstimatedCost(); found {
+				cost = fmt.Sprintf("$%.5f", c)
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n", i+1, targetLabel(r.Target),
+			len([]rune(content)), strings.Count(content, "\n")+1, r.Duration.Round(time.Millisecond), tokens, throughput, cost)
+	}
+	w.Flush()
+
+	fmt.Println("\nAgreement (word overlap):")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := []string{""}
+	for i := range ok {
+		header = append(header, fmt.Sprintf("#%d", i+1))
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for i, a := range ok {
+		row := []string{fmt.Sprintf("#%d", i+1)}
+		for j, b := range ok {
+			if i == j {
+				row = append(row, "-")
+				continue
+			}
+			row = append(row, agreement(similarity(strings.Fields(resultContent(a)), strings.Fields(resultContent(b)))))
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+
+	base := ok[0]
+	for _, r := range ok[1:] {
+		fmt.Printf("\n--- #1 %s\n+++ %s\n", targetLabel(base.Target), targetLabel(r.Target))
+		diff := unifiedDiff(splitLines(resultContent(base)), splitLines(resultContent(r)))
+		if diff == "" {
+			fmt.Println("(identical)")
+		}
+		fmt.Print(diff)
+	}
+}
+
+// printSimilarity prints the pairwise embedding similarity of the
+// successful results and flags outliers.
+func printSimilarity(cmd *general.Command, embeddings general.Target, results []general.Result) {
+	similarity := cmd.EmbeddingSimilarity(embeddings.Provider, embeddings.Model)
+	report, err := general.Similarities(context.Background(), similarity, results)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Semantic similarity (%s) failed: %v\n", targetLabel(embeddings), err)
+		return
+	}
+
+	fmt.Printf("\nSemantic similarity (%s):\n", targetLabel(embeddings))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := []string{""}
+	for i := range report.Results {
+		header = append(header, fmt.Sprintf("#%d", i+1))
+	}
+	fmt.Fprintln(w, strings.Join(append(header, "mean"), "\t"))
+	for i, r := range report.Matrix {
+		row := []string{fmt.Sprintf("#%d", i+1)}
+		for j, s := range r {
+			if i == j {
+				row = append(row, "-")
+				continue
+			}
+			row = append(row, agreement(s))
+		}
+		mean := fmt.Sprintf("%.2f", report.Mean[i])
+		if report.IsOutlier(i) {
+			mean += " outlier"
+		}
+		fmt.Fprintln(w, strings.Join(append(row, mean), "\t"))
+	}
+	w.Flush()
+}
+
+// printJudgement asks judge to score the successful results and prints the
+// ranking.
+func printJudgement(cmd *general.Command, judge general.Target, req general.ChatCompletionRequest, results []general.Result, rubric string) {
+	judgement, err := cmd.Judge(context.Background(), judge, req, results, rubric)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Judge %s failed: %v\n", targetLabel(judge), err)
+		return
+	}
+
+	fmt.Printf("\n=== Judgement (%s) ===\n", targetLabel(judge))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "rank\ttarget\tscore\treason")
+	for i, s := range judgement.Ranking() {
+		fmt.Fprintf(w, "%d\t%s\t%.1f\t%s\n", i+1, targetLabel(s.Result.Target), s.Score, s.Reason)
+	}
+	w.Flush()
+}
+
+func targetLabel(t general.Target) string {
+	return providerName(t.Provider) + "/" + t.Model
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.TrimRight(s, "\n"), "\n")
+}
+
+// agreement formats a similarity ratio with a coarse indicator.
+func agreement(ratio float64) string {
+	mark := "✗"
+	switch {
+	case ratio >= 0.8:
+		mark = "✓"
+	case ratio >= 0.5:
+		mark = "~"
+	}
+	return fmt.Sprintf("%s %.2f", mark, ratio)
+}
+
+// similarity returns 2·LCS/(len(a)+len(b)), 1 for identical sequences.
+func similarity(a, b []string) float64 {
+	if len(a)+len(b) == 0 {
+		return 1
+	}
+	return 2 * float64(len(lcs(a, b))) / float64(len(a)+len(b))
+}
+
+// lcs returns index pairs of a longest common subsequence of a and b.
+func lcs(a, b []string) [][2]int {
+	n, m := len(a), len(b)
+	table := make([][]int, n+1)
+	for i := range table {
+		table[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+
+	var pairs [][2]int
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case a[i] == b[j]:
+			pairs = append(pairs, [2]int{i, j})
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+// diffLine is one line of an edit script: ' ' kept, '-' removed or '+' added.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns the differences between a and b as unified diff hunks.
+func unifiedDiff(a, b []string) string {
+	var script []diffLine
+	i, j := 0, 0
+	for _, p := range append(lcs(a, b), [2]int{len(a), len(b)}) {
+		for ; i < p[0]; i++ {
+			script = append(script, diffLine{'-', a[i]})
+		}
+		for ; j < p[1]; j++ {
+			script = append(script, diffLine{'+', b[j]})
+		}
+		if i < len(a) && j < len(b) {
+			script = append(script, diffLine{' ', a[i]})
+			i++
+			j++
+		}
+	}
+
+	var out strings.Builder
+	for start := 0; start < len(script); {
+		// Find the next change and the end of the hunk around it.
+		first := start
+		for first < len(script) && script[first].op == ' ' {
+			first++
+		}
+		if first == len(script) {
+			break
+		}
+		lo := max(first-diffContext, start)
+		hi, kept := first, 0
+		for hi < len(script) && kept <= 2*diffContext {
+			if script[hi].op == ' ' {
+				kept++
+			} else {
+				kept = 0
+			}
+			hi++
+		}
+		hi = min(hi-max(kept-diffContext, 0), len(script))
+
+		oldStart, newStart := 1, 1
+		for _, l := range script[:lo] {
+			if l.op != '+' {
+				oldStart++
+			}
+			if l.op != '-' {
+				newStart++
+			}
+		}
+		oldLen, newLen := 0, 0
+		for _, l := range script[lo:hi] {
+			if l.op != '+' {
+				oldLen++
+			}
+			if l.op != '-' {
+				newLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldLen, newStart, newLen)
+		for _, l := range script[lo:hi] {
+			fmt.Fprintf(&out, "%c%s\n", l.op, l.text)
+		}
+		start = hi
+	}
+	return out.String()
+}
+
+// usageCost returns the cost reported by the provider, or else an estimate
+// from the catalog prices of target.
+func usageCost(target general.Target, usage general.Usage) (float64, bool) {
+	return catalogCost(target.Provider.Name(), target.Model, usage)
+}
+
+// catalogCost returns the cost reported in usage, or else an estimate from
+// the catalog prices of the named provider's model.
+func catalogCost(provider, model string, usage general.Usage) (float64, bool) {
+	if usage.Cost > 0 {
+		return usage.Cost, true
+	}
+	details, found := general.ModelInfo(provider, model)
+	if !found {
+		return 0, false
+	}
+	return details.Pricing.Cost(usage), true
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// config is the CLI configuration file. Command-line flags override it.
+//
+//	targets = ["groq:@fast", "openrouter:@best"]
+//	temperature = 0.2
+//	audit_log = "~/.local/state/general/audit.jsonl"
+//	scrub = true
+//	history = true
+//
+//	[providers.groq]
+//	api_key_cmd = "pass show groq"
+//
+//	[providers.local]
+//	endpoint = "http://localhost:8080/v1/chat/completions"
+//
+//	[aliases]
+//	"openrouter:@best" = "anthropic/claude-sonnet-4"
+//
+//	[groups]
+//	fast-trio = ["groq:llama-3.3-70b-versatile", "gemini:gemini-2.0-flash", "openai:gpt-4o-mini"]
+//
+//	[routes.gpt]
+//	models = ["gpt-4o", "gpt-4o-*"]
+//	targets = ["openai:gpt-4o", "openrouter:openai/gpt-4o"]
+//	policy = "fallback"
+//	cache_ttl = "10m"
+//
+//	[routes.llama]
+//	pattern = "(?i)llama"
+//	targets = ["@fast-trio"]
+//	policy = "race"
+type config struct {
+	Targets     []string                  `json:"targets"`
+	System      string                    `json:"system"`
+	Temperature *float64                  `json:"temperature"`
+	MaxTokens   int                       `json:"max_tokens"`
+	TopP        float64                   `json:"top_p"`
+	Seed        *int                      `json:"seed"`
+	Stop        []string                  `json:"stop"`
+	Proxy       string                    `json:"proxy"`
+	AuditLog    string                    `json:"audit_log"`
+	Scrub       bool                      `json:"scrub"`
+	History     bool                      `json:"history"`
+	Providers   map[string]providerConfig `json:"providers"`
+	Aliases     map[string]string         `json:"aliases"`
+	Groups      map[string][]string       `json:"groups"`
+	Routes      map[string]routeConfig    `json:"routes"`
+}
+
+// routeConfig is a gateway route of `general serve`. Requests for the
+// models it lists, exactly or by a prefix ending in "*", or matching its
+// pattern go to its targets. The route named "default" serves the rest.
+// CacheTTL, a duration such as "10m", caches the responses of the route.
+type routeConfig struct {
+	Models   []string  `json:"models"`
+	Pattern  string    `json:"pattern"`
+	Targets  []string  `json:"targets"`
+	Policy   string    `json:"policy"`
+	Weights  []float64 `json:"weights"`
+	CacheTTL string    `json:"cache_ttl"`
+}
+
+// providerConfig configures a built-in provider or defines a custom one.
+// The API key comes from the first of APIKey, APIKeyEnv and APIKeyCmd that
+// is set, falling back to the keyring and the default environment variable.
+type providerConfig struct {
+	Endpoint       string            `json:"endpoint"`
+	APIKey         string            `json:"api_key"`
+	APIKeyEnv      string            `json:"api_key_env"`
+	APIKeyCmd      string            `json:"api_key_cmd"`
+	Headers        map[string]string `json:"headers"`
+	Proxy          string            `json:"proxy"`
+	TextCompletion bool              `json:"text_completion"`
+	GeminiNative   bool              `json:"gemini_native"`
+}
+
+// cfg is the loaded configuration; it is empty when there is no config file.
+var cfg config
+
+// configPath returns $GENERAL_CONFIG or the default config file location.
+func configPath() string {
+	if path := os.Getenv("GENERAL_CONFIG"); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "general", "config.toml")
+}
+
+// loadConfig reads the config file into cfg. A missing file is not an error.
+func loadConfig() error {
+	path := configPath()
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	values, err := parseTOML(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	// Round-trip through JSON to decode the generic values into config.
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	providers := make(map[string]providerConfig, len(cfg.Providers))
+	for name, p := range cfg.Providers {
+		name = strings.ToLower(name)
+		if _, ok := providerConstructors[name]; !ok && p.Endpoint == "" {
+			return fmt.Errorf("invalid config %s: custom provider %q needs an endpoint", path, name)
+		}
+		providers[name] = p
+	}
+	cfg.Providers = providers
+
+	for spec, model := range cfg.Aliases {
+		if err := setAlias(spec + "=" + model); err != nil {
+			return fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// apiKey returns the key configured by p, or "" to use the default sources.
+func (p providerConfig) apiKey() (string, error) {
+	switch {
+	case p.APIKey != "":
+		return p.APIKey, nil
+	case p.APIKeyEnv != "":
+		return os.Getenv(p.APIKeyEnv), nil
+	case p.APIKeyCmd != "":
+		out, err := exec.Command("sh", "-c", p.APIKeyCmd).Output()
+		if err != nil {
+			return "", fmt.Errorf("api_key_cmd failed: %w", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	default:
+		return "", nil
+	}
+}
+
+// expandHome replaces a leading "~/" in path with the user's home directory.
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/festeh/general"
+)
+
+// runCredits implements `general credits`, printing the OpenRouter balance.
+func runCredits(args []string) {
+	if len(args) != 0 {
+		fail("usage: general credits")
+	}
+	provider, err := resolveProvider(general.ProviderOpenRouter)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	cmd := general.NewCommand([]general.Target{{Provider: provider}})
+	credits, err := cmd.Credits(context.Background())
+	if err != nil {
+		fail("%v", err)
+	}
+	fmt.Printf("total:     $%.4f\n", credits.Total)
+	fmt.Printf("used:      $%.4f\n", credits.Used)
+	fmt.Printf("remaining: $%.4f\n", credits.Remaining())
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/festeh/general"
+)
+
+// runDoctor implements `general doctor [provider ...]`. It probes each
+// provider, or every provider with an API key, and reports its health.
+func runDoctor(args []string) {
+	names := args
+	if len(names) == 0 {
+		names = configuredProviders()
+	}
+
+	var targets []general.Target
+	for _, name := range names {
+		provider, err := resolveProvider(name)
+		if err != nil {
+			fail("%v", err)
+		}
+		targets = append(targets, general.Target{Provider: provider})
+	}
+
+	cmd := general.NewCommand(targets)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	failed := false
+
+	for _, status := range cmd.HealthCheck(context.Background()) {
+		state := "ok"
+		switch {
+		case !status.Reachable:
+			state = "unreachable"
+		case !status.Authorized:
+			state = "unauthorized"
+		case status.Error != nil:
+			state = "error"
+		}
+
+		detail := fmt.Sprintf("%d models", status.Models)
+		if status.Error != nil {
+			detail = status.Error.Error()
+			failed = true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", providerName(status.Provider), state, status.Latency.Round(time.Millisecond), detail)
+	}
+
+	w.Flush()
+	if failed {
+		os.Exit(1)
+	}
+}
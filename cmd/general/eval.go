@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/festeh/general"
+	"github.com/festeh/general/eval"
+)
+
+// Comparison modes for --golden-mode.
+const (
+	goldenExact      = "exact"
+	goldenNormalized = "normalized"
+	goldenJudge      = "judge"
+)
+
+// runEval implements `general eval --dataset rows.csv --template ...`, which
+// renders a prompt per dataset row, runs it across targets and checks the
+// replies against the expectations in the row and, with --golden, against
+// the golden answers recorded by --update-golden. It exits with status 1
+// if any reply fails.
+func runEval(args []string) {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	flags := addRequestFlags(fs)
+	dataset := fs.String("dataset", "", "CSV or JSONL file with one test case per row")
+	tmpl := fs.String("template", "", "Prompt template, with {{.column}} replaced by the row's values")
+	tmplFile := fs.String("template-file", "", "File with the prompt template")
+	output := fs.String("output", "", "File to write every reply and its assertion results to as JSONL")
+	concurrency := fs.Int("concurrency", 8, "Requests in flight at once, across all targets")
+	var contains, matches listFlag
+	fs.Var(&contains, "expect-contains", "Column whose value each reply must contain, ignoring case (can be repeated)")
+	fs.Var(&matches, "expect-match", "Column holding a regular expression each reply must match (can be repeated)")
+	expectJSON := fs.Bool("expect-json", false, "Require every reply to hold valid JSON")
+	goldenDir := fs.String("golden", "", "Directory of golden answers every reply must match")
+	goldenMode := fs.String("golden-mode", goldenExact, "How replies are compared to golden answers: exact, normalized or judge")
+	judge := fs.String("judge", "", "Judge provider:model for --golden-mode judge")
+	minScore := fs.Float64("min-score", 7, "Lowest judge score, out of 10, that matches a golden answer")
+	update := fs.Bool("update-golden", false, "Record the replies as the golden answers instead of checking them")
+	fs.Parse(args)
+
+	if *dataset == "" {
+		fail("usage: general eval -t provider:model --dataset path --template text|--template-file path")
+	}
+	template := *tmpl
+	if *tmplFile != "" {
+		data, err := os.ReadFile(*tmplFile)
+		if err != nil {
+			fail("failed to read template: %v", err)
+		}
+		template = string(data)
+	}
+	if template == "" {
+		fail("--template or --template-file is required")
+	}
+	if *update && *goldenDir == "" {
+		fail("--update-golden needs --golden")
+	}
+
+	targets := flags.resolveTargets()
+	rows, err := eval.LoadDataset(*dataset)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	var assertions []func(eval.Row) []eval.Assertion
+	for _, column := range contains {
+		assertions = append(assertions, eval.ColumnAssertion(column, eval.ContainsFold))
+	}
+	for _, column := range matches {
+		assertions = append(assertions, eval.ColumnAssertion(column, eval.Matches))
+	}
+	if *expectJSON {
+		assertions = append(assertions, func(eval.Row) []eval.Assertion { return []eval.Assertion{eval.ValidJSON()} })
+	}
+
+	var base general.ChatCompletionRequest
+	if system := flags.systemPrompt(); system != "" {
+		base.Messages = []general.ChatCompletionMessage{general.SystemMessage(system)}
+	}
+	flags.params().apply(&base)
+
+	cases, err := eval.Dataset{
+		Rows:       rows,
+		Template:   template,
+		Request:    base,
+		Assertions: eval.Assertions(assertions...),
+	}.Cases()
+	if err != nil {
+		fail("%v", err)
+	}
+	cmd := flags.command(targets)
+	golden := eval.Golden{Dir: *goldenDir}
+	if *goldenDir != "" && !*update {
+		golden.Compare = goldenComparator(cmd, *goldenMode, *judge, *minScore)
+		cases = golden.Apply(cases)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "Running %d row(s) on %d target(s)...\n", len(rows), len(targets))
+	report := eval.RunBatch(ctx, cmd, cases, general.WithConcurrency(*concurrency))
+	if *update {
+		n, err := golden.Update(report)
+		if err != nil {
+			fail("%v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Recorded %d golden answer(s) in %s\n", n, *goldenDir)
+	}
+
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fail("failed to create output file: %v", err)
+		}
+		err = report.WriteJSONL(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fail("%v", err)
+		}
+	}
+	if err := report.Write(os.Stdout); err != nil {
+		fail("%v", err)
+	}
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
+
+// goldenComparator returns the comparator of a --golden-mode.
+func goldenComparator(cmd *general.Command, mode, judge string, minScore float64) eval.Comparator {
+	switch mode {
+	case goldenExact:
+		return eval.CompareExact()
+	case goldenNormalized:
+		return eval.CompareNormalized()
+	case goldenJudge:
+		if judge == "" {
+			fail("--golden-mode judge needs --judge provider:model")
+		}
+		target, err := parseTarget(judge)
+		if err != nil {
+			fail("invalid --judge: %v", err)
+		}
+		return eval.CompareJudged(cmd, target, minScore)
+	default:
+		fail("unknown golden mode %q (available: exact, normalized, judge)", mode)
+		return nil
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/festeh/general"
+)
+
+// requestFlags are the flags shared by subcommands that send completions.
+type requestFlags struct {
+	targets    listFlag
+	aliases    listFlag
+	proxy      *string
+	caFile     *string
+	certFile   *string
+	keyFile    *string
+	system     *string
+	systemFile *string
+	auditLog   *string
+	scrub      *bool
+	history    *bool
+	params     func() genParams
+	// closers are the audit log and result store opened by command.
+	closers []io.Closer
+}
+
+// addRequestFlags registers the target, connection, system prompt and
+// generation parameter flags on fs.
+func addRequestFlags(fs *flag.FlagSet) *requestFlags {
+	f := &requestFlags{}
+	fs.Var(&f.targets, "target", "Target in format provider:model or @group (can be repeated)")
+	fs.Var(&f.targets, "t", "Target in format provider:model (shorthand)")
+	fs.Var(&f.aliases, "alias", "Model alias in format [provider:]@alias=model (can be repeated)")
+	f.proxy = fs.String("proxy", cfg.Proxy, "Proxy URL for all providers (http, https or socks5)")
+	f.caFile = fs.String("ca-cert", "", "PEM file with extra root certificates to trust")
+	f.certFile = fs.String("client-cert", "", "PEM client certificate for mutual TLS")
+	f.keyFile = fs.String("client-key", "", "PEM client key for mutual TLS")
+	f.system = fs.String("system", cfg.System, "System prompt to prepend")
+	f.systemFile = fs.String("system-file", "", "File with a system prompt to prepend")
+	f.auditLog = fs.String("audit-log", cfg.AuditLog, "Append every request and response as JSONL to this file")
+	f.scrub = fs.Bool("scrub", cfg.Scrub, "Mask emails, API keys, IP addresses and internal host names in prompts before sending")
+	f.history = fs.Bool("history", cfg.History, "Record every request and response in the request history")
+	f.params = genFlags(fs)
+	return f
+}
+
+// resolveTargets registers the aliases and parses the targets, falling back
+// to the config file defaults. It exits with usage help if there are none.
+func (f *requestFlags) resolveTargets() []general.Target {
+	targets := f.targets
+	if len(targets) == 0 {
+		targets = cfg.Targets
+	}
+	if len(targets) == 0 {
+		usage()
+	}
+
+	f.registerAliases()
+	parsed, err := parseTargets(targets)
+	if err != nil {
+		fail("%v", err)
+	}
+	return parsed
+}
+
+// registerAliases registers the aliases given by --alias.
+func (f *requestFlags) registerAliases() {
+	for _, a := range f.aliases {
+		if err := setAlias(a); err != nil {
+			fail("%v", err)
+		}
+	}
+}
+
+// command builds a Command for targets with the connection, audit, scrub
+// and history flags applied.
+func (f *requestFlags) command(targets []general.Target) *general.Command {
+	var opts []general.Option
+	if *f.auditLog != "" {
+		audit, err := general.OpenAuditLog(expandHome(*f.auditLog))
+		if err != nil {
+			fail("%v", err)
+		}
+		f.closers = append(f.closers, audit)
+		opts = append(opts, general.WithAuditLog(audit))
+	}
+	if *f.scrub {
+		opts = append(opts, general.WithScrubbers(general.ScrubBasic))
+	}
+	if *f.history {
+		store := resultStore()
+		f.closers = append(f.closers, store)
+		opts = append(opts, general.WithResultStore(store))
+	}
+	cmd := general.NewCommand(targets, opts...)
+	if err := cmd.SetProxy(*f.proxy); err != nil {
+		fail("%v", err)
+	}
+	if err := cmd.SetTLS(general.TLSConfig{CAFile: *f.caFile, CertFile: *f.certFile, KeyFile: *f.keyFile}); err != nil {
+		fail("%v", err)
+	}
+	return cmd
+}
+
+// close flushes and closes the audit log and result store of the Command,
+// for long-running commands that must not lose records on exit.
+func (f *requestFlags) close() {
+	for _, c := range f.closers {
+		if err := c.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	f.closers = nil
+}
+
+// systemPrompt returns the combined --system and --system-file prompt.
+func (f *requestFlags) systemPrompt() string {
+	prompt, err := loadSystemPrompt(*f.system, *f.systemFile)
+	if err != nil {
+		fail("%v", err)
+	}
+	return prompt
+}
+
+// usage prints the command summary and exits.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Error: at least one --target (-t) required")
+	fmt.Fprintln(os.Stderr, "Usage: general -t provider:model[?param=value]|@group [-t ...] [prompt]")
+	fmt.Fprintln(os.Stderr, "       general chat -t provider:model | general chat --resume <id>")
+	fmt.Fprintln(os.Stderr, "       general sessions list|delete <id>")
+	fmt.Fprintln(os.Stderr, "       general history [-n 20] [--model m] [--client name] [--errors] | general show [--rerun] <id>")
+	fmt.Fprintln(os.Stderr, "       general replay <id> -t provider:model [-t ...]")
+	fmt.Fprintln(os.Stderr, "       general eval -t provider:model --dataset rows.csv --template text [--expect-contains column] [--output path]")
+	fmt.Fprintln(os.Stderr, "       general eval ... --golden dir [--golden-mode exact|normalized|judge] [--update-golden]")
+	fmt.Fprintln(os.Stderr, "       general report --input results.jsonl [--output report.html] [--judge provider:model]")
+	fmt.Fprintln(os.Stderr, "       general bench -t provider:model [-n 10] [--prompt-file path] [prompt]")
+	fmt.Fprintln(os.Stderr, "       general batch -t provider:model [-t ...] [--input prompts.jsonl] [--output results.jsonl] [--checkpoint path]")
+	fmt.Fprintln(os.Stderr, "       general batch submit -t provider:model [--input prompts.jsonl]")
+	fmt.Fprintln(os.Stderr, "       general batch status|results <id> -t provider:model [--wait] [--output path]")
+	fmt.Fprintln(os.Stderr, "       general serve [-t provider:model ...] [--addr 127.0.0.1:8080] [--policy fallback|race|balance] [--keys-file path] [--cache-ttl 10m] [--watch 2s] [--drain-timeout 30s]")
+	fmt.Fprintln(os.Stderr, "       general models [provider]")
+	fmt.Fprintln(os.Stderr, "       general doctor [provider ...]")
+	fmt.Fprintln(os.Stderr, "       general credits")
+	fmt.Fprintln(os.Stderr, "       general keys set|delete <provider>")
+	fmt.Fprintln(os.Stderr, "Providers: openai, openrouter, groq, chutes, gemini")
+	fmt.Fprintln(os.Stderr, "Models may be aliases: @fast, @cheap, @best")
+	fmt.Fprintln(os.Stderr, "API keys from the OS keyring or env: OPENAI_API_KEY, OPENROUTER_API_KEY, GROQ_API_KEY, CHUTES_API_KEY, GEMINI_API_KEY")
+	fmt.Fprintf(os.Stderr, "Config file: %s\n", configPath())
+	os.Exit(1)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/festeh/general"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDriver is the database/sql driver the request history is opened
+// with, registered by the pure-Go modernc.org/sqlite package.
+const sqliteDriver = "sqlite"
+
+// resultStore opens the request history in $XDG_DATA_HOME/general/history.db.
+func resultStore() *general.ResultStore {
+	dir := dataDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		fail("failed to create data directory: %v", err)
+	}
+	db, err := sql.Open(sqliteDriver, filepath.Join(dir, "history.db"))
+	if err != nil {
+		fail("failed to open request history: %v", err)
+	}
+	store, err := general.NewResultStore(context.Background(), db)
+	if err != nil {
+		fail("%v", err)
+	}
+	return store
+}
+
+// runHistory implements `general history`, listing recorded requests.
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	limit := fs.Int("n", 20, "Number of requests to list")
+	model := fs.String("model", "", "Only list requests to this model")
+	client := fs.String("client", "", "Only list requests made through `general serve` with this API key name")
+	errorsOnly := fs.Bool("errors", false, "Only list failed requests")
+	fs.Parse(args)
+
+	records, err := resultStore().List(context.Background(), general.RecordFilter{
+		Model:  *model,
+		Client: *client,
+		Errors: *errorsOnly,
+		Limit:  *limit,
+	})
+	if err != nil {
+		fail("%v", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tTARGET\tTOKENS\tCOST\tLATENCY\tSTATUS\tPROMPT")
+	for _, r := range records {
+		usage := r.Usage()
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t$%.6f\t%s\t%s\t%s\n",
+			r.ID, r.Time.Format(time.DateTime), recordTarget(r), usage.TotalTokens, r.Cost,
+			r.Duration.Round(time.Millisecond), recordStatus(r), recordTitle(r))
+	}
+	w.Flush()
+}
+
+// runShow implements `general show <id>`, printing a recorded request and
+// optionally sending it again.
+func runShow(args []string) {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	rerun := fs.Bool("rerun", false, "Send the request again to the same target")
+	raw := fs.Bool("raw", false, "Print the payload sent to the provider as JSON")
+	id := parseRecordID(fs, args, "usage: general show [--rerun] [--raw] <id>")
+
+	store := resultStore()
+	record, err := store.Get(context.Background(), id)
+	if err != nil {
+		fail("%v", err)
+	}
+	req, err := record.ChatRequest()
+	if err != nil {
+		fail("%v", err)
+	}
+
+	if *raw {
+		os.Stdout.Write(record.Body)
+		fmt.Println()
+	} else {
+		printRecord(record, req)
+	}
+	if !*rerun {
+		return
+	}
+
+	provider, err := resolveProvider(providerName(general.Provider{Endpoint: record.Endpoint}))
+	if err != nil {
+		fail("cannot rerun request %d: %v", id, err)
+	}
+	replay(store, record, []general.Target{{Provider: provider, Model: record.Model}})
+}
+
+// parseRecordID parses args with fs and returns the request ID they hold,
+// which may come before or after the flags.
+func parseRecordID(fs *flag.FlagSet, args []string, usage string) int64 {
+	arg := parseIDArg(fs, args, usage)
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		fail("invalid request ID %q", arg)
+	}
+	return id
+}
+
+// parseIDArg parses args with fs and returns their only positional
+// argument, which may come before or after the flags.
+func parseIDArg(fs *flag.FlagSet, args []string, usage string) string {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		args = append(args[1:], args[0])
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fail(usage)
+	}
+	return fs.Arg(0)
+}
+
+// runReplay implements `general replay <id> -t provider:model`, sending a
+// recorded request to other targets with its original payload.
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var targets listFlag
+	fs.Var(&targets, "target", "Target in format provider:model or @group (can be repeated)")
+	fs.Var(&targets, "t", "Target in format provider:model (shorthand)")
+	const usage = "usage: general replay <id> -t provider:model [-t ...]"
+	id := parseRecordID(fs, args, usage)
+	if len(targets) == 0 {
+		fail(usage)
+	}
+	parsed, err := parseTargets(targets)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	store := resultStore()
+	record, err := store.Get(context.Background(), id)
+	if err != nil {
+		fail("%v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Request %d was answered by %s in %s (%s)",
+		record.ID, recordTarget(record), record.Duration.Round(time.Millisecond), recordStatus(record))
+	if record.Response != nil && len(record.Response.Choices) > 0 {
+		fmt.Fprintf(os.Stderr, ":\n%s\n", record.Response.Choices[0].Message.Text())
+	} else {
+		fmt.Fprintln(os.Stderr)
+	}
+	replay(store, record, parsed)
+}
+
+// replay sends the request of record to targets, recording the new results
+// in store, and prints them.
+func replay(store *general.ResultStore, record general.Record, targets []general.Target) {
+	out, err := newPrinter(outputText, false, false, false)
+	if err != nil {
+		fail("%v", err)
+	}
+	cmd := general.NewCommand(targets, general.WithResultStore(store))
+	results, err := cmd.Replay(context.Background(), record)
+	if err != nil {
+		fail("%v", err)
+	}
+	fmt.Fprintln(os.Stderr)
+	start := time.Now()
+	for result := range results {
+		out.print(result, time.Since(start))
+	}
+	out.flush()
+}
+
+// printRecord writes the details, messages and reply of a recorded request.
+func printRecord(r general.Record, req general.ChatCompletionRequest) {
+	usage := r.Usage()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%d\n", r.ID)
+	fmt.Fprintf(w, "Time:\t%s\n", r.Time.Format(time.DateTime))
+	fmt.Fprintf(w, "Target:\t%s\n", recordTarget(r))
+	fmt.Fprintf(w, "Endpoint:\t%s\n", r.Endpoint)
+	if r.Client != "" {
+		fmt.Fprintf(w, "Client:\t%s\n", r.Client)
+	}
+	fmt.Fprintf(w, "Latency:\t%s\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "Tokens:\t%d prompt, %d completion\n", usage.PromptTokens, usage.CompletionTokens)
+	fmt.Fprintf(w, "Cost:\t$%.6f\n", r.Cost)
+	fmt.Fprintf(w, "Status:\t%s\n", recordStatus(r))
+	if r.Error != "" {
+		fmt.Fprintf(w, "Error:\t%s\n", r.Error)
+	}
+	w.Flush()
+
+	for _, m := range req.Messages {
+		fmt.Printf("\n--- %s ---\n%s\n", m.Role, m.Text())
+	}
+	if r.Response != nil && len(r.Response.Choices) > 0 {
+		reply := r.Response.Choices[0].Message
+		fmt.Printf("\n--- reply ---\n%s\n", reply.Text())
+		for _, call := range reply.ToolCalls {
+			fmt.Printf("tool call %s(%s)\n", call.Function.Name, call.Function.Arguments)
+		}
+	}
+}
+
+// recordTarget labels the target of r as provider:model.
+func recordTarget(r general.Record) string {
+	name := providerName(general.Provider{Endpoint: r.Endpoint})
+	if name == "" {
+		name = r.Endpoint
+	}
+	return name + ":" + r.Model
+}
+
+// recordStatus summarizes the outcome of r.
+func recordStatus(r general.Record) string {
+	switch {
+	case r.Error != "":
+		return "error"
+	case r.Cached:
+		return "cached"
+	default:
+		return "ok"
+	}
+}
+
+// recordTitle returns the start of the last user message of r.
+func recordTitle(r general.Record) string {
+	req, err := r.ChatRequest()
+	if err != nil {
+		return ""
+	}
+	for _, m := range slices.Backward(req.Messages) {
+		if m.Role == general.RoleUser {
+			title := []rune(strings.Join(strings.Fields(m.Text()), " "))
+			if len(title) > 50 {
+				return string(title[:47]) + "..."
+			}
+			return string(title)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// keyringService is the service name API keys are stored under in the OS keyring.
+const keyringService = "general"
+
+var errNoKeyring = errors.New("no supported keyring found (need secret-tool on Linux or security on macOS)")
+
+// keyringGet returns the key stored for provider, or "" if there is none
+// or no keyring is available.
+func keyringGet(provider string) string {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", provider, "-w")
+	case "linux", "freebsd", "openbsd":
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "account", provider)
+	default:
+		return ""
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// keyringSet stores key for provider, replacing any existing key.
+func keyringSet(provider, key string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// The command is read from stdin so that the key stays out of the
+		// argument list, which other users can see.
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -w %q\n", keyringService, provider, key))
+	case "linux", "freebsd", "openbsd":
+		cmd = exec.Command("secret-tool", "store", "--label", keyringService+" "+provider+" API key",
+			"service", keyringService, "account", provider)
+		cmd.Stdin = strings.NewReader(key)
+	default:
+		return errNoKeyring
+	}
+	return runKeyring(cmd)
+}
+
+// keyringDelete removes the key stored for provider.
+func keyringDelete(provider string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", provider)
+	case "linux", "freebsd", "openbsd":
+		cmd = exec.Command("secret-tool", "clear", "service", keyringService, "account", provider)
+	default:
+		return errNoKeyring
+	}
+	return runKeyring(cmd)
+}
+
+func runKeyring(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return errNoKeyring
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", cmd.Path, msg)
+		}
+		return fmt.Errorf("%s: %w", cmd.Path, err)
+	}
+	return nil
+}
+
+// runKeys implements `general keys set|delete <provider>`.
+func runKeys(args []string) {
+	if len(args) != 2 {
+		fail("usage: general keys set|delete <provider>")
+	}
+	action, name := args[0], strings.ToLower(args[1])
+	if !slices.Contains(providerNames(), name) {
+		fail("unknown provider %q (available: %s)", name, strings.Join(providerNames(), ", "))
+	}
+
+	switch action {
+	case "set":
+		key, err := readKey(name)
+		if err != nil {
+			fail("%v", err)
+		}
+		if key == "" {
+			fail("empty key")
+		}
+		if err := keyringSet(name, key); err != nil {
+			fail("%v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Stored %s API key in the keyring\n", name)
+	case "delete":
+		if err := keyringDelete(name); err != nil {
+			fail("%v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Deleted %s API key from the keyring\n", name)
+	default:
+		fail("unknown keys action %q, expected set or delete", action)
+	}
+}
+
+// readKey reads the API key for the named provider from the terminal
+// without echoing it, or from the first line of stdin if it is not a
+// terminal.
+func readKey(name string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Scan()
+		return strings.TrimSpace(scanner.Text()), scanner.Err()
+	}
+	fmt.Fprintf(os.Stderr, "Enter %s API key: ", name)
+	key, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key: %w", err)
+	}
+	return strings.TrimSpace(string(key)), nil
+}
@@ -11,84 +11,146 @@ import (
 	"github.com/festeh/general"
 )
 
-type targetFlag []string
+// listFlag collects the values of a repeatable flag.
+type listFlag []string
 
-func (t *targetFlag) String() string {
+func (t *listFlag) String() string {
 	return strings.Join(*t, ", ")
 }
 
-func (t *targetFlag) Set(value string) error {
+func (t *listFlag) Set(value string) error {
 	*t = append(*t, value)
 	return nil
 }
 
-var providerConstructors = map[string]func(string) general.Provider{
-	"openrouter": general.OpenRouter,
-	"groq":       general.Groq,
-	"chutes":     general.Chutes,
-	"gemini":     general.Gemini,
-}
+func main() {
+	if err := loadConfig(); err != nil {
+		fail("%v", err)
+	}
 
-var envVarNames = map[string]string{
-	"openrouter": "OPENROUTER_API_KEY",
-	"groq":       "GROQ_API_KEY",
-	"chutes":     "CHUTES_API_KEY",
-	"gemini":     "GEMINI_API_KEY",
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "models":
+			runModels(os.Args[2:])
+			return
+		case "chat":
+			runChat(os.Args[2:])
+			return
+		case "bench":
+			runBench(os.Args[2:])
+			return
+		case "sessions":
+			runSessions(os.Args[2:])
+			return
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "show":
+			runShow(os.Args[2:])
+			return
+		case "replay":
+			runReplay(os.Args[2:])
+			return
+		case "batch":
+			runBatch(os.Args[2:])
+			return
+		case "eval":
+			runEval(os.Args[2:])
+			return
+		case "report":
+			runReport(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "keys":
+			runKeys(os.Args[2:])
+			return
+		case "doctor":
+			runDoctor(os.Args[2:])
+			return
+		case "credits":
+			runCredits(os.Args[2:])
+			return
+		}
+	}
+	runPrompt(os.Args[1:])
 }
 
-func main() {
-	var targets targetFlag
-	flag.Var(&targets, "target", "Target in format provider:model (can be repeated)")
-	flag.Var(&targets, "t", "Target in format provider:model (shorthand)")
-	flag.Parse()
-
-	if len(targets) == 0 {
-		fmt.Fprintln(os.Stderr, "Error: at least one --target (-t) required")
-		fmt.Fprintln(os.Stderr, "Usage: general -t provider:model [-t provider:model ...] [prompt]")
-		fmt.Fprintln(os.Stderr, "Providers: openrouter, groq, chutes, gemini")
-		fmt.Fprintln(os.Stderr, "API keys from env: OPENROUTER_API_KEY, GROQ_API_KEY, CHUTES_API_KEY, GEMINI_API_KEY")
-		os.Exit(1)
+func runPrompt(args []string) {
+	fs := flag.NewFlagSet("general", flag.ExitOnError)
+	flags := addRequestFlags(fs)
+	var files listFlag
+	fs.Var(&files, "file", "File to include as context (can be repeated)")
+	stdinContext := fs.Bool("stdin-as-context", false, "Include stdin as context; the prompt comes from the arguments")
+	output := fs.String("output", outputText, "Output format: text, json or ndjson")
+	render := fs.Bool("render", false, "Render markdown in responses when stdout is a terminal")
+	showReasoning := fs.Bool("show-reasoning", false, "Show the model's reasoning (<think> blocks) instead of hiding it")
+	timing := fs.Bool("timing", false, "Show the DNS, connect, TLS, time-to-first-byte and body-read timing of each request")
+	var quiet bool
+	fs.BoolVar(&quiet, "quiet", false, "Print only the response content of a single target")
+	fs.BoolVar(&quiet, "q", false, "Print only the response content (shorthand)")
+	tui := fs.Bool("tui", false, "Stream responses side by side, one pane per target")
+	compare := fs.Bool("compare", false, "Compare the responses once all targets are done")
+	judge := fs.String("judge", "", "Score the responses with this provider:model as judge (implies --compare)")
+	rubric := fs.String("rubric", "", "Rubric for --judge (default: correctness, completeness, relevance and clarity)")
+	embeddings := fs.String("embeddings", "", "Compare the responses by the embeddings of this provider:model and flag outliers (implies --compare)")
+	fs.Parse(args)
+
+	var judgeTarget general.Target
+	if *judge != "" {
+		*compare = true
+		t, err := parseTarget(*judge)
+		if err != nil {
+			fail("invalid --judge: %v", err)
+		}
+		judgeTarget = t
 	}
-
-	// Parse targets
-	var generalTargets []general.Target
-	for _, t := range targets {
-		parts := strings.SplitN(t, ":", 2)
-		if len(parts) != 2 {
-			fmt.Fprintf(os.Stderr, "Error: invalid target format %q, expected provider:model\n", t)
-			os.Exit(1)
+	var embeddingTarget general.Target
+	if *embeddings != "" {
+		*compare = true
+		t, err := parseTarget(*embeddings)
+		if err != nil {
+			fail("invalid --embeddings: %v", err)
 		}
+		embeddingTarget = t
+	}
 
-		providerName := strings.ToLower(parts[0])
-		model := parts[1]
+	if *compare && (quiet || *output != outputText) {
+		fail("--compare needs the default text output")
+	}
 
-		constructor, ok := providerConstructors[providerName]
-		if !ok {
-			fmt.Fprintf(os.Stderr, "Error: unknown provider %q\n", providerName)
-			fmt.Fprintln(os.Stderr, "Available: openrouter, groq, chutes, gemini")
-			os.Exit(1)
-		}
+	if quiet && *output != outputText {
+		fail("--quiet cannot be combined with --output %s", *output)
+	}
+	out, err := newPrinter(*output, *render, *showReasoning, *timing)
+	if err != nil {
+		fail("%v", err)
+	}
+	if quiet {
+		out = quietPrinter{}
+	}
 
-		envVar := envVarNames[providerName]
-		apiKey := os.Getenv(envVar)
-		if apiKey == "" {
-			fmt.Fprintf(os.Stderr, "Error: %s not set\n", envVar)
-			os.Exit(1)
-		}
+	generalTargets := flags.resolveTargets()
+	if quiet && len(generalTargets) != 1 {
+		fail("--quiet needs exactly one target, got %d", len(generalTargets))
+	}
 
-		provider := constructor(apiKey)
-		generalTargets = append(generalTargets, general.Target{
-			Provider: provider,
-			Model:    model,
-		})
+	attachments, err := readAttachments(files, *stdinContext)
+	if err != nil {
+		fail("%v", err)
 	}
 
 	// Get prompt from args or stdin
 	var prompt string
-	if flag.NArg() > 0 {
-		prompt = strings.Join(flag.Args(), " ")
+	if fs.NArg() > 0 {
+		prompt = strings.Join(fs.Args(), " ")
+	} else if *stdinContext {
+		fail("--stdin-as-context needs the prompt as arguments")
 	} else {
-		fmt.Fprintln(os.Stderr, "Enter prompt (Ctrl+D to send):")
+		if !quiet {
+			fmt.Fprintln(os.Stderr, "Enter prompt (Ctrl+D to send):")
+		}
 		scanner := bufio.NewScanner(os.Stdin)
 		var lines []string
 		for scanner.Scan() {
@@ -102,63 +164,83 @@ func main() {
 		os.Exit(1)
 	}
 
+	systemPrompt := flags.systemPrompt()
+
 	// Execute
-	cmd := general.NewCommand(generalTargets, nil)
+	cmd := flags.command(generalTargets)
+	var messages []general.ChatCompletionMessage
+	if systemPrompt != "" {
+		messages = append(messages, general.SystemMessage(systemPrompt))
+	}
 	req := general.ChatCompletionRequest{
-		Messages: []general.ChatCompletionMessage{
-			{Role: "user", Content: prompt},
-		},
+		Messages: append(messages, general.UserMessage(withAttachments(prompt, attachments))),
 	}
+	flags.params().apply(&req)
 
-	startTime := time.Now()
-	fmt.Fprintf(os.Stderr, "[%s] Sending to %d target(s)...\n", startTime.Format("15:04:05.000"), len(generalTargets))
-
-	results := cmd.Execute(req)
-
-	for result := range results {
-		timestamp := time.Now().Format("15:04:05.000")
-		elapsed := time.Since(startTime).Round(time.Millisecond)
-
-		if result.Error != nil {
-			fmt.Printf("[%s] [%s] ❌ %s/%s: %v\n",
-				timestamp, elapsed,
-				providerNameFromEndpoint(result.Target.Provider.Endpoint),
-				result.Target.Model,
-				result.Error,
-			)
-			continue
+	if *tui && isTerminal(os.Stdout) {
+		results := runTUI(cmd, generalTargets, req, out)
+		if len(generalTargets) > 1 {
+			printSummary(results)
 		}
-
-		content := ""
-		if len(result.Response.Choices) > 0 {
-			content = result.Response.Choices[0].Message.Content
+		if *compare {
+			printComparison(results)
+		}
+		if *embeddings != "" {
+			printSimilarity(cmd, embeddingTarget, results)
+		}
+		if *judge != "" {
+			printJudgement(cmd, judgeTarget, req, results, *rubric)
 		}
+		return
+	}
 
-		fmt.Printf("\n[%s] [%s] ✓ %s/%s:\n%s\n",
-			timestamp, elapsed,
-			providerNameFromEndpoint(result.Target.Provider.Endpoint),
-			result.Target.Model,
-			content,
-		)
+	startTime := time.Now()
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "[%s] Sending to %d target(s)...\n", startTime.Format("15:04:05.000"), len(generalTargets))
 	}
 
-	fmt.Fprintf(os.Stderr, "\n[%s] Done (total: %s)\n",
-		time.Now().Format("15:04:05.000"),
-		time.Since(startTime).Round(time.Millisecond),
-	)
+	var results []general.Result
+	for result := range cmd.Execute(req) {
+		out.print(result, time.Since(startTime))
+		results = append(results, result)
+	}
+	out.flush()
+	if *compare {
+		printComparison(results)
+	}
+	if *embeddings != "" {
+		printSimilarity(cmd, embeddingTarget, results)
+	}
+	if *judge != "" {
+		printJudgement(cmd, judgeTarget, req, results, *rubric)
+	}
+
+	if !quiet && len(generalTargets) > 1 {
+		printSummary(results)
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "\n[%s] Done (total: %s)\n",
+			time.Now().Format("15:04:05.000"),
+			time.Since(startTime).Round(time.Millisecond),
+		)
+	}
 }
 
-func providerNameFromEndpoint(endpoint string) string {
-	switch {
-	case strings.Contains(endpoint, "openrouter"):
-		return "openrouter"
-	case strings.Contains(endpoint, "groq"):
-		return "groq"
-	case strings.Contains(endpoint, "chutes"):
-		return "chutes"
-	case strings.Contains(endpoint, "generativelanguage.googleapis"):
-		return "gemini"
-	default:
-		return "unknown"
+// loadSystemPrompt combines the --system text and the contents of
+// --system-file into one system prompt.
+func loadSystemPrompt(text, path string) (string, error) {
+	var parts []string
+	if strings.TrimSpace(text) != "" {
+		parts = append(parts, text)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read system prompt: %w", err)
+		}
+		if content := strings.TrimSpace(string(data)); content != "" {
+			parts = append(parts, content)
+		}
 	}
+	return strings.Join(parts, "\n\n"), nil
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/festeh/general"
+)
+
+// runModels implements `general models [provider]`. Without a provider it
+// lists models for every provider that has an API key configured.
+func runModels(args []string) {
+	names := args
+	if len(names) == 0 {
+		names = configuredProviders()
+	}
+
+	cmd := general.NewCommand(nil)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	failed := false
+
+	for _, name := range names {
+		provider, err := resolveProvider(name)
+		if err != nil {
+			fail("%v", err)
+		}
+
+		models, err := cmd.ListModels(context.Background(), provider)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", name, err)
+			failed = true
+			continue
+		}
+
+		for _, m := range models {
+			window := ""
+			if m.ContextLength > 0 {
+				window = fmt.Sprintf("%d", m.ContextLength)
+			}
+			fmt.Fprintf(w, "%s:%s\t%s\n", name, m.ID, window)
+		}
+	}
+
+	w.Flush()
+	if failed {
+		os.Exit(1)
+	}
+}
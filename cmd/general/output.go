@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/festeh/general"
+)
+
+// Output formats for --output.
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+// printer writes results to stdout as they arrive.
+type printer interface {
+	print(result general.Result, elapsed time.Duration)
+	// flush writes anything buffered once all results are in.
+	flush()
+}
+
+// newPrinter returns the printer for format. render enables markdown
+// rendering of text output when stdout is a terminal; reasoning includes
+// the model's reasoning in the output and timing the request phase timing.
+func newPrinter(format string, render, reasoning, timing bool) (printer, error) {
+	switch format {
+	case outputText:
+		return textPrinter{render: render && isTerminal(os.Stdout), reasoning: reasoning, timing: timing}, nil
+	case outputJSON:
+		return &jsonPrinter{reasoning: reasoning, timing: timing}, nil
+	case outputNDJSON:
+		return ndjsonPrinter{enc: json.NewEncoder(os.Stdout), reasoning: reasoning, timing: timing}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q (available: text, json, ndjson)", format)
+	}
+}
+
+// record is the machine-readable form of a result.
+type record struct {
+	Provider  string         `json:"provider"`
+	Model     string         `json:"model"`
+	LatencyMS int64          `json:"latency_ms"`
+	ElapsedMS int64          `json:"elapsed_ms"`
+	Usage     *general.Usage `json:"usage,omitempty"`
+	Timing    *timingRecord  `json:"timing,omitempty"`
+	Reasoning string         `json:"reasoning,omitempty"`
+	Content   string         `json:"content,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// timingRecord is the machine-readable form of general.Timing, in milliseconds.
+type timingRecord struct {
+	DNSMS      float64 `json:"dns_ms"`
+	ConnectMS  float64 `json:"connect_ms"`
+	TLSMS      float64 `json:"tls_ms"`
+	TTFBMS     float64 `json:"ttfb_ms"`
+	BodyReadMS float64 `json:"body_read_ms"`
+	TotalMS    float64 `json:"total_ms"`
+	Reused     bool    `json:"reused"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func newRecord(result general.Result, elapsed time.Duration, reasoning, timing bool) record {
+	r := record{
+		Provider:  providerName(result.Target.Provider),
+		Model:     result.Target.Model,
+		LatencyMS: result.Duration.Milliseconds(),
+		ElapsedMS: elapsed.Milliseconds(),
+		Usage:     result.Response.Usage,
+		Content:   resultContent(result),
+	}
+	if reasoning {
+		r.Reasoning = result.Reasoning()
+	}
+	if t := result.Timing(); timing && t != nil {
+		r.Timing = &timingRecord{
+			DNSMS:      milliseconds(t.DNS),
+			ConnectMS:  milliseconds(t.Connect),
+			TLSMS:      milliseconds(t.TLS),
+			TTFBMS:     milliseconds(t.TTFB),
+			BodyReadMS: milliseconds(t.BodyRead),
+			TotalMS:    milliseconds(t.Total),
+			Reused:     t.Reused,
+		}
+	}
+	if result.Error != nil {
+		r.Error = result.Error.Error()
+	}
+	return r
+}
+
+// resultContent returns the text of the first choice without reasoning, or
+// "" if there is none.
+func resultContent(result general.Result) string {
+	return result.Content()
+}
+
+// textPrinter writes the human-readable log format.
+type textPrinter struct {
+	render    bool
+	reasoning bool
+	timing    bool
+}
+
+func (p textPrinter) print(result general.Result, elapsed time.Duration) {
+	timestamp := time.Now().Format("15:04:05.000")
+	elapsed = elapsed.Round(time.Millisecond)
+
+	if result.Error != nil {
+		fmt.Printf("[%s] [%s] ❌ %s/%s: %v\n",
+			timestamp, elapsed,
+			providerName(result.Target.Provider),
+			result.Target.Model,
+			result.Error,
+		)
+		return
+	}
+
+	content := resultContent(result)
+	if p.render {
+		content = renderMarkdown(content)
+	}
+	if reasoning := result.Reasoning(); p.reasoning && reasoning != "" {
+		content = ansiDim + reasoning + ansiReset + "\n\n" + content
+	}
+	fmt.Printf("\n[%s] [%s] ✓ %s/%s:\n%s\n",
+		timestamp, elapsed,
+		providerName(result.Target.Provider),
+		result.Target.Model,
+		content,
+	)
+	if t := result.Timing(); p.timing && t != nil {
+		fmt.Println(ansiDim + formatTiming(*t) + ansiReset)
+	}
+}
+
+// formatTiming renders the phases of a request on one line.
+func formatTiming(t general.Timing) string {
+	round := func(d time.Duration) time.Duration { return d.Round(time.Millisecond) }
+	connection := "reused connection"
+	if !t.Reused {
+		connection = fmt.Sprintf("dns %s · connect %s · tls %s", round(t.DNS), round(t.Connect), round(t.TLS))
+	}
+	return fmt.Sprintf("%s · ttfb %s · body %s · total %s", connection, round(t.TTFB), round(t.BodyRead), round(t.Total))
+}
+
+func (textPrinter) flush() {}
+
+// ndjsonPrinter writes one JSON record per line as results arrive.
+type ndjsonPrinter struct {
+	enc       *json.Encoder
+	reasoning bool
+	timing    bool
+}
+
+func (p ndjsonPrinter) print(result general.Result, elapsed time.Duration) {
+	p.enc.Encode(newRecord(result, elapsed, p.reasoning, p.timing))
+}
+
+func (ndjsonPrinter) flush() {}
+
+// jsonPrinter collects records and writes them as one JSON array.
+type jsonPrinter struct {
+	records   []record
+	reasoning bool
+	timing    bool
+}
+
+func (p *jsonPrinter) print(result general.Result, elapsed time.Duration) {
+	p.records = append(p.records, newRecord(result, elapsed, p.reasoning, p.timing))
+}
+
+func (p *jsonPrinter) flush() {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(p.records)
+}
+
+// quietPrinter writes only the response content, exiting non-zero on failure.
+type quietPrinter struct{}
+
+func (quietPrinter) print(result general.Result, _ time.Duration) {
+	if result.Error != nil {
+		fail("%v", result.Error)
+	}
+	content := resultContent(result)
+	fmt.Print(content)
+	if !strings.HasSuffix(content, "\n") {
+		fmt.Println()
+	}
+}
+
+func (quietPrinter) flush() {}
+
+// printSummary writes the tokens, cost, latency and errors of results per
+// target and in total to stderr.
+func printSummary(results []general.Result) {
+	summary := general.Summarize(results)
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\ntarget\tok\ttokens\tcost\tlatency")
+	row := func(label string, s general.UsageSummary) {
+		cost := fmt.Sprintf("$%.5f", s.Cost)
+		switch {
+		case s.Unpriced == s.Successes():
+			cost = "-"
+		case s.Unpriced > 0:
+			cost += fmt.Sprintf(" (+%d unpriced)", s.Unpriced)
+		}
+		fmt.Fprintf(w, "%s\t%d/%d\t%d→%d\t%s\t%s\n", label, s.Successes(), s.Requests,
+			s.PromptTokens, s.CompletionTokens, cost, s.MaxLatency.Round(time.Millisecond))
+	}
+	for _, s := range summary.Targets {
+		row(targetLabel(s.Target), s)
+	}
+	row("total", summary.Total)
+	w.Flush()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/url"
+	"strings"
+
+	"github.com/festeh/general"
+)
+
+// genParams are the generation parameters shared by all targets.
+type genParams struct {
+	temperature *float64
+	maxTokens   int
+	topP        float64
+	seed        *int
+	stop        []string
+}
+
+// genFlags registers the generation parameter flags on fs. The returned
+// function, called after parsing, applies the flags that were set on top of
+// the config file defaults.
+func genFlags(fs *flag.FlagSet) func() genParams {
+	temperature := fs.Float64("temperature", 0, "Sampling temperature")
+	maxTokens := fs.Int("max-tokens", 0, "Maximum tokens to generate")
+	topP := fs.Float64("top-p", 0, "Nucleus sampling probability mass")
+	seed := fs.Int("seed", 0, "Seed for deterministic sampling")
+	var stop listFlag
+	fs.Var(&stop, "stop", "Stop sequence (can be repeated)")
+
+	return func() genParams {
+		params := genParams{
+			temperature: cfg.Temperature,
+			maxTokens:   cfg.MaxTokens,
+			topP:        cfg.TopP,
+			seed:        cfg.Seed,
+			stop:        cfg.Stop,
+		}
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "temperature":
+				params.temperature = temperature
+			case "max-tokens":
+				params.maxTokens = *maxTokens
+			case "top-p":
+				params.topP = *topP
+			case "seed":
+				params.seed = seed
+			case "stop":
+				params.stop = stop
+			}
+		})
+		return params
+	}
+}
+
+// apply sets the parameters on req.
+func (p genParams) apply(req *general.ChatCompletionRequest) {
+	req.MaxTokens = p.maxTokens
+	req.TopP = p.topP
+	req.Seed = p.seed
+	req.Stop = p.stop
+	if p.temperature != nil {
+		req.Temperature = *p.temperature
+		// The typed field omits zero, so send an explicit 0 as an extra field.
+		if *p.temperature == 0 {
+			if req.Extra == nil {
+				req.Extra = map[string]any{}
+			}
+			req.Extra["temperature"] = 0
+		}
+	}
+}
+
+// parseTargetParams decodes per-target parameters such as
+// "temperature=0&max-tokens=200" into request fields. Values are read as
+// JSON where possible and as strings otherwise; stop is always a list.
+func parseTargetParams(query string) (map[string]any, error) {
+	if query == "" {
+		return nil, nil
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	extra := make(map[string]any, len(values))
+	for key, vals := range values {
+		key = strings.ReplaceAll(key, "-", "_")
+		if key == "stop" {
+			extra[key] = vals
+			continue
+		}
+		raw := vals[len(vals)-1]
+		var value any
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		extra[key] = value
+	}
+	return extra, nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/festeh/general"
+)
+
+// providerOrder lists the supported providers in the order they are shown.
+var providerOrder = []string{"openai", "openrouter", "groq", "chutes", "gemini"}
+
+var providerConstructors = map[string]func(string) general.Provider{
+	"openai":     general.OpenAI,
+	"openrouter": general.OpenRouter,
+	"groq":       general.Groq,
+	"chutes":     general.Chutes,
+	"gemini":     general.Gemini,
+}
+
+var envVarNames = map[string]string{
+	"openai":     "OPENAI_API_KEY",
+	"openrouter": "OPENROUTER_API_KEY",
+	"groq":       "GROQ_API_KEY",
+	"chutes":     "CHUTES_API_KEY",
+	"gemini":     "GEMINI_API_KEY",
+}
+
+// providerNames returns the built-in providers followed by the custom
+// providers defined in the config file, sorted by name.
+func providerNames() []string {
+	names := slices.Clone(providerOrder)
+	var custom []string
+	for name := range cfg.Providers {
+		if _, ok := providerConstructors[name]; !ok {
+			custom = append(custom, name)
+		}
+	}
+	slices.Sort(custom)
+	return append(names, custom...)
+}
+
+// configuredProviders returns the names of providers with an API key set,
+// plus all custom providers, exiting if there are none.
+func configuredProviders() []string {
+	var names []string
+	for _, name := range providerNames() {
+		_, builtin := providerConstructors[name]
+		if key, err := apiKey(name); !builtin || (err == nil && key != "") {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		fail("no API keys set; run `general keys set <provider>` or export a provider key variable")
+	}
+	return names
+}
+
+// apiKey returns the API key for the named provider from the config file,
+// the OS keyring or its environment variable, in that order.
+func apiKey(name string) (string, error) {
+	if key, err := cfg.Providers[name].apiKey(); key != "" || err != nil {
+		return key, err
+	}
+	if key := keyringGet(name); key != "" {
+		return key, nil
+	}
+	return os.Getenv(envVarNames[name]), nil
+}
+
+// resolveProvider builds the named provider with its API key and any
+// settings from the config file.
+func resolveProvider(name string) (general.Provider, error) {
+	name = strings.ToLower(name)
+
+	pc, custom := cfg.Providers[name]
+	constructor, ok := providerConstructors[name]
+	if !ok && !custom {
+		return general.Provider{}, fmt.Errorf("unknown provider %q (available: %s)", name, strings.Join(providerNames(), ", "))
+	}
+
+	key, err := apiKey(name)
+	if err != nil {
+		return general.Provider{}, fmt.Errorf("%s: %w", name, err)
+	}
+	if key == "" && ok {
+		return general.Provider{}, fmt.Errorf("no API key for %s: run `general keys set %s` or set %s", name, name, envVarNames[name])
+	}
+
+	var provider general.Provider
+	if ok {
+		provider = constructor(key)
+	} else {
+		provider = general.Provider{APIKey: key}
+	}
+	// A comma-separated key holds a pool of keys used in turn.
+	if keys := strings.Split(key, ","); len(keys) > 1 {
+		provider = provider.WithKeys(general.RotateRoundRobin, keys...)
+		provider.APIKey = ""
+	}
+
+	if pc.GeminiNative {
+		provider.GeminiNative = true
+		provider.Endpoint = general.GeminiNativeEndpoint
+	}
+	if pc.Endpoint != "" {
+		provider.Endpoint = pc.Endpoint
+	}
+	for k, v := range pc.Headers {
+		provider = provider.WithHeader(k, v)
+	}
+	provider.Proxy = pc.Proxy
+	provider.TextCompletion = pc.TextCompletion
+	return provider, nil
+}
+
+// parseTargets parses target specifications, expanding @group references
+// to the groups defined in the config file.
+func parseTargets(specs []string) ([]general.Target, error) {
+	var targets []general.Target
+	for _, spec := range specs {
+		if general.IsAlias(spec) {
+			group, err := resolveGroup(strings.TrimPrefix(spec, general.AliasPrefix))
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, group.Targets...)
+			continue
+		}
+		target, err := parseTarget(spec)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// resolveGroup builds the named target group from the config file.
+func resolveGroup(name string) (general.Group, error) {
+	specs, ok := cfg.Groups[name]
+	if !ok {
+		return general.Group{}, fmt.Errorf("unknown target group %q", name)
+	}
+	var targets []general.Target
+	for _, spec := range specs {
+		if general.IsAlias(spec) {
+			return general.Group{}, fmt.Errorf("target group %q: nested group %q is not supported", name, spec)
+		}
+		target, err := parseTarget(spec)
+		if err != nil {
+			return general.Group{}, fmt.Errorf("target group %q: %w", name, err)
+		}
+		targets = append(targets, target)
+	}
+	return general.NewGroup(name, targets...), nil
+}
+
+// parseTarget parses a provider:model[?param=value&...] target specification.
+func parseTarget(spec string) (general.Target, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		return general.Target{}, fmt.Errorf("invalid target format %q, expected provider:model", spec)
+	}
+
+	provider, err := resolveProvider(parts[0])
+	if err != nil {
+		return general.Target{}, err
+	}
+
+	model, query, _ := strings.Cut(parts[1], "?")
+	extra, err := parseTargetParams(query)
+	if err != nil {
+		return general.Target{}, fmt.Errorf("invalid target %q: %w", spec, err)
+	}
+
+	return general.DefaultAliases.ResolveTarget(general.Target{Provider: provider, Model: model, Extra: extra})
+}
+
+// setAlias registers an alias from a provider:@alias=model specification.
+// Omitting the provider applies the alias to all providers.
+func setAlias(spec string) error {
+	name, model, ok := strings.Cut(spec, "=")
+	if !ok || model == "" {
+		return fmt.Errorf("invalid alias format %q, expected [provider:]@alias=model", spec)
+	}
+	provider, alias, ok := strings.Cut(name, ":")
+	if !ok {
+		provider, alias = "", name
+	}
+	if !general.IsAlias(alias) {
+		return fmt.Errorf("invalid alias %q, aliases start with %s", alias, general.AliasPrefix)
+	}
+	general.DefaultAliases.Set(provider, alias, model)
+	return nil
+}
+
+// unsetAlias removes an alias set by setAlias, given as [provider:]@alias.
+func unsetAlias(name string) {
+	provider, alias, ok := strings.Cut(name, ":")
+	if !ok {
+		provider, alias = "", name
+	}
+	general.DefaultAliases.Delete(provider, alias)
+}
+
+// providerName returns the name of p, looking up custom providers in the config file.
+func providerName(p general.Provider) string {
+	if name := p.Name(); name != "" {
+		return name
+	}
+	for name, pc := range cfg.Providers {
+		if pc.Endpoint == p.Endpoint {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// fail prints an error message to stderr and exits with status 1.
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/festeh/general"
+)
+
+// reloader applies changes to the config and key files to a running
+// gateway. Requests in flight keep the routes and keys they started with.
+type reloader struct {
+	mu       sync.Mutex
+	gateway  *general.Gateway
+	flags    *requestFlags
+	defaults routeDefaults
+	apiKeys  []string
+	keysFile string
+	keys     []general.GatewayKey
+}
+
+// reload rereads the config file and the key file, if any, and logs what
+// changed.
+func (r *reloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reloadConfig()
+	if r.keysFile != "" {
+		r.reloadKeys()
+	}
+}
+
+// reloadConfig rereads the config file. The routes are rebuilt only if
+// their targets, providers, groups or aliases changed, so that edits to
+// other settings keep the caches and balancers of the routes. A config
+// that fails to load keeps the previous one.
+func (r *reloader) reloadConfig() {
+	previous := cfg
+	cfg = config{}
+	if err := loadConfig(); err != nil {
+		r.restore(previous, err)
+		return
+	}
+	changes := configChanges(previous, cfg)
+	if len(changes) == 0 {
+		return
+	}
+	applyAliases(previous, cfg)
+	r.flags.registerAliases()
+	if routingChanged(previous, cfg) {
+		def, rules, err := r.routes()
+		if err != nil {
+			r.restore(previous, err)
+			return
+		}
+		r.gateway.SetRoutes(def, rules...)
+		changes = append(changes, "routes now "+describeRoutes(def, rules))
+	}
+	fmt.Fprintf(os.Stderr, "Reloaded config: %s\n", strings.Join(changes, "; "))
+}
+
+// restore reverts to the previous config after a reload failed with err.
+func (r *reloader) restore(previous config, err error) {
+	applyAliases(cfg, previous)
+	cfg = previous
+	r.flags.registerAliases()
+	fmt.Fprintf(os.Stderr, "Keeping previous config: %v\n", err)
+}
+
+// routes builds the routes of the current config.
+func (r *reloader) routes() (*general.GatewayRoute, []general.GatewayRule, error) {
+	var targets []general.Target
+	spec := []string(r.flags.targets)
+	if len(spec) == 0 {
+		spec = cfg.Targets
+	}
+	if len(spec) > 0 {
+		parsed, err := parseTargets(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		targets = parsed
+	}
+	return serveRoutes(r.flags.targets, targets, r.defaults)
+}
+
+// reloadKeys rereads the key file. A file that fails to load or has no
+// keys keeps the previous keys.
+func (r *reloader) reloadKeys() {
+	keys, err := gatewayKeys(r.apiKeys, r.keysFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Keeping previous keys: %v\n", err)
+		return
+	}
+	if len(keys) == 0 {
+		fmt.Fprintln(os.Stderr, "Keeping previous keys: the keys file has none")
+		return
+	}
+	changes := keyChanges(r.keys, keys)
+	if len(changes) == 0 {
+		return
+	}
+	r.gateway.SetKeys(keys...)
+	r.keys = keys
+	fmt.Fprintf(os.Stderr, "Reloaded keys: %s\n", strings.Join(changes, "; "))
+}
+
+// applyAliases replaces the aliases of the config from with those of to.
+func applyAliases(from, to config) {
+	for name := range from.Aliases {
+		if _, ok := to.Aliases[name]; !ok {
+			unsetAlias(name)
+		}
+	}
+	for name, model := range to.Aliases {
+		setAlias(name + "=" + model)
+	}
+}
+
+// routingChanged reports whether the routes built from the configs a and
+// b may differ.
+func routingChanged(a, b config) bool {
+	return !slices.Equal(a.Targets, b.Targets) ||
+		!reflect.DeepEqual(a.Routes, b.Routes) ||
+		!reflect.DeepEqual(a.Providers, b.Providers) ||
+		!reflect.DeepEqual(a.Groups, b.Groups) ||
+		!maps.Equal(a.Aliases, b.Aliases)
+}
+
+// configChanges describes the differences between the configs a and b.
+// Settings that only apply to new Commands are reported as needing a
+// restart.
+func configChanges(a, b config) []string {
+	var changes []string
+	if !slices.Equal(a.Targets, b.Targets) {
+		changes = append(changes, fmt.Sprintf("targets %s -> %s", strings.Join(a.Targets, ","), strings.Join(b.Targets, ",")))
+	}
+	changes = append(changes, mapChanges("route", a.Routes, b.Routes)...)
+	changes = append(changes, mapChanges("provider", a.Providers, b.Providers)...)
+	changes = append(changes, mapChanges("group", a.Groups, b.Groups)...)
+	for _, name := range slices.Sorted(maps.Keys(b.Aliases)) {
+		if model, ok := a.Aliases[name]; !ok || model != b.Aliases[name] {
+			changes = append(changes, fmt.Sprintf("alias %s = %s", name, b.Aliases[name]))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(a.Aliases)) {
+		if _, ok := b.Aliases[name]; !ok {
+			changes = append(changes, "removed alias "+name)
+		}
+	}
+
+	static := []struct {
+		name  string
+		equal bool
+	}{
+		{"system", a.System == b.System},
+		{"temperature", reflect.DeepEqual(a.Temperature, b.Temperature)},
+		{"max_tokens", a.MaxTokens == b.MaxTokens},
+		{"top_p", a.TopP == b.TopP},
+		{"seed", reflect.DeepEqual(a.Seed, b.Seed)},
+		{"stop", slices.Equal(a.Stop, b.Stop)},
+		{"proxy", a.Proxy == b.Proxy},
+		{"audit_log", a.AuditLog == b.AuditLog},
+		{"scrub", a.Scrub == b.Scrub},
+		{"history", a.History == b.History},
+	}
+	for _, s := range static {
+		if !s.equal {
+			changes = append(changes, s.name+" changed (restart to apply)")
+		}
+	}
+	return changes
+}
+
+// mapChanges describes the entries added to, removed from or changed
+// between a and b, which are named kind in the description.
+func mapChanges[V any](kind string, a, b map[string]V) []string {
+	var changes []string
+	for _, name := range slices.Sorted(maps.Keys(b)) {
+		old, ok := a[name]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("added %s %s", kind, name))
+		case !reflect.DeepEqual(old, b[name]):
+			changes = append(changes, fmt.Sprintf("changed %s %s", kind, name))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(a)) {
+		if _, ok := b[name]; !ok {
+			changes = append(changes, fmt.Sprintf("removed %s %s", kind, name))
+		}
+	}
+	return changes
+}
+
+// keyChanges describes the keys added, removed or changed between a and b
+// by name, without revealing them.
+func keyChanges(a, b []general.GatewayKey) []string {
+	byName := func(keys []general.GatewayKey) map[string]general.GatewayKey {
+		m := make(map[string]general.GatewayKey, len(keys))
+		for _, k := range keys {
+			m[k.Name] = k
+		}
+		return m
+	}
+	return mapChanges("key", byName(a), byName(b))
+}
+
+// onHangup calls reload on every SIGHUP.
+func onHangup(reload func()) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		reload()
+	}
+}
+
+// watchFiles calls reload whenever one of paths is modified, created or
+// removed, checking every interval. Polling keeps it portable and catches
+// editors that replace files rather than writing them.
+func watchFiles(interval time.Duration, reload func(), paths ...string) {
+	stamp := func() string {
+		var b strings.Builder
+		for _, path := range paths {
+			if info, err := os.Stat(path); err == nil {
+				fmt.Fprintf(&b, "%s %d %d\n", path, info.ModTime().UnixNano(), info.Size())
+			}
+		}
+		return b.String()
+	}
+	last := stamp()
+	for range time.Tick(interval) {
+		if s := stamp(); s != last {
+			last = s
+			reload()
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ANSI escape sequences used by the markdown renderer.
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiDim       = "\x1b[2m"
+	ansiItalic    = "\x1b[3m"
+	ansiUnderline = "\x1b[4m"
+	ansiRed       = "\x1b[31m"
+	ansiGreen     = "\x1b[32m"
+	ansiYellow    = "\x1b[33m"
+	ansiBlue      = "\x1b[34m"
+	ansiMagenta   = "\x1b[35m"
+	ansiCyan      = "\x1b[36m"
+)
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+var (
+	headingPattern  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bulletPattern   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	numberedPattern = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	rulePattern     = regexp.MustCompile(`^\s*(-\s*){3,}$|^\s*(\*\s*){3,}$|^\s*(_\s*){3,}$`)
+
+	inlineCodePattern = regexp.MustCompile("`([^`]+)`")
+	boldPattern       = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicPattern     = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_\s][^_]*)_\b`)
+	linkPattern       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+// renderMarkdown formats markdown for display in an ANSI terminal.
+func renderMarkdown(text string) string {
+	var b strings.Builder
+	var fence, lang string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, "`~") == "" {
+				fence = ""
+				continue
+			}
+			b.WriteString("  " + highlightCode(line, lang) + "\n")
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			lang = strings.ToLower(strings.TrimSpace(strings.TrimLeft(trimmed, "`~")))
+			if lang != "" {
+				b.WriteString(ansiDim + "  " + lang + ansiReset + "\n")
+			}
+			continue
+		}
+
+		switch {
+		case headingPattern.MatchString(line):
+			m := headingPattern.FindStringSubmatch(line)
+			style := ansiBold + ansiCyan
+			if len(m[1]) == 1 {
+				style += ansiUnderline
+			}
+			b.WriteString(style + renderInline(m[2], style) + ansiReset)
+		case rulePattern.MatchString(line):
+			b.WriteString(ansiDim + strings.Repeat("─", 40) + ansiReset)
+		case bulletPattern.MatchString(line):
+			m := bulletPattern.FindStringSubmatch(line)
+			b.WriteString(m[1] + ansiYellow + "•" + ansiReset + " " + renderInline(m[2], ""))
+		case numberedPattern.MatchString(line):
+			m := numberedPattern.FindStringSubmatch(line)
+			b.WriteString(m[1] + ansiYellow + m[2] + ansiReset + " " + renderInline(m[3], ""))
+		case strings.HasPrefix(trimmed, ">"):
+			quote := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+			b.WriteString(ansiDim + "│ " + ansiReset + ansiItalic + renderInline(quote, ansiItalic) + ansiReset)
+		default:
+			b.WriteString(renderInline(line, ""))
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// renderInline styles inline code, emphasis and links. outer is the style
+// of the surrounding text, restored after each styled span.
+func renderInline(text, outer string) string {
+	restore := ansiReset + outer
+
+	// Protect code spans from emphasis processing.
+	var spans []string
+	text = inlineCodePattern.ReplaceAllStringFunc(text, func(s string) string {
+		spans = append(spans, ansiMagenta+s[1:len(s)-1]+restore)
+		return "\x00" + string(rune('0'+len(spans)-1)) + "\x00"
+	})
+
+	text = linkPattern.ReplaceAllString(text, ansiBlue+"$1"+restore+" ("+ansiUnderline+"$2"+restore+")")
+	text = boldPattern.ReplaceAllString(text, ansiBold+"$1$2"+restore)
+	text = italicPattern.ReplaceAllString(text, ansiItalic+"$1$2"+restore)
+
+	for i, span := range spans {
+		text = strings.Replace(text, "\x00"+string(rune('0'+i))+"\x00", span, 1)
+	}
+	return text
+}
+
+// codeKeywords is a union of keywords of common languages, highlighted in code blocks.
+var codeKeywords = map[string]bool{}
+
+func init() {
+	for _, k := range strings.Fields(`
+		break case catch class const continue def default defer do elif else
+		enum export extends false finally fn for func function go if impl
+		import in interface let match mut nil none null package pub raise
+		return select self static struct switch this throw true try type
+		var while with yield async await from as lambda not and or is use
+		None True False`) {
+		codeKeywords[k] = true
+	}
+}
+
+// highlightCode applies simple keyword, string, number and comment
+// highlighting to one line of code.
+func highlightCode(line, lang string) string {
+	hashComments := map[string]bool{
+		"python": true, "py": true, "sh": true, "bash": true, "shell": true, "zsh": true,
+		"ruby": true, "rb": true, "yaml": true, "yml": true, "toml": true,
+	}[lang]
+
+	var b strings.Builder
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/' && !hashComments,
+			r == '#' && hashComments,
+			r == '-' && i+1 < len(runes) && runes[i+1] == '-' && lang == "sql":
+			b.WriteString(ansiDim + string(runes[i:]) + ansiReset)
+			return b.String()
+		case r == '"' || r == '\'' || r == '`':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(runes))
+			b.WriteString(ansiGreen + string(runes[i:end]) + ansiReset)
+			i = end
+		case unicode.IsDigit(r):
+			end := i
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.' || runes[end] == '_') {
+				end++
+			}
+			b.WriteString(ansiYellow + string(runes[i:end]) + ansiReset)
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			word := string(runes[i:end])
+			if codeKeywords[word] {
+				word = ansiRed + word + ansiReset
+			}
+			b.WriteString(word)
+			i = end
+		default:
+			b.WriteRune(r)
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/festeh/general"
+)
+
+// Report formats for --format.
+const (
+	reportHTML     = "html"
+	reportMarkdown = "markdown"
+)
+
+// reportLine is a result line written by `general batch`, `general eval
+// --output` or `general --output ndjson`. Lines without an index belong to
+// the first prompt.
+type reportLine struct {
+	Index     int            `json:"index"`
+	Case      string         `json:"case"`
+	Prompt    string         `json:"prompt"`
+	Provider  string         `json:"provider"`
+	Model     string         `json:"model"`
+	LatencyMS int64          `json:"latency_ms"`
+	Usage     *general.Usage `json:"usage"`
+	Content   string         `json:"content"`
+	Error     string         `json:"error"`
+	Passed    *bool          `json:"passed"`
+	Failures  []struct {
+		Assertion string `json:"assertion"`
+		Error     string `json:"error"`
+	} `json:"failures"`
+}
+
+// reportData is what a report shows.
+type reportData struct {
+	Title     string
+	Generated string
+	Judge     string
+	Targets   []*reportTarget
+	Items     []*reportItem
+}
+
+// reportTarget aggregates the results of one target.
+type reportTarget struct {
+	Label                          string
+	Requests, Errors               int
+	Passed, Failed                 int
+	PromptTokens, CompletionTokens int
+	cost                           float64
+	priced                         bool
+	totalLatency, maxLatency       time.Duration
+	scoreSum                       float64
+	scored                         int
+}
+
+// reportItem is one prompt with the output of every target.
+type reportItem struct {
+	Index   int
+	Name    string
+	Prompt  string
+	Outputs []*reportOutput
+}
+
+// reportOutput is the result of one target for one prompt.
+type reportOutput struct {
+	Target   string
+	Content  string
+	Error    string
+	Latency  time.Duration
+	Usage    *general.Usage
+	Cost     string
+	Passed   *bool
+	Failures []string
+	Scored   bool
+	Score    float64
+	Reason   string
+	// Diff is a unified diff against the first successful output of the
+	// prompt, that of the DiffBase target.
+	Diff     []reportDiffLine
+	DiffBase string
+}
+
+// outputKey identifies the output of a target for a prompt.
+type outputKey struct {
+	index  int
+	target string
+}
+
+// reportDiffLine is a line of a unified diff with its kind: "add", "del",
+// "hunk" or "".
+type reportDiffLine struct {
+	Kind string
+	Text string
+}
+
+// runReport implements `general report --input results.jsonl`, which turns
+// the JSONL results of a batch, eval or multi-target run into a static HTML
+// or Markdown report comparing the targets.
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	var inputs listFlag
+	fs.Var(&inputs, "input", "JSONL results of general batch, general eval --output or --output ndjson (can be repeated)")
+	output := fs.String("output", "", "File to write the report to (default: stdout)")
+	format := fs.String("format", "", "Report format: html or markdown (default: from the --output extension, else markdown)")
+	title := fs.String("title", "Comparison report", "Report title")
+	judge := fs.String("judge", "", "Score the outputs of each prompt with this provider:model as judge")
+	rubric := fs.String("rubric", "", "Rubric for --judge (default: correctness, completeness, relevance and clarity)")
+	fs.Parse(args)
+
+	if len(inputs) == 0 {
+		fail("usage: general report --input results.jsonl [--output report.html] [--judge provider:model]")
+	}
+	if *format == "" {
+		*format = reportMarkdown
+		if ext := strings.ToLower(filepath.Ext(*output)); ext == ".html" || ext == ".htm" {
+			*format = reportHTML
+		}
+	}
+	if *format != reportHTML && *format != reportMarkdown {
+		fail("unknown report format %q (available: html, markdown)", *format)
+	}
+
+	var lines []reportLine
+	for _, path := range inputs {
+		read, err := readReportLines(path)
+		if err != nil {
+			fail("%v", err)
+		}
+		lines = append(lines, read...)
+	}
+	data := buildReport(*title, lines)
+	if *judge != "" {
+		target, err := parseTarget(*judge)
+		if err != nil {
+			fail("invalid --judge: %v", err)
+		}
+		judgeReport(data, target, *rubric)
+	}
+
+	var out bytes.Buffer
+	var err error
+	if *format == reportHTML {
+		err = reportTemplate.Execute(&out, data)
+	} else {
+		writeMarkdownReport(&out, data)
+	}
+	if err != nil {
+		fail("failed to render report: %v", err)
+	}
+	if *output == "" {
+		os.Stdout.Write(out.Bytes())
+		return
+	}
+	if err := os.WriteFile(*output, out.Bytes(), 0o644); err != nil {
+		fail("failed to write report: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s report of %d prompt(s) to %s\n", *format, len(data.Items), *output)
+}
+
+// readReportLines reads the result lines of a JSONL file.
+func readReportLines(path string) ([]reportLine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open results: %w", err)
+	}
+	defer f.Close()
+	var lines []reportLine
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var line reportLine
+		if err := json.Unmarshal(text, &line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read results: %w", err)
+	}
+	return lines, nil
+}
+
+// buildReport groups lines by prompt and target, in first-seen order, and
+// aggregates the targets.
+func buildReport(title string, lines []reportLine) *reportData {
+	data := &reportData{Title: title, Generated: time.Now().Format(time.DateTime)}
+	targets := map[string]*reportTarget{}
+	items := map[int]*reportItem{}
+	var order []int
+	outputs := map[outputKey]*reportOutput{}
+
+	for _, line := range lines {
+		label := line.Provider + "/" + line.Model
+		t, ok := targets[label]
+		if !ok {
+			t = &reportTarget{Label: label}
+			targets[label] = t
+			data.Targets = append(data.Targets, t)
+		}
+		item, ok := items[line.Index]
+		if !ok {
+			item = &reportItem{Index: line.Index, Name: line.Case}
+			items[line.Index] = item
+			order = append(order, line.Index)
+		}
+		if item.Prompt == "" {
+			item.Prompt = line.Prompt
+		}
+
+		o := &reportOutput{
+			Target:  label,
+			Content: line.Content,
+			Error:   line.Error,
+			Latency: time.Duration(line.LatencyMS) * time.Millisecond,
+			Usage:   line.Usage,
+			Cost:    "-",
+			Passed:  line.Passed,
+		}
+		for _, f := range line.Failures {
+			o.Failures = append(o.Failures, f.Assertion+": "+f.Error)
+		}
+		outputs[outputKey{line.Index, label}] = o
+
+		t.Requests++
+		if o.Error != "" {
+			t.Errors++
+		}
+		if o.Passed != nil {
+			if *o.Passed {
+				t.Passed++
+			} else {
+				t.Failed++
+			}
+		}
+		t.totalLatency += o.Latency
+		t.maxLatency = max(t.maxLatency, o.Latency)
+		if o.Usage != nil {
+			t.PromptTokens += o.Usage.PromptTokens
+			t.CompletionTokens += o.Usage.CompletionTokens
+			if cost, found := catalogCost(line.Provider, line.Model, *o.Usage); found {
+				o.Cost = fmt.Sprintf("$%.5f", cost)
+				t.cost += cost
+				t.priced = true
+			}
+		}
+	}
+
+	for _, index := range order {
+		item := items[index]
+		if item.Name == "" {
+			item.Name = fmt.Sprintf("Prompt %d", index+1)
+		}
+		var base *reportOutput
+		for _, t := range data.Targets {
+			o, ok := outputs[outputKey{index, t.Label}]
+			if !ok {
+				continue
+			}
+			item.Outputs = append(item.Outputs, o)
+			switch {
+			case o.Error != "":
+			case base == nil:
+				base = o
+			default:
+				o.Diff = parseDiff(unifiedDiff(splitLines(base.Content), splitLines(o.Content)))
+				o.DiffBase = base.Target
+			}
+		}
+		data.Items = append(data.Items, item)
+	}
+	return data
+}
+
+// parseDiff splits a unified diff into classified lines.
+func parseDiff(diff string) []reportDiffLine {
+	var lines []reportDiffLine
+	for _, text := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		if text == "" {
+			continue
+		}
+		kind := ""
+		switch text[0] {
+		case '+':
+			kind = "add"
+		case '-':
+			kind = "del"
+		case '@':
+			kind = "hunk"
+		}
+		lines = append(lines, reportDiffLine{Kind: kind, Text: text})
+	}
+	return lines
+}
+
+// judgeReport asks judge to score the successful outputs of every prompt.
+// Prompts whose text the results do not include cannot be judged.
+func judgeReport(data *reportData, judge general.Target, rubric string) {
+	data.Judge = targetLabel(judge)
+	cmd := general.NewCommand(nil)
+	fmt.Fprintf(os.Stderr, "Judging %d prompt(s) with %s...\n", len(data.Items), data.Judge)
+	for _, item := range data.Items {
+		if item.Prompt == "" {
+			fmt.Fprintf(os.Stderr, "Skipping %s: the results do not include its prompt\n", item.Name)
+			continue
+		}
+		var judged []*reportOutput
+		var results []general.Result
+		for _, o := range item.Outputs {
+			if o.Error != "" {
+				continue
+			}
+			judged = append(judged, o)
+			results = append(results, general.Result{Response: general.ChatCompletionResponse{
+				Choices: []general.ChatCompletionChoice{{Message: general.AssistantMessage(o.Content)}},
+			}})
+		}
+		if len(results) == 0 {
+			continue
+		}
+		req := general.ChatCompletionRequest{Messages: []general.ChatCompletionMessage{general.UserMessage(item.Prompt)}}
+		judgement, err := cmd.Judge(context.Background(), judge, req, results, rubric)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Judging %s failed: %v\n", item.Name, err)
+			continue
+		}
+		for i, s := range judgement.Scores {
+			judged[i].Scored, judged[i].Score, judged[i].Reason = true, s.Score, s.Reason
+		}
+	}
+	for _, t := range data.Targets {
+		for _, item := range data.Items {
+			for _, o := range item.Outputs {
+				if o.Target == t.Label && o.Scored {
+					t.scoreSum += o.Score
+					t.scored++
+				}
+			}
+		}
+	}
+}
+
+// OK returns the number of successful requests of t.
+func (t *reportTarget) OK() int { return t.Requests - t.Errors }
+
+// Tokens formats the token usage of t.
+func (t *reportTarget) Tokens() string {
+	return fmt.Sprintf("%d→%d", t.PromptTokens, t.CompletionTokens)
+}
+
+// Cost formats the total cost of t, or "-" if no result was priced.
+func (t *reportTarget) Cost() string {
+	if !t.priced {
+		return "-"
+	}
+	return fmt.Sprintf("$%.5f", t.cost)
+}
+
+// MeanLatency formats the mean latency of the requests of t.
+func (t *reportTarget) MeanLatency() string {
+	if t.Requests == 0 {
+		return "-"
+	}
+	return (t.totalLatency / time.Duration(t.Requests)).Round(time.Millisecond).String()
+}
+
+// MaxLatency formats the highest latency of the requests of t.
+func (t *reportTarget) MaxLatency() string {
+	return t.maxLatency.Round(time.Millisecond).String()
+}
+
+// Pass formats the passed share of the assertion outcomes of t, or "-" if
+// its results carry none.
+func (t *reportTarget) Pass() string {
+	if t.Passed+t.Failed == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d", t.Passed, t.Passed+t.Failed)
+}
+
+// Score formats the mean judge score of t, or "-" if it was not judged.
+func (t *reportTarget) Score() string {
+	if t.scored == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", t.scoreSum/float64(t.scored))
+}
+
+// Meta summarizes the latency, tokens, cost, assertions and score of o.
+func (o *reportOutput) Meta() string {
+	parts := []string{o.Latency.Round(time.Millisecond).String()}
+	if o.Usage != nil {
+		parts = append(parts, fmt.Sprintf("%d→%d tokens", o.Usage.PromptTokens, o.Usage.CompletionTokens))
+	}
+	if o.Cost != "-" {
+		parts = append(parts, o.Cost)
+	}
+	if o.Passed != nil {
+		if *o.Passed {
+			parts = append(parts, "passed")
+		} else {
+			parts = append(parts, "FAILED")
+		}
+	}
+	if o.Scored {
+		parts = append(parts, fmt.Sprintf("score %.1f", o.Score))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// writeMarkdownReport writes data as Markdown: a summary table, then each
+// prompt with the outputs of the targets and their diffs.
+func writeMarkdownReport(w io.Writer, data *reportData) {
+	fmt.Fprintf(w, "# %s\n\n", data.Title)
+	fmt.Fprintf(w, "Generated %s from %d prompt(s) on %d target(s).", data.Generated, len(data.Items), len(data.Targets))
+	if data.Judge != "" {
+		fmt.Fprintf(w, " Judged by %s.", data.Judge)
+	}
+	fmt.Fprint(w, "\n\n## Summary\n\n")
+	fmt.Fprintln(w, "| Target | OK | Errors | Passed | Tokens | Cost | Mean latency | Max latency | Score |")
+	fmt.Fprintln(w, "|---|---:|---:|---:|---:|---:|---:|---:|---:|")
+	for _, t := range data.Targets {
+		fmt.Fprintf(w, "| %s | %d/%d | %d | %s | %s | %s | %s | %s | %s |\n",
+			t.Label, t.OK(), t.Requests, t.Errors, t.Pass(), t.Tokens(), t.Cost(), t.MeanLatency(), t.MaxLatency(), t.Score())
+	}
+
+	for _, item := range data.Items {
+		fmt.Fprintf(w, "\n## %s\n\n", item.Name)
+		if item.Prompt != "" {
+			fmt.Fprintf(w, "%s\n", markdownFence(item.Prompt, "text"))
+		}
+		for _, o := range item.Outputs {
+			fmt.Fprintf(w, "\n### %s\n\n_%s_\n\n", o.Target, o.Meta())
+			if o.Error != "" {
+				fmt.Fprintf(w, "**Error:** %s\n", o.Error)
+				continue
+			}
+			fmt.Fprintf(w, "%s\n", markdownFence(o.Content, ""))
+			for _, f := range o.Failures {
+				fmt.Fprintf(w, "\n- ❌ %s", f)
+			}
+			if len(o.Failures) > 0 {
+				fmt.Fprintln(w)
+			}
+			if o.Reason != "" {
+				fmt.Fprintf(w, "\n> Judge: %s\n", o.Reason)
+			}
+			if o.Diff != nil {
+				var diff strings.Builder
+				for _, l := range o.Diff {
+					diff.WriteString(l.Text + "\n")
+				}
+				fmt.Fprintf(w, "\n<details>\n<summary>Diff against %s</summary>\n\n%s\n\n</details>\n",
+					o.DiffBase, markdownFence(strings.TrimRight(diff.String(), "\n"), "diff"))
+			}
+		}
+	}
+}
+
+// markdownFence wraps text in a code block whose fence is longer than any
+// backtick run inside it.
+func markdownFence(text, lang string) string {
+	ticks := "```"
+	for strings.Contains(text, ticks) {
+		ticks += "`"
+	}
+	return ticks + lang + "\n" + text + "\n" + ticks
+}
+
+// reportTemplate renders a reportData as a self-contained HTML page, with
+// the outputs of each prompt side by side.
+var reportTemplate = htmltemplate.Must(htmltemplate.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3rem 0.6rem; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.outputs { display: grid; grid-template-columns: repeat(auto-fit, minmax(22rem, 1fr)); gap: 1rem; }
+.output { border: 1px solid #ddd; border-radius: 4px; padding: 0.6rem; overflow: auto; }
+.output h3 { margin: 0 0 0.3rem; font-size: 1rem; }
+.meta { color: #666; font-size: 0.85rem; }
+pre { white-space: pre-wrap; word-break: break-word; background: #f7f7f7; padding: 0.5rem; }
+.error { color: #b00; }
+.failed { color: #b00; margin: 0.2rem 0; }
+.add { background: #e6ffec; }
+.del { background: #ffebe9; }
+.hunk { color: #888; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated {{.Generated}} from {{len .Items}} prompt(s) on {{len .Targets}} target(s).{{if .Judge}} Judged by {{.Judge}}.{{end}}</p>
+<h2>Summary</h2>
+<table>
+<tr><th>Target</th><th>OK</th><th>Errors</th><th>Passed</th><th>Tokens</th><th>Cost</th><th>Mean latency</th><th>Max latency</th><th>Score</th></tr>
+{{range .Targets}}<tr><td>{{.Label}}</td><td>{{.OK}}/{{.Requests}}</td><td>{{.Errors}}</td><td>{{.Pass}}</td><td>{{.Tokens}}</td><td>{{.Cost}}</td><td>{{.MeanLatency}}</td><td>{{.MaxLatency}}</td><td>{{.Score}}</td></tr>
+{{end}}</table>
+{{range .Items}}
+<h2>{{.Name}}</h2>
+{{if .Prompt}}<pre>{{.Prompt}}</pre>{{end}}
+<div class="outputs">
+{{range .Outputs}}<div class="output">
+<h3>{{.Target}}</h3>
+<div class="meta">{{.Meta}}</div>
+{{if .Error}}<p class="error">{{.Error}}</p>{{else}}<pre>{{.Content}}</pre>{{end}}
+{{range .Failures}}<p class="failed">❌ {{.}}</p>{{end}}
+{{if .Reason}}<p class="meta">Judge: {{.Reason}}</p>{{end}}
+{{if .Diff}}<details><summary>Diff against {{.DiffBase}}</summary><pre>{{range .Diff}}<span class="{{.Kind}}">{{.Text}}</span>
+{{end}}</pre></details>{{end}}
+</div>
+{{end}}</div>
+{{end}}
+</body>
+</html>
+`))
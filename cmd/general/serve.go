@@ -0,0 +1,387 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/festeh/general"
+)
+
+// defaultRoute is the name of the route serving models no rule matches.
+const defaultRoute = "default"
+
+// runServe implements `general serve`, which runs an OpenAI-compatible
+// gateway in front of the targets, so that existing clients can point
+// their base URL at it and get the race, fallback or balance policy.
+// Requests are routed by model name with the [routes] of the config file.
+// With --api-key or --keys-file, clients must authenticate. Changes to
+// the config and key files are applied as they are saved, or on SIGHUP,
+// without dropping requests in flight. On SIGTERM or interrupt it
+// stops accepting requests and lets those in flight finish, up to
+// --drain-timeout, before closing the history.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags := addRequestFlags(fs)
+	addr := fs.String("addr", "127.0.0.1:8080", "Address to listen on")
+	policyName := fs.String("policy", "fallback", "How requests are spread over the targets: fallback, race or balance")
+	weights := fs.String("weights", "", "Comma-separated weights of the targets for --policy balance, e.g. 3,1")
+	var apiKeys listFlag
+	fs.Var(&apiKeys, "api-key", "API key clients must present (can be repeated)")
+	keysFile := fs.String("keys-file", "", "TOML file of named API keys with optional rate limits")
+	cacheTTL := fs.Duration("cache-ttl", 0, "Cache the responses of the default route for this long, e.g. 10m")
+	watch := fs.Duration("watch", 2*time.Second, "How often to check the config and keys files for changes (0 to reload on SIGHUP only)")
+	drainTimeout := fs.Duration("drain-timeout", 30*time.Second, "How long requests in flight may run on after SIGTERM")
+	fs.Parse(args)
+
+	policy, err := general.ParseGatewayPolicy(*policyName)
+	if err != nil {
+		fail("%v", err)
+	}
+	parsedWeights, err := parseWeights(*weights)
+	if err != nil {
+		fail("%v", err)
+	}
+	// Flag targets form the default route; without them it comes from the
+	// config file, which may leave it to the [routes] alone.
+	var targets []general.Target
+	if len(flags.targets) > 0 || len(cfg.Targets) > 0 || len(cfg.Routes) == 0 {
+		targets = flags.resolveTargets()
+	} else {
+		flags.registerAliases()
+	}
+	defaults := routeDefaults{policy: policy, weights: parsedWeights, cacheTTL: *cacheTTL}
+	def, rules, err := serveRoutes(flags.targets, targets, defaults)
+	if err != nil {
+		fail("%v", err)
+	}
+	keys, err := gatewayKeys(apiKeys, *keysFile)
+	if err != nil {
+		fail("%v", err)
+	}
+	cmd := flags.command(targets)
+	gateway := general.NewGateway(cmd, def,
+		general.WithGatewayRules(rules...),
+		general.WithGatewayKeys(keys...),
+		general.WithGatewayLog(logGatewayRequest),
+	)
+	reloader := &reloader{gateway: gateway, flags: flags, defaults: defaults, apiKeys: apiKeys, keysFile: *keysFile, keys: keys}
+	go onHangup(reloader.reload)
+	if *watch > 0 {
+		watched := []string{configPath()}
+		if *keysFile != "" {
+			watched = append(watched, expandHome(*keysFile))
+		}
+		go watchFiles(*watch, reloader.reload, watched...)
+	}
+
+	fmt.Fprintf(os.Stderr, "Serving %s on http://%s/v1\n", describeRoutes(def, rules), *addr)
+	if len(keys) == 0 {
+		fmt.Fprintln(os.Stderr, "Warning: no --api-key or --keys-file, so anyone who can reach the gateway can use it")
+	}
+	// Requests run under base, so that those outlasting the drain timeout
+	// can be cancelled, upstream calls included.
+	base, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           gateway,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+	stop, cancelStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelStop()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe() }()
+	select {
+	case err := <-serveErr:
+		fail("%v", err)
+	case <-stop.Done():
+	}
+	cancelStop()
+
+	fmt.Fprintf(os.Stderr, "Shutting down, draining %d request(s) for up to %s...\n", gateway.InFlight(), *drainTimeout)
+	shutdown(server, gateway, *drainTimeout, cancelRequests)
+	flags.close()
+	fmt.Fprintln(os.Stderr, "Stopped")
+}
+
+// shutdown stops server accepting connections and waits for the requests
+// of gateway to finish. Those still running after timeout are cancelled,
+// which ends their streams and upstream calls, and given a moment to
+// record their results.
+func shutdown(server *http.Server, gateway *general.Gateway, timeout time.Duration, cancelRequests context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	go server.Shutdown(ctx)
+	if err := gateway.Drain(ctx); err == nil {
+		server.Shutdown(ctx)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Cancelling %d request(s) still running after %s\n", gateway.InFlight(), timeout)
+	cancelRequests()
+	server.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := gateway.Drain(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %d request(s) did not stop\n", gateway.InFlight())
+	}
+}
+
+// routeDefaults configures the default route from the flags of `general
+// serve`.
+type routeDefaults struct {
+	policy   general.GatewayPolicy
+	weights  []float64
+	cacheTTL time.Duration
+}
+
+// serveRoutes builds the default route and the rules of the [routes] of
+// the config file. The default route is made of the flag targets if any
+// were given, else the route named "default", else targets.
+func serveRoutes(flagTargets []string, targets []general.Target, defaults routeDefaults) (*general.GatewayRoute, []general.GatewayRule, error) {
+	var def *general.GatewayRoute
+	if len(targets) > 0 {
+		weighted, err := weightTargets(targets, defaults.weights)
+		if err != nil {
+			return nil, nil, err
+		}
+		def = general.NewGatewayRoute(defaultRoute, defaults.policy, weighted...)
+		if defaults.cacheTTL > 0 {
+			def.Cache = general.NewMemoryCache(defaults.cacheTTL)
+		}
+	}
+
+	var rules []general.GatewayRule
+	for name, rc := range cfg.Routes {
+		route, err := rc.route(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if name == defaultRoute {
+			if len(flagTargets) == 0 {
+				def = route
+			}
+			continue
+		}
+		if len(rc.Models) == 0 && rc.Pattern == "" {
+			return nil, nil, fmt.Errorf("route %q needs models or a pattern", name)
+		}
+		for _, model := range rc.Models {
+			rules = append(rules, general.GatewayRule{Model: model, Route: route})
+		}
+		if rc.Pattern != "" {
+			pattern, err := regexp.Compile(rc.Pattern)
+			if err != nil {
+				return nil, nil, fmt.Errorf("route %q: invalid pattern: %w", name, err)
+			}
+			rules = append(rules, general.GatewayRule{Pattern: pattern, Route: route})
+		}
+	}
+	if def == nil && len(rules) == 0 {
+		return nil, nil, fmt.Errorf("no targets or routes configured")
+	}
+	sortRules(rules)
+	return def, rules, nil
+}
+
+// route builds the gateway route configured by rc.
+func (rc routeConfig) route(name string) (*general.GatewayRoute, error) {
+	if len(rc.Targets) == 0 {
+		return nil, fmt.Errorf("route %q has no targets", name)
+	}
+	targets, err := parseTargets(rc.Targets)
+	if err != nil {
+		return nil, fmt.Errorf("route %q: %w", name, err)
+	}
+	policy, err := general.ParseGatewayPolicy(cmp.Or(rc.Policy, "fallback"))
+	if err != nil {
+		return nil, fmt.Errorf("route %q: %w", name, err)
+	}
+	weighted, err := weightTargets(targets, rc.Weights)
+	if err != nil {
+		return nil, fmt.Errorf("route %q: %w", name, err)
+	}
+	route := general.NewGatewayRoute(name, policy, weighted...)
+	if rc.CacheTTL != "" {
+		ttl, err := time.ParseDuration(rc.CacheTTL)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("route %q: invalid cache_ttl %q", name, rc.CacheTTL)
+		}
+		route.Cache = general.NewMemoryCache(ttl)
+	}
+	return route, nil
+}
+
+// sortRules orders rules so that the most specific match wins: exact model
+// names, then prefixes from longest to shortest, then patterns by route
+// name.
+func sortRules(rules []general.GatewayRule) {
+	rank := func(r general.GatewayRule) int {
+		switch {
+		case r.Model == "":
+			return 2
+		case strings.HasSuffix(r.Model, "*"):
+			return 1
+		default:
+			return 0
+		}
+	}
+	slices.SortStableFunc(rules, func(a, b general.GatewayRule) int {
+		return cmp.Or(
+			cmp.Compare(rank(a), rank(b)),
+			cmp.Compare(len(b.Model), len(a.Model)),
+			cmp.Compare(a.Model, b.Model),
+			cmp.Compare(a.Route.Name, b.Route.Name),
+		)
+	})
+}
+
+// keyConfig is a named API key in the --keys-file of `general serve`,
+// with optional rate limits and daily or monthly budgets in USD or tokens:
+//
+//	[alice]
+//	key = "gw-4f0c..."
+//	rps = 2
+//	burst = 5
+//	daily_cost = 5
+//	monthly_tokens = 2000000
+type keyConfig struct {
+	Key           string  `json:"key"`
+	RPS           float64 `json:"rps"`
+	Burst         int     `json:"burst"`
+	DailyCost     float64 `json:"daily_cost"`
+	MonthlyCost   float64 `json:"monthly_cost"`
+	DailyTokens   int     `json:"daily_tokens"`
+	MonthlyTokens int     `json:"monthly_tokens"`
+}
+
+// gatewayKeys returns the keys given by --api-key, named key1, key2 and so
+// on, and those of the key file, if any.
+func gatewayKeys(static []string, path string) ([]general.GatewayKey, error) {
+	var keys []general.GatewayKey
+	for i, key := range static {
+		keys = append(keys, general.GatewayKey{Key: key, Name: fmt.Sprintf("key%d", i+1)})
+	}
+	if path == "" {
+		return keys, nil
+	}
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys file: %w", err)
+	}
+	values, err := parseTOML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid keys file %s: %w", path, err)
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keys file %s: %w", path, err)
+	}
+	var named map[string]keyConfig
+	if err := json.Unmarshal(raw, &named); err != nil {
+		return nil, fmt.Errorf("invalid keys file %s: %w", path, err)
+	}
+	names := slices.Sorted(maps.Keys(named))
+	for _, name := range names {
+		k := named[name]
+		if k.Key == "" {
+			return nil, fmt.Errorf("invalid keys file %s: %q has no key", path, name)
+		}
+		keys = append(keys, general.GatewayKey{
+			Key:   k.Key,
+			Name:  name,
+			RPS:   k.RPS,
+			Burst: k.Burst,
+			Budget: general.GatewayBudget{
+				DailyCost:     k.DailyCost,
+				MonthlyCost:   k.MonthlyCost,
+				DailyTokens:   k.DailyTokens,
+				MonthlyTokens: k.MonthlyTokens,
+			},
+		})
+	}
+	return keys, nil
+}
+
+// describeRoutes summarizes the routing table for the log.
+func describeRoutes(def *general.GatewayRoute, rules []general.GatewayRule) string {
+	var parts []string
+	for _, r := range rules {
+		match := r.Model
+		if match == "" {
+			match = "/" + r.Pattern.String() + "/"
+		}
+		parts = append(parts, fmt.Sprintf("%s -> %s", match, r.Route.Name))
+	}
+	if def != nil {
+		parts = append(parts, fmt.Sprintf("* -> %s (%d target(s), %s)", def.Name, len(def.Targets()), def.Policy))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseWeights parses comma-separated target weights.
+func parseWeights(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var weights []float64
+	for _, p := range strings.Split(s, ",") {
+		w, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight %q", p)
+		}
+		weights = append(weights, w)
+	}
+	return weights, nil
+}
+
+// weightTargets pairs targets with weights, which default to 1 each.
+func weightTargets(targets []general.Target, weights []float64) ([]general.WeightedTarget, error) {
+	if len(weights) > 0 && len(weights) != len(targets) {
+		return nil, fmt.Errorf("got %d weights for %d targets", len(weights), len(targets))
+	}
+	weighted := make([]general.WeightedTarget, len(targets))
+	for i, t := range targets {
+		weighted[i] = general.WeightedTarget{Target: t, Weight: 1}
+		if len(weights) > 0 {
+			weighted[i].Weight = weights[i]
+		}
+	}
+	return weighted, nil
+}
+
+// logGatewayRequest prints an access log line for rec to stderr.
+func logGatewayRequest(rec general.GatewayRecord) {
+	fields := []string{
+		time.Now().Format(time.TimeOnly),
+		cmp.Or(rec.Client, "-"),
+		strconv.Itoa(rec.Status),
+		cmp.Or(rec.Model, "-") + " -> " + cmp.Or(rec.Result.Target.Model, "-"),
+		rec.Duration.Round(time.Millisecond).String(),
+	}
+	if usage := rec.Result.Response.Usage; usage != nil {
+		fields = append(fields, fmt.Sprintf("%d+%d tokens", usage.PromptTokens, usage.CompletionTokens))
+	}
+	if rec.Stream {
+		fields = append(fields, "stream")
+	}
+	if rec.Result.Response.Cached {
+		fields = append(fields, "cached")
+	}
+	fmt.Fprintln(os.Stderr, strings.Join(fields, " "))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/festeh/general"
+)
+
+// dataDir returns $XDG_DATA_HOME/general, where the CLI keeps its data.
+func dataDir() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			fail("cannot locate data directory: %v", err)
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "general")
+}
+
+// sessionStore opens the chat session store under $XDG_DATA_HOME/general/sessions.
+func sessionStore() *general.SessionStore {
+	store, err := general.NewSessionStore(filepath.Join(dataDir(), "sessions"))
+	if err != nil {
+		fail("%v", err)
+	}
+	return store
+}
+
+// runSessions implements `general sessions list|delete <id>`.
+func runSessions(args []string) {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	store := sessionStore()
+
+	switch args[0] {
+	case "list":
+		sessions, err := store.List()
+		if err != nil {
+			fail("%v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, s := range sessions {
+			model := ""
+			if len(s.Targets) > 0 {
+				model = s.Targets[0].Provider + ":" + s.Targets[0].Model
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d msgs\t%s\n",
+				s.ID, s.Updated.Format(time.DateTime), model, len(s.Messages), s.Title())
+		}
+		w.Flush()
+	case "delete":
+		if len(args) != 2 {
+			fail("usage: general sessions delete <id>")
+		}
+		if err := store.Delete(args[1]); err != nil {
+			fail("%v", err)
+		}
+	default:
+		fail("unknown sessions action %q, expected list or delete", args[0])
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+import "os"
+
+// terminalSize is not supported on this platform; callers fall back to defaults.
+func terminalSize(f *os.File) (cols, rows int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// terminalSize returns the columns and rows of the terminal on f.
+func terminalSize(f *os.File) (cols, rows int, ok bool) {
+	var ws struct{ rows, cols, x, y uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.cols == 0 {
+		return 0, 0, false
+	}
+	return int(ws.cols), int(ws.rows), true
+}
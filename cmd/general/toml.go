@@ -0,0 +1,13 @@
+package main
+
+import "github.com/BurntSushi/toml"
+
+// parseTOML decodes a TOML document into generic values, which the config
+// and keys files then map onto their structs through the JSON tags.
+func parseTOML(data string) (map[string]any, error) {
+	values := map[string]any{}
+	if _, err := toml.Decode(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
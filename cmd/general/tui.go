@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/festeh/general"
+)
+
+const (
+	tuiRefresh    = 50 * time.Millisecond
+	tuiHeaderRows = 3
+	tuiGap        = " │ "
+)
+
+// pane is the live state of one target in the TUI.
+type pane struct {
+	title   string
+	content strings.Builder
+	start   time.Time
+	first   time.Duration
+	result  *general.Result
+}
+
+func (p *pane) status() string {
+	switch {
+	case p.result == nil && p.first == 0:
+		return fmt.Sprintf("waiting %s", time.Since(p.start).Round(100*time.Millisecond))
+	case p.result == nil:
+		return fmt.Sprintf("streaming %s · ttft %s · %d chars",
+			time.Since(p.start).Round(100*time.Millisecond), p.first.Round(time.Millisecond), p.content.Len())
+	case p.result.Error != nil:
+		return "error " + p.result.Duration.Round(time.Millisecond).String()
+	}
+
+	status := "done " + p.result.Duration.Round(time.Millisecond).String()
+	if usage := p.result.Response.Usage; usage != nil {
+		status += fmt.Sprintf(" · %d→%d tok", usage.PromptTokens, usage.CompletionTokens)
+		if tps := p.result.TokensPerSecond(); tps > 0 {
+			status += fmt.Sprintf(" · %.0f tok/s", tps)
+		}
+	}
+	return status
+}
+
+func (p *pane) text() string {
+	if p.result != nil && p.result.Error != nil {
+		return p.result.Error.Error()
+	}
+	return p.content.String()
+}
+
+// runTUI streams req to every target, drawing one pane per target side by
+// side on the alternate screen. The final results are printed normally once
+// all targets are done, so they remain in the scrollback, and returned.
+func runTUI(cmd *general.Command, targets []general.Target, req general.ChatCompletionRequest, out printer) []general.Result {
+	panes := make([]*pane, len(targets))
+	start := time.Now()
+	for i, t := range targets {
+		panes[i] = &pane{title: providerName(t.Provider) + "/" + t.Model, start: start}
+	}
+
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	restore := func() { fmt.Print("\x1b[?25h\x1b[?1049l") }
+
+	events := cmd.ExecuteStream(req)
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+
+	var results []general.Result
+	for done := false; !done; {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				done = true
+				break
+			}
+			p := panes[ev.Index]
+			if ev.Delta != "" {
+				if p.first == 0 {
+					p.first = time.Since(p.start)
+				}
+				p.content.WriteString(ev.Delta)
+			}
+			if ev.Result != nil {
+				p.result = ev.Result
+				results = append(results, *ev.Result)
+			}
+		case <-ticker.C:
+			drawPanes(panes)
+		}
+	}
+	drawPanes(panes)
+	restore()
+
+	for _, result := range results {
+		out.print(result, time.Since(start))
+	}
+	out.flush()
+	return results
+}
+
+// drawPanes redraws the screen with the panes in equal-width columns.
+func drawPanes(panes []*pane) {
+	cols, rows, ok := terminalSize(os.Stdout)
+	if !ok {
+		cols, rows = 80, 24
+	}
+	width := max((cols-len([]rune(tuiGap))*(len(panes)-1))/len(panes), 10)
+	height := max(rows-tuiHeaderRows, 1)
+
+	columns := make([][]string, len(panes))
+	for i, p := range panes {
+		body := wrapLines(p.text(), width)
+		if len(body) > height {
+			body = body[len(body)-height:]
+		}
+		columns[i] = append([]string{
+			ansiBold + fit(p.title, width) + ansiReset,
+			ansiDim + fit(p.status(), width) + ansiReset,
+			strings.Repeat("─", width),
+		}, body...)
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	for row := range tuiHeaderRows + height {
+		for i, column := range columns {
+			if i > 0 {
+				b.WriteString(tuiGap)
+			}
+			line := ""
+			if row < len(column) {
+				line = column[row]
+			}
+			b.WriteString(line)
+			if pad := width - visibleWidth(line); pad > 0 && i < len(columns)-1 {
+				b.WriteString(strings.Repeat(" ", pad))
+			}
+		}
+		if row < tuiHeaderRows+height-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	fmt.Print(b.String())
+}
+
+// wrapLines splits text into lines of at most width runes, dropping control
+// characters that would corrupt the layout.
+func wrapLines(text string, width int) []string {
+	text = strings.ReplaceAll(text, "\t", "    ")
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, line))
+		for len(runes) > width {
+			lines = append(lines, string(runes[:width]))
+			runes = runes[width:]
+		}
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
+
+// fit truncates s to width runes.
+func fit(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// visibleWidth returns the number of runes in s, ignoring ANSI escape sequences.
+func visibleWidth(s string) int {
+	n, escape := 0, false
+	for _, r := range s {
+		switch {
+		case escape:
+			escape = r != 'm'
+		case r == '\x1b':
+			escape = true
+		default:
+			n++
+		}
+	}
+	return n
+}
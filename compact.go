@@ -0,0 +1,143 @@
+package general
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultCompactionKeep  = 2
+	defaultCompactionShare = 0.75
+
+	// DefaultCompactionPrompt asks for a summary of the older turns of a
+	// conversation; the transcript follows it.
+	DefaultCompactionPrompt = "Summarize the following conversation so it can continue without it. " +
+		"Keep facts, decisions, open questions and the results of tool calls; drop pleasantries."
+
+	// compactionPrefix starts the message that replaces summarized turns.
+	compactionPrefix = "Summary of the earlier conversation:\n\n"
+)
+
+// Compaction configures the summarization of older conversation turns.
+type Compaction struct {
+	// Target writes the summaries; a cheap, fast model is a good choice. It
+	// defaults to the target the conversation is sent to.
+	Target Target
+	// Threshold is the token count above which a conversation is compacted.
+	// It defaults to three quarters of the context window of the target the
+	// conversation is sent to; without a known window nothing is compacted.
+	Threshold int
+	// KeepTurns is the number of latest turns kept verbatim. It defaults to 2.
+	KeepTurns int
+	// Prompt is the summarization instruction. It defaults to
+	// DefaultCompactionPrompt.
+	Prompt string
+}
+
+// WithCompaction makes Send and Retry compact conversations that exceed
+// the threshold of cfg before sending them.
+func WithCompaction(cfg Compaction) Option {
+	return func(c *Command) { c.compaction = &cfg }
+}
+
+// Compact replaces the older turns of conv with a summary written by
+// cfg.Target when conv exceeds the threshold for target, the target it is
+// about to be sent to. The system prompt and the latest cfg.KeepTurns turns
+// are kept, the first of them starting with the summary. A turn runs from a user message to the next one, so tool calls
+// are summarized or kept together with their results. Compact reports
+// whether it changed conv.
+func (c *Command) Compact(ctx context.Context, target Target, conv *Conversation, cfg Compaction) (bool, error) {
+	if cfg.Target.Model == "" {
+		cfg.Target = target
+	}
+	if cfg.KeepTurns <= 0 {
+		cfg.KeepTurns = defaultCompactionKeep
+	}
+	if cfg.Prompt == "" {
+		cfg.Prompt = DefaultCompactionPrompt
+	}
+	resolved, err := DefaultAliases.ResolveTarget(target)
+	if err != nil {
+		return false, err
+	}
+	if cfg.Threshold <= 0 {
+		details, ok := ModelInfo(resolved.Provider.Name(), resolved.Model)
+		if !ok || details.ContextWindow == 0 {
+			return false, nil
+		}
+		cfg.Threshold = int(float64(details.ContextWindow) * defaultCompactionShare)
+	}
+	if CountTokens(resolved.Model, conv.Messages) <= cfg.Threshold {
+		return false, nil
+	}
+
+	head := 0
+	if len(conv.Messages) > 0 && conv.Messages[0].Role == RoleSystem {
+		head = 1
+	}
+	cut := conv.keptTurnsStart(head, cfg.KeepTurns)
+	if cut <= head {
+		return false, nil
+	}
+
+	req := ChatCompletionRequest{Messages: []ChatCompletionMessage{
+		UserMessage(cfg.Prompt + "\n\n" + transcript(conv.Messages[head:cut])),
+	}}
+	resp, err := c.executeTarget(ctx, cfg.Target, req)
+	if err != nil {
+		return false, fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return false, fmt.Errorf("failed to summarize conversation: %w", ErrEmptyResponse)
+	}
+	summary := compactionPrefix + resp.Choices[0].Message.Text()
+
+	messages := append(conv.Messages[:head:head], conv.Messages[cut:]...)
+	if cut == len(conv.Messages) {
+		messages = append(messages, UserMessage(summary))
+	} else {
+		messages[head] = withSummary(messages[head], summary)
+	}
+	conv.Messages = messages
+	return true, nil
+}
+
+// withSummary returns the user message m preceded by summary. Merging the
+// summary into the first kept turn rather than adding a message of its own
+// keeps user and assistant turns alternating, which some providers require.
+func withSummary(m ChatCompletionMessage, summary string) ChatCompletionMessage {
+	if len(m.Parts) > 0 {
+		m.Parts = append([]ContentPart{TextPart(summary)}, m.Parts...)
+		return m
+	}
+	m.Content = summary + "\n\n" + m.Content
+	return m
+}
+
+// keptTurnsStart returns the index of the first message of the latest n
+// turns after head.
+func (c *Conversation) keptTurnsStart(head, n int) int {
+	start := len(c.Messages)
+	for i := len(c.Messages) - 1; i >= head && n > 0; i-- {
+		if c.Messages[i].Role == RoleUser {
+			start = i
+			n--
+		}
+	}
+	return start
+}
+
+// transcript renders messages as plain text for summarization.
+func transcript(messages []ChatCompletionMessage) string {
+	var b strings.Builder
+	for _, m := range messages {
+		if text := m.Text(); text != "" {
+			fmt.Fprintf(&b, "%s: %s\n\n", m.Role, text)
+		}
+		for _, call := range m.ToolCalls {
+			fmt.Fprintf(&b, "%s called %s(%s)\n\n", m.Role, call.Function.Name, call.Function.Arguments)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
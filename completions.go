@@ -0,0 +1,96 @@
+package general
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// textCompletionRequest is the body of a legacy /completions request.
+type textCompletionRequest struct {
+	Model       string         `json:"model"`
+	Prompt      string         `json:"prompt"`
+	Suffix      string         `json:"suffix,omitempty"`
+	MaxTokens   int            `json:"max_tokens,omitempty"`
+	Temperature float64        `json:"temperature,omitempty"`
+	TopP        float64        `json:"top_p,omitempty"`
+	Seed        *int           `json:"seed,omitempty"`
+	Stop        []string       `json:"stop,omitempty"`
+	LogitBias   map[string]int `json:"logit_bias,omitempty"`
+	N           int            `json:"n,omitempty"`
+}
+
+// textCompletionResponse is the body of a legacy /completions response.
+type textCompletionResponse struct {
+	Choices []struct {
+		Text         string `json:"text"`
+		FinishReason string `json:"finish_reason,omitempty"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// marshalTextCompletion converts a chat request into a legacy completion body.
+// req.Prompt is sent verbatim when set; otherwise the messages are flattened.
+func marshalTextCompletion(req ChatCompletionRequest) ([]byte, error) {
+	prompt := req.Prompt
+	if prompt == "" {
+		prompt = promptFromMessages(req.Messages)
+	}
+	return json.Marshal(textCompletionRequest{
+		Model:       req.Model,
+		Prompt:      prompt,
+		Suffix:      req.Suffix,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Seed:        req.Seed,
+		Stop:        req.Stop,
+		LogitBias:   req.LogitBias,
+		N:           req.N,
+	})
+}
+
+// decodeTextCompletion reads a legacy completion response as a chat response
+// with one assistant message per choice.
+func decodeTextCompletion(body io.Reader) (ChatCompletionResponse, error) {
+	var raw textCompletionResponse
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return ChatCompletionResponse{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	response := ChatCompletionResponse{Usage: raw.Usage}
+	for _, choice := range raw.Choices {
+		response.Choices = append(response.Choices, ChatCompletionChoice{
+			Message:      AssistantMessage(choice.Text),
+			FinishReason: choice.FinishReason,
+		})
+	}
+	return response, nil
+}
+
+// promptFromMessages flattens a conversation into a plain-text prompt.
+// A lone user message is passed through unchanged so base models see the raw text.
+func promptFromMessages(messages []ChatCompletionMessage) string {
+	if len(messages) == 1 && messages[0].Role == RoleUser {
+		return messages[0].Text()
+	}
+
+	var b strings.Builder
+	for _, m := range messages {
+		text := m.Text()
+		if text == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s\n\n", roleLabel(m.Role), text)
+	}
+	b.WriteString(roleLabel(RoleAssistant) + ":")
+	return b.String()
+}
+
+func roleLabel(role Role) string {
+	if role == "" {
+		return ""
+	}
+	return strings.ToUpper(string(role[:1])) + string(role[1:])
+}
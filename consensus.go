@@ -0,0 +1,211 @@
+package general
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Equivalence decides which answers agree. Group returns, for each answer,
+// the index of the group of answers it agrees with; groups are numbered
+// from 0 in order of first appearance.
+type Equivalence interface {
+	Group(ctx context.Context, answers []string) ([]int, error)
+}
+
+// EquivalenceFunc adapts a function to Equivalence.
+type EquivalenceFunc func(ctx context.Context, answers []string) ([]int, error)
+
+// Group calls f.
+func (f EquivalenceFunc) Group(ctx context.Context, answers []string) ([]int, error) {
+	return f(ctx, answers)
+}
+
+// ExactMatch treats answers as equal if they match after trimming,
+// collapsing whitespace, folding case and dropping trailing punctuation.
+func ExactMatch() Equivalence {
+	return EquivalenceFunc(func(_ context.Context, answers []string) ([]int, error) {
+		keys := make([]string, len(answers))
+		for i, a := range answers {
+			keys[i] = normalizeAnswer(a)
+		}
+		return groupBy(len(answers), func(i, j int) bool { return keys[i] == keys[j] }), nil
+	})
+}
+
+// normalizeAnswer returns the comparable form of an answer for ExactMatch.
+func normalizeAnswer(answer string) string {
+	normalized := strings.ToLower(strings.Join(strings.Fields(answer), " "))
+	return strings.TrimRight(normalized, ".!?;:")
+}
+
+// numberPattern matches a decimal number, optionally with thousands
+// separators and an exponent.
+var numberPattern = regexp.MustCompile(`-?\d[\d,]*(?:\.\d+)?(?:[eE][-+]?\d+)?`)
+
+// NumericMatch treats answers as equal if the last numbers in them differ
+// by at most tolerance, so "The answer is 42." agrees with "42.0". Answers
+// without a number agree with none.
+func NumericMatch(tolerance float64) Equivalence {
+	return EquivalenceFunc(func(_ context.Context, answers []string) ([]int, error) {
+		values := make([]float64, len(answers))
+		for i, a := range answers {
+			values[i] = lastNumber(a)
+		}
+		return groupBy(len(answers), func(i, j int) bool {
+			return !math.IsNaN(values[i]) && !math.IsNaN(values[j]) && math.Abs(values[i]-values[j]) <= tolerance
+		}), nil
+	})
+}
+
+// lastNumber returns the last number in text, or NaN if there is none.
+func lastNumber(text string) float64 {
+	matches := numberPattern.FindAllString(text, -1)
+	if len(matches) == 0 {
+		return math.NaN()
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(matches[len(matches)-1], ",", ""), 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return value
+}
+
+// SimilarityFunc returns the pairwise similarity matrix of texts, with
+// values in [0, 1].
+type SimilarityFunc func(ctx context.Context, texts []string) ([][]float64, error)
+
+// SimilarityMatch treats answers as equal if similarity rates them at least
+// threshold, for example with Command.EmbeddingSimilarity.
+func SimilarityMatch(similarity SimilarityFunc, threshold float64) Equivalence {
+	return EquivalenceFunc(func(ctx context.Context, answers []string) ([]int, error) {
+		matrix, err := similarity(ctx, answers)
+		if err != nil {
+			return nil, err
+		}
+		return groupBy(len(answers), func(i, j int) bool { return matrix[i][j] >= threshold }), nil
+	})
+}
+
+// groupBy assigns each of n items to the first group whose first member it
+// matches, or to a new group.
+func groupBy(n int, match func(i, j int) bool) []int {
+	groups := make([]int, n)
+	var leaders []int
+	for i := range n {
+		groups[i] = -1
+		for g, leader := range leaders {
+			if match(leader, i) {
+				groups[i] = g
+				break
+			}
+		}
+		if groups[i] < 0 {
+			groups[i] = len(leaders)
+			leaders = append(leaders, i)
+		}
+	}
+	return groups
+}
+
+// AnswerGroup is a set of results whose answers agree.
+type AnswerGroup struct {
+	// Answer is the answer of the first result of the group.
+	Answer  string
+	Results []Result
+}
+
+// Consensus is the outcome of a vote among results.
+type Consensus struct {
+	// Answer and Result are those of the largest group. On a tie, the group
+	// whose first answer arrived first wins.
+	Answer string
+	Result Result
+	// Votes is the size of the largest group and Total the number of
+	// successful results that voted.
+	Votes, Total int
+	// Groups holds the groups of agreeing answers, largest first.
+	Groups []AnswerGroup
+	// Failed holds the results that errored and did not vote.
+	Failed []Result
+}
+
+// Agreement returns the fraction of votes cast for the winning answer.
+func (c Consensus) Agreement() float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return float64(c.Votes) / float64(c.Total)
+}
+
+// Majority reports whether more than half of the votes agree.
+func (c Consensus) Majority() bool {
+	return c.Votes*2 > c.Total
+}
+
+// Tie reports whether another group has as many votes as the winner.
+func (c Consensus) Tie() bool {
+	return len(c.Groups) > 1 && len(c.Groups[1].Results) == c.Votes
+}
+
+// ErrNoConsensus is returned by Vote when no result succeeded.
+var ErrNoConsensus = errors.New("no successful results to vote")
+
+// Vote groups the answers of the successful results by eq and returns the
+// most common one with agreement statistics.
+func Vote(ctx context.Context, results []Result, eq Equivalence) (Consensus, error) {
+	var consensus Consensus
+	var voters []Result
+	var answers []string
+	for _, r := range results {
+		if r.Error != nil {
+			consensus.Failed = append(consensus.Failed, r)
+			continue
+		}
+		voters = append(voters, r)
+		answers = append(answers, r.Content())
+	}
+	if len(voters) == 0 {
+		return consensus, ErrNoConsensus
+	}
+
+	groups, err := eq.Group(ctx, answers)
+	if err != nil {
+		return consensus, fmt.Errorf("failed to group answers: %w", err)
+	}
+	if len(groups) != len(answers) {
+		return consensus, fmt.Errorf("grouped %d of %d answers", len(groups), len(answers))
+	}
+	for i, g := range groups {
+		for len(consensus.Groups) <= g {
+			consensus.Groups = append(consensus.Groups, AnswerGroup{})
+		}
+		if len(consensus.Groups[g].Results) == 0 {
+			consensus.Groups[g].Answer = answers[i]
+		}
+		consensus.Groups[g].Results = append(consensus.Groups[g].Results, voters[i])
+	}
+	consensus.Groups = slices.DeleteFunc(consensus.Groups, func(g AnswerGroup) bool { return len(g.Results) == 0 })
+	slices.SortStableFunc(consensus.Groups, func(a, b AnswerGroup) int { return len(b.Results) - len(a.Results) })
+
+	winner := consensus.Groups[0]
+	consensus.Answer = winner.Answer
+	consensus.Result = winner.Results[0]
+	consensus.Votes = len(winner.Results)
+	consensus.Total = len(voters)
+	return consensus, nil
+}
+
+// Consensus broadcasts req to all targets and votes on their answers.
+func (c *Command) Consensus(ctx context.Context, req ChatCompletionRequest, eq Equivalence, opts ...CallOption) (Consensus, error) {
+	var results []Result
+	for r := range c.Broadcast(ctx, req, opts...) {
+		results = append(results, r)
+	}
+	return Vote(ctx, results, eq)
+}
@@ -0,0 +1,239 @@
+package general
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrContextWindow is returned by Conversation.Trim when the conversation
+// does not fit even after dropping all but its latest turn.
+var ErrContextWindow = errors.New("conversation does not fit the context window")
+
+// Conversation is a multi-turn chat history. Each turn appends the user
+// message and the reply chosen from the response.
+type Conversation struct {
+	Messages []ChatCompletionMessage
+}
+
+// NewConversation starts a conversation with an optional system prompt.
+func NewConversation(system string) *Conversation {
+	c := &Conversation{}
+	c.SetSystem(system)
+	return c
+}
+
+// System returns the system prompt, or "" if there is none.
+func (c *Conversation) System() string {
+	if len(c.Messages) > 0 && c.Messages[0].Role == RoleSystem {
+		return c.Messages[0].Text()
+	}
+	return ""
+}
+
+// SetSystem replaces the system prompt. An empty prompt removes it.
+func (c *Conversation) SetSystem(system string) {
+	hasSystem := len(c.Messages) > 0 && c.Messages[0].Role == RoleSystem
+	switch {
+	case system == "" && hasSystem:
+		c.Messages = c.Messages[1:]
+	case system == "":
+	case hasSystem:
+		c.Messages[0] = SystemMessage(system)
+	default:
+		c.Messages = append([]ChatCompletionMessage{SystemMessage(system)}, c.Messages...)
+	}
+}
+
+// Add appends messages to the history.
+func (c *Conversation) Add(messages ...ChatCompletionMessage) {
+	c.Messages = append(c.Messages, messages...)
+}
+
+// WithSystem sets the system prompt like SetSystem and returns c for
+// chaining.
+func (c *Conversation) WithSystem(system string) *Conversation {
+	c.SetSystem(system)
+	return c
+}
+
+// User appends a user message and returns c for chaining, as in
+// NewConversation("").User("Hi").Assistant("Hello!").User("How are you?").
+func (c *Conversation) User(text string) *Conversation {
+	c.Add(UserMessage(text))
+	return c
+}
+
+// UserParts appends a multi-part user message, such as text with images.
+func (c *Conversation) UserParts(parts ...ContentPart) *Conversation {
+	c.Add(ChatCompletionMessage{Role: RoleUser, Parts: parts})
+	return c
+}
+
+// Assistant appends an assistant message, for example a few-shot example.
+func (c *Conversation) Assistant(text string) *Conversation {
+	c.Add(AssistantMessage(text))
+	return c
+}
+
+// AddToolResult appends the result of the tool call with the given ID.
+func (c *Conversation) AddToolResult(toolCallID, content string) *Conversation {
+	c.Add(ToolResult(toolCallID, content))
+	return c
+}
+
+// PendingToolCalls returns the tool calls of the last assistant message that
+// have no result yet.
+func (c *Conversation) PendingToolCalls() []ToolCall {
+	answered := make(map[string]bool)
+	for i := len(c.Messages) - 1; i >= 0; i-- {
+		m := c.Messages[i]
+		switch m.Role {
+		case RoleTool:
+			answered[m.ToolCallID] = true
+		case RoleAssistant:
+			var pending []ToolCall
+			for _, call := range m.ToolCalls {
+				if !answered[call.ID] {
+					pending = append(pending, call)
+				}
+			}
+			return pending
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// AddReply appends the message of the first choice in resp.
+func (c *Conversation) AddReply(resp ChatCompletionResponse) error {
+	if len(resp.Choices) == 0 {
+		return fmt.Errorf("no choices in response")
+	}
+	c.Add(resp.Choices[0].Message)
+	return nil
+}
+
+// Rewind removes the trailing assistant reply, if any, so the last user
+// message can be sent again. It reports whether a reply was removed.
+func (c *Conversation) Rewind() bool {
+	n := len(c.Messages)
+	if n == 0 || c.Messages[n-1].Role != RoleAssistant {
+		return false
+	}
+	c.Messages = c.Messages[:n-1]
+	return true
+}
+
+// Trim drops the oldest turns until the conversation fits the context
+// window of model, as recorded in DefaultCatalog, with reserveTokens left
+// for the reply. model is a model name or alias, optionally prefixed by a
+// provider name as in "groq:@fast". It returns the number of messages
+// removed. Trim only drops turns, as summarizing them takes a request to a
+// model; Command.Compact summarizes them instead.
+func (c *Conversation) Trim(model string, reserveTokens int) (int, error) {
+	provider := ""
+	if name, rest, ok := strings.Cut(model, ":"); ok && slices.Contains(knownProviders, name) {
+		provider, model = name, rest
+	}
+	resolved, err := DefaultAliases.Resolve(provider, model)
+	if err != nil {
+		return 0, err
+	}
+	details, ok := ModelInfo(provider, resolved)
+	if !ok || details.ContextWindow == 0 {
+		return 0, fmt.Errorf("no context window known for %s", resolved)
+	}
+	return c.TrimTo(resolved, details.ContextWindow-reserveTokens)
+}
+
+// TrimTo drops the oldest turns until the conversation counts at most limit
+// tokens for model. A turn runs from a user message to the next one, so
+// tool calls stay with their results. The system prompt and the latest turn
+// are always kept; if they alone exceed limit, TrimTo returns
+// ErrContextWindow along with the number of messages removed.
+func (c *Conversation) TrimTo(model string, limit int) (int, error) {
+	head := 0
+	if len(c.Messages) > 0 && c.Messages[0].Role == RoleSystem {
+		head = 1
+	}
+	total := CountTokens(model, c.Messages)
+	removed := 0
+	for total > limit {
+		next := c.nextTurn(head)
+		if next < 0 {
+			return removed, fmt.Errorf("%w: %d tokens, limit %d", ErrContextWindow, total, limit)
+		}
+		for _, m := range c.Messages[head:next] {
+			total -= CountTokens(model, []ChatCompletionMessage{m}) - tokensPerReply
+		}
+		c.Messages = slices.Delete(c.Messages, head, next)
+		removed += next - head
+	}
+	return removed, nil
+}
+
+// nextTurn returns the index of the first user message after from, or -1.
+func (c *Conversation) nextTurn(from int) int {
+	for i := from + 1; i < len(c.Messages); i++ {
+		if c.Messages[i].Role == RoleUser {
+			return i
+		}
+	}
+	return -1
+}
+
+// Request returns base with the conversation history as its messages.
+func (c *Conversation) Request(base ChatCompletionRequest) ChatCompletionRequest {
+	base.Messages = slices.Clone(c.Messages)
+	return base
+}
+
+// Send appends a user message, sends the conversation to target and
+// appends the reply. On failure the user message is removed again.
+func (c *Command) Send(ctx context.Context, target Target, conv *Conversation, base ChatCompletionRequest, text string) (ChatCompletionResponse, error) {
+	conv.Add(UserMessage(text))
+	resp, err := c.resend(ctx, target, conv, base)
+	if err != nil {
+		conv.Messages = conv.Messages[:len(conv.Messages)-1]
+		return ChatCompletionResponse{}, err
+	}
+	return resp, nil
+}
+
+// Retry rewinds the last reply and sends the conversation to target again.
+func (c *Command) Retry(ctx context.Context, target Target, conv *Conversation, base ChatCompletionRequest) (ChatCompletionResponse, error) {
+	n := len(conv.Messages)
+	if conv.Rewind() {
+		n--
+	}
+	if n == 0 || conv.Messages[n-1].Role != RoleUser {
+		return ChatCompletionResponse{}, fmt.Errorf("no user message to retry")
+	}
+	return c.resend(ctx, target, conv, base)
+}
+
+// resend sends the conversation, compacted if the Command is configured
+// to, and appends the reply.
+func (c *Command) resend(ctx context.Context, target Target, conv *Conversation, base ChatCompletionRequest) (ChatCompletionResponse, error) {
+	if c.compaction != nil {
+		if _, err := c.Compact(ctx, target, conv, *c.compaction); err != nil {
+			return ChatCompletionResponse{}, err
+		}
+	}
+	req := conv.Request(base)
+	start := time.Now()
+	resp, err := c.executeTarget(ctx, target, req)
+	if err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	if err := conv.AddReply(resp); err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	conv.Messages[len(conv.Messages)-1].Provenance = newProvenance(target, resp, start)
+	return resp, nil
+}
@@ -0,0 +1,158 @@
+package general
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// DefaultOutlierGap is how far below the median a result's mean similarity
+// to the others must fall for Similarities to flag it as an outlier.
+const DefaultOutlierGap = 0.15
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed returns the embeddings of inputs from the provider's /embeddings
+// endpoint, in input order.
+func (c *Command) Embed(ctx context.Context, provider Provider, model string, inputs []string) ([][]float64, error) {
+	var response embeddingResponse
+	err := c.doJSON(ctx, provider, "POST", provider.baseURL()+"/embeddings",
+		embeddingRequest{Model: model, Input: inputs}, &response)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	if len(response.Data) != len(inputs) {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(response.Data), len(inputs))
+	}
+
+	embeddings := make([][]float64, len(inputs))
+	for _, d := range response.Data {
+		if d.Index < 0 || d.Index >= len(inputs) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		embeddings[d.Index] = d.Embedding
+	}
+	return embeddings, nil
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, or 0 if
+// either is zero or their lengths differ.
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// EmbeddingSimilarity returns a SimilarityFunc comparing texts by the cosine
+// similarity of their embeddings from provider and model, for use with
+// SimilarityMatch and Similarities.
+func (c *Command) EmbeddingSimilarity(provider Provider, model string) SimilarityFunc {
+	return func(ctx context.Context, texts []string) ([][]float64, error) {
+		embeddings, err := c.Embed(ctx, provider, model, texts)
+		if err != nil {
+			return nil, err
+		}
+		matrix := make([][]float64, len(texts))
+		for i := range matrix {
+			matrix[i] = make([]float64, len(texts))
+			for j := range matrix[i] {
+				matrix[i][j] = CosineSimilarity(embeddings[i], embeddings[j])
+			}
+		}
+		return matrix, nil
+	}
+}
+
+// SimilarityReport is the pairwise similarity of a set of results.
+type SimilarityReport struct {
+	// Results are the successful results compared, in input order.
+	Results []Result
+	// Matrix[i][j] is the similarity of Results[i] and Results[j].
+	Matrix [][]float64
+	// Mean[i] is the mean similarity of Results[i] to the other results.
+	Mean []float64
+	// Outliers are the indices into Results of replies whose mean
+	// similarity is DefaultOutlierGap or more below the median.
+	Outliers []int
+}
+
+// IsOutlier reports whether Results[i] is an outlier.
+func (s SimilarityReport) IsOutlier(i int) bool {
+	return slices.Contains(s.Outliers, i)
+}
+
+// Similarities compares the replies of the successful results with
+// similarity and flags the ones that disagree with the rest. Outliers need
+// at least three results.
+func Similarities(ctx context.Context, similarity SimilarityFunc, results []Result) (SimilarityReport, error) {
+	var report SimilarityReport
+	var texts []string
+	for _, r := range results {
+		if r.Error == nil {
+			report.Results = append(report.Results, r)
+			texts = append(texts, r.Content())
+		}
+	}
+	if len(texts) < 2 {
+		return report, fmt.Errorf("need at least two successful results, got %d", len(texts))
+	}
+
+	matrix, err := similarity(ctx, texts)
+	if err != nil {
+		return report, err
+	}
+	report.Matrix = matrix
+
+	n := len(texts)
+	report.Mean = make([]float64, n)
+	for i := range n {
+		var sum float64
+		for j := range n {
+			if i != j {
+				sum += matrix[i][j]
+			}
+		}
+		report.Mean[i] = sum / float64(n-1)
+	}
+	if n >= 3 {
+		median := medianOf(report.Mean)
+		for i, mean := range report.Mean {
+			if mean <= median-DefaultOutlierGap {
+				report.Outliers = append(report.Outliers, i)
+			}
+		}
+	}
+	return report, nil
+}
+
+// medianOf returns the median of values.
+func medianOf(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
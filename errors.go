@@ -0,0 +1,183 @@
+package general
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Common provider error codes, for APIError.HasCode.
+const (
+	ErrorCodeContentFilter       = "content_filter"
+	ErrorCodeInsufficientQuota   = "insufficient_quota"
+	ErrorCodeModelNotFound       = "model_not_found"
+	ErrorCodeModelDecommissioned = "model_decommissioned"
+	ErrorCodeRateLimitExceeded   = "rate_limit_exceeded"
+	ErrorCodeContextLength       = "context_length_exceeded"
+	ErrorCodeInvalidAPIKey       = "invalid_api_key"
+)
+
+// APIError is returned when a provider responds with a non-200 status.
+// The fields other than StatusCode and Body are parsed from the provider's
+// error payload and are empty when it has none or an unknown shape.
+type APIError struct {
+	StatusCode int
+	Body       string
+
+	Message string
+	// Code is the provider's error code, such as "model_not_found".
+	// Numeric codes are kept as their decimal string.
+	Code string
+	// Type is the OpenAI-style error type, such as "invalid_request_error".
+	Type string
+	// Status is the Google RPC status of Gemini errors, such as "NOT_FOUND".
+	Status string
+	// Upstream is the provider a gateway such as OpenRouter forwarded to.
+	Upstream string
+	// RetryAfter is the delay the provider asked for in a Retry-After
+	// header, or zero.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+	}
+	if code := e.code(); code != "" {
+		return fmt.Sprintf("API request failed with status %d (%s): %s", e.StatusCode, code, e.Message)
+	}
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Message)
+}
+
+// code returns the most specific identifier of the error for messages.
+func (e *APIError) code() string {
+	for _, c := range []string{e.Code, e.Type, e.Status} {
+		if c != "" && !isNumeric(c) {
+			return c
+		}
+	}
+	return ""
+}
+
+// HasCode reports whether code matches the error's Code, Type or Status.
+func (e *APIError) HasCode(code string) bool {
+	return code != "" && (strings.EqualFold(e.Code, code) || strings.EqualFold(e.Type, code) || strings.EqualFold(e.Status, code))
+}
+
+// providerError covers the error payloads of the supported providers:
+// OpenAI-style {"error": {"message", "type", "code"}}, Gemini's
+// {"error": {"code", "message", "status"}} and OpenRouter's, which nests the
+// upstream error as a JSON string in error.metadata.raw.
+type providerError struct {
+	Error *struct {
+		Message  string          `json:"message"`
+		Type     string          `json:"type"`
+		Code     json.RawMessage `json:"code"`
+		Status   string          `json:"status"`
+		Metadata struct {
+			Raw          any    `json:"raw"`
+			ProviderName string `json:"provider_name"`
+		} `json:"metadata"`
+	} `json:"error"`
+
+	// Some OpenAI-compatible servers return {"detail": "..."} or {"message": "..."}.
+	Detail  any    `json:"detail"`
+	Message string `json:"message"`
+}
+
+// newAPIError builds an APIError for a non-200 response, parsing body.
+func newAPIError(statusCode int, body []byte) *APIError {
+	e := &APIError{StatusCode: statusCode, Body: string(body)}
+	e.parse(body)
+	return e
+}
+
+// retryAfter returns the delay of a Retry-After header, given in seconds or
+// as an HTTP date, or zero if it has none.
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// parse fills the typed fields from an error payload, leaving them empty if
+// the payload is not recognized.
+func (e *APIError) parse(body []byte) {
+	body = []byte(strings.TrimSpace(string(body)))
+	// Gemini's OpenAI-compatible endpoint wraps the error in an array.
+	if len(body) > 0 && body[0] == '[' {
+		var list []json.RawMessage
+		if json.Unmarshal(body, &list) != nil || len(list) == 0 {
+			return
+		}
+		body = list[0]
+	}
+
+	var payload providerError
+	if json.Unmarshal(body, &payload) != nil {
+		return
+	}
+	if payload.Error == nil {
+		if detail, ok := payload.Detail.(string); ok {
+			e.Message = detail
+		} else {
+			e.Message = payload.Message
+		}
+		return
+	}
+
+	pe := payload.Error
+	e.Message = pe.Message
+	e.Type = pe.Type
+	e.Status = pe.Status
+	e.Code = rawCode(pe.Code)
+	e.Upstream = pe.Metadata.ProviderName
+
+	// OpenRouter reports the HTTP status as the code; the upstream error
+	// carries the specific one.
+	if raw, ok := pe.Metadata.Raw.(string); ok {
+		var upstream APIError
+		upstream.parse([]byte(raw))
+		if upstream.Message != "" {
+			e.Message = upstream.Message
+		}
+		if upstream.Code != "" && (e.Code == "" || isNumeric(e.Code)) {
+			e.Code = upstream.Code
+		}
+		if e.Type == "" {
+			e.Type = upstream.Type
+		}
+		if e.Status == "" {
+			e.Status = upstream.Status
+		}
+	}
+}
+
+// rawCode returns a JSON string or number code as a string.
+func rawCode(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String()
+	}
+	return ""
+}
+
+func isNumeric(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
@@ -0,0 +1,120 @@
+// Package eval checks completion results against assertions and runs prompt
+// suites across the targets of a Command.
+package eval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/festeh/general"
+)
+
+// Assertion is a named check of a result. Check returns nil if the result
+// passes and an error describing the failure otherwise.
+type Assertion struct {
+	Name  string
+	Check func(general.Result) error
+}
+
+// Check returns a custom assertion.
+func Check(name string, check func(general.Result) error) Assertion {
+	return Assertion{Name: name, Check: check}
+}
+
+// Contains asserts that the reply contains substr.
+func Contains(substr string) Assertion {
+	return Check(fmt.Sprintf("contains %q", substr), func(r general.Result) error {
+		if !strings.Contains(r.Content(), substr) {
+			return fmt.Errorf("reply does not contain %q", substr)
+		}
+		return nil
+	})
+}
+
+// ContainsFold asserts that the reply contains substr, ignoring case.
+func ContainsFold(substr string) Assertion {
+	return Check(fmt.Sprintf("contains %q (any case)", substr), func(r general.Result) error {
+		if !strings.Contains(strings.ToLower(r.Content()), strings.ToLower(substr)) {
+			return fmt.Errorf("reply does not contain %q", substr)
+		}
+		return nil
+	})
+}
+
+// NotContains asserts that the reply does not contain substr.
+func NotContains(substr string) Assertion {
+	return Check(fmt.Sprintf("does not contain %q", substr), func(r general.Result) error {
+		if strings.Contains(r.Content(), substr) {
+			return fmt.Errorf("reply contains %q", substr)
+		}
+		return nil
+	})
+}
+
+// Matches asserts that the reply matches the regular expression pattern. It
+// panics if pattern does not compile.
+func Matches(pattern string) Assertion {
+	re := regexp.MustCompile(pattern)
+	return Check(fmt.Sprintf("matches /%s/", pattern), func(r general.Result) error {
+		if !re.MatchString(r.Content()) {
+			return fmt.Errorf("reply does not match /%s/", pattern)
+		}
+		return nil
+	})
+}
+
+// ValidJSON asserts that the reply holds a JSON document, bare or in a code
+// fence as accepted by general.ExtractJSON.
+func ValidJSON() Assertion {
+	return Check("valid JSON", func(r general.Result) error {
+		doc, err := general.ExtractJSON(r.Content())
+		if err != nil {
+			return err
+		}
+		if !json.Valid([]byte(doc)) {
+			return errors.New("reply is not valid JSON")
+		}
+		return nil
+	})
+}
+
+// MatchesSchema asserts that the JSON document in the reply matches schema.
+func MatchesSchema(schema general.Schema) Assertion {
+	return Check("matches schema", func(r general.Result) error {
+		doc, err := general.ExtractJSON(r.Content())
+		if err != nil {
+			return err
+		}
+		return schema.Validate([]byte(doc))
+	})
+}
+
+// LatencyUnder asserts that the request, retries included, took less than max.
+func LatencyUnder(max time.Duration) Assertion {
+	return Check(fmt.Sprintf("latency under %s", max), func(r general.Result) error {
+		if r.Duration >= max {
+			return fmt.Errorf("took %s", r.Duration.Round(time.Millisecond))
+		}
+		return nil
+	})
+}
+
+// CostUnder asserts that the request cost less than max USD. The cost is the
+// one reported by the provider, or else estimated from the model catalog
+// prices; the assertion fails if neither is known.
+func CostUnder(max float64) Assertion {
+	return Check(fmt.Sprintf("cost under $%g", max), func(r general.Result) error {
+		cost, ok := r.EstimatedCost()
+		if !ok {
+			return errors.New("cost unknown")
+		}
+		if cost >= max {
+			return fmt.Errorf("cost $%.6f", cost)
+		}
+		return nil
+	})
+}
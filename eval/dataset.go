@@ -0,0 +1,240 @@
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/festeh/general"
+)
+
+// Row is one record of a dataset, by column name.
+type Row map[string]string
+
+// LoadDataset reads the rows of a CSV file, whose first line names the
+// columns, or of a JSONL file with one object per line, chosen by the
+// file extension.
+func LoadDataset(path string) ([]Row, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dataset: %w", err)
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ReadCSV(f)
+	case ".jsonl", ".ndjson":
+		return ReadJSONL(f)
+	default:
+		return nil, fmt.Errorf("unknown dataset format %q, expected .csv or .jsonl", filepath.Ext(path))
+	}
+}
+
+// ReadCSV reads rows from CSV whose first line names the columns.
+func ReadCSV(r io.Reader) ([]Row, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV dataset: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty CSV dataset")
+	}
+	header := records[0]
+	rows := make([]Row, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(Row, len(header))
+		for i, column := range header {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ReadJSONL reads rows from JSON objects, one per line. String values are
+// taken as they are; other values as their JSON encoding.
+func ReadJSONL(r io.Reader) ([]Row, error) {
+	var rows []Row
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, fmt.Errorf("dataset line %d: %w", line, err)
+		}
+		row := make(Row, len(fields))
+		for column, value := range fields {
+			var s string
+			if json.Unmarshal(value, &s) != nil {
+				s = string(value)
+			}
+			row[column] = s
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read JSONL dataset: %w", err)
+	}
+	return rows, nil
+}
+
+// Dataset renders a prompt template for every row of a dataset.
+type Dataset struct {
+	Rows []Row
+	// Template is a text/template executed with the row, so that
+	// {{.question}} is replaced by the question column. Referring to a
+	// column the row lacks is an error.
+	Template string
+	// Request holds the parameters and any system prompt sent with every
+	// rendered prompt, which is appended as a user message.
+	Request general.ChatCompletionRequest
+	// Assertions returns the checks the replies to a row must pass.
+	Assertions func(Row) []Assertion
+}
+
+// Cases renders the template for every row. A case is named after the id
+// or name column of its row, or else its line in the dataset.
+func (d Dataset) Cases() ([]Case, error) {
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(d.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %w", err)
+	}
+	cases := make([]Case, len(d.Rows))
+	for i, row := range d.Rows {
+		var prompt strings.Builder
+		if err := tmpl.Execute(&prompt, map[string]string(row)); err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		req := d.Request
+		req.Messages = append(append([]general.ChatCompletionMessage(nil), d.Request.Messages...), general.UserMessage(prompt.String()))
+		cases[i] = Case{Name: rowName(i, row), Request: req, Vars: row}
+		if d.Assertions != nil {
+			cases[i].Assertions = d.Assertions(row)
+		}
+	}
+	return cases, nil
+}
+
+// rowName names the i-th row for reports.
+func rowName(i int, row Row) string {
+	for _, column := range []string{"id", "name"} {
+		if row[column] != "" {
+			return row[column]
+		}
+	}
+	return "row " + strconv.Itoa(i+1)
+}
+
+// ColumnAssertion makes an Assertions function that checks replies with
+// assert applied to the value of column, skipping rows where it is empty.
+// ColumnAssertion("expected", eval.ContainsFold) checks each reply
+// contains the expected answer of its row.
+func ColumnAssertion(column string, assert func(string) Assertion) func(Row) []Assertion {
+	return func(row Row) []Assertion {
+		if row[column] == "" {
+			return nil
+		}
+		return []Assertion{assert(row[column])}
+	}
+}
+
+// Assertions combines Assertions functions.
+func Assertions(fns ...func(Row) []Assertion) func(Row) []Assertion {
+	return func(row Row) []Assertion {
+		var assertions []Assertion
+		for _, fn := range fns {
+			assertions = append(assertions, fn(row)...)
+		}
+		return assertions
+	}
+}
+
+// RunDataset renders the cases of d and runs them across the targets of
+// cmd as a Batch, so opts may bound the concurrency or checkpoint the run.
+func RunDataset(ctx context.Context, cmd *general.Command, d Dataset, opts ...general.CallOption) (Report, error) {
+	cases, err := d.Cases()
+	if err != nil {
+		return Report{}, err
+	}
+	return RunBatch(ctx, cmd, cases, opts...), nil
+}
+
+// RunBatch is like Run but sends the cases as a Batch, several at a time.
+func RunBatch(ctx context.Context, cmd *general.Command, cases []Case, opts ...general.CallOption) Report {
+	reqs := make([]general.ChatCompletionRequest, len(cases))
+	for i, c := range cases {
+		reqs[i] = c.request()
+	}
+	var report Report
+	for i, results := range cmd.Batch(ctx, reqs, opts...) {
+		for _, r := range results {
+			report.Outcomes = append(report.Outcomes, newOutcome(i, cases[i], r))
+		}
+	}
+	return report
+}
+
+// outcomeRecord is the JSONL form of an Outcome.
+type outcomeRecord struct {
+	Index     int            `json:"index"`
+	Case      string         `json:"case"`
+	Provider  string         `json:"provider"`
+	Model     string         `json:"model"`
+	Prompt    string         `json:"prompt,omitempty"`
+	Vars      Row            `json:"vars,omitempty"`
+	Content   string         `json:"content,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Usage     *general.Usage `json:"usage,omitempty"`
+	LatencyMS int64          `json:"latency_ms"`
+	Passed    bool           `json:"passed"`
+	Failures  []failure      `json:"failures,omitempty"`
+}
+
+type failure struct {
+	Assertion string `json:"assertion"`
+	Error     string `json:"error"`
+}
+
+// WriteJSONL writes one JSON line per outcome with the case, its variables,
+// the reply and the assertion results.
+func (r Report) WriteJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, o := range r.Outcomes {
+		rec := outcomeRecord{
+			Index:     o.Index,
+			Case:      o.Case,
+			Provider:  providerName(o.Target),
+			Model:     o.Target.Model,
+			Prompt:    o.Prompt,
+			Vars:      o.Vars,
+			Content:   o.Result.Content(),
+			Usage:     o.Result.Response.Usage,
+			LatencyMS: o.Result.Duration.Milliseconds(),
+			Passed:    o.Passed(),
+		}
+		if o.Result.Error != nil {
+			rec.Error = o.Result.Error.Error()
+		}
+		for _, f := range o.Failures {
+			rec.Failures = append(rec.Failures, failure{Assertion: f.Assertion, Error: f.Err.Error()})
+		}
+		if err := enc.Encode(rec); err != nil {
+			return fmt.Errorf("failed to write outcomes: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/festeh/general"
+)
+
+// goldenExt is the extension of golden answer files.
+const goldenExt = ".txt"
+
+// ErrNoGolden is the failure of a reply that has no golden answer to be
+// compared with.
+var ErrNoGolden = errors.New("no golden answer recorded")
+
+// Comparator decides whether reply, given to req, matches the golden
+// answer, and returns an error describing the regression if not.
+type Comparator func(ctx context.Context, req general.ChatCompletionRequest, golden, reply string) error
+
+// CompareExact requires the reply to equal the golden answer, apart from
+// leading and trailing whitespace.
+func CompareExact() Comparator {
+	return func(_ context.Context, _ general.ChatCompletionRequest, golden, reply string) error {
+		want, got := splitLines(strings.TrimSpace(golden)), splitLines(strings.TrimSpace(reply))
+		for i := range max(len(want), len(got)) {
+			var w, g string
+			if i < len(want) {
+				w = want[i]
+			}
+			if i < len(got) {
+				g = got[i]
+			}
+			if w != g {
+				return fmt.Errorf("reply differs from golden answer at line %d: got %q, want %q", i+1, g, w)
+			}
+		}
+		return nil
+	}
+}
+
+// CompareNormalized requires the reply to equal the golden answer after
+// collapsing whitespace, folding case and dropping trailing punctuation,
+// as general.ExactMatch compares answers.
+func CompareNormalized() Comparator {
+	return CompareEquivalent(general.ExactMatch())
+}
+
+// CompareEquivalent requires eq to group the reply with the golden answer.
+func CompareEquivalent(eq general.Equivalence) Comparator {
+	return func(ctx context.Context, _ general.ChatCompletionRequest, golden, reply string) error {
+		groups, err := eq.Group(ctx, []string{golden, reply})
+		if err != nil {
+			return err
+		}
+		if groups[0] != groups[1] {
+			return errors.New("reply does not match golden answer")
+		}
+		return nil
+	}
+}
+
+// judgeReferenceRubric asks the judge to score a reply against a golden
+// answer; the answer is appended.
+const judgeReferenceRubric = `Score how well the response agrees in substance with the reference answer below: 10 if it gives the same answer, lower the more it omits, adds or contradicts. Wording and formatting do not matter.
+
+Reference answer:
+`
+
+// CompareJudged asks judge, through cmd, to score the reply against the
+// golden answer and requires at least minScore out of 10.
+func CompareJudged(cmd *general.Command, judge general.Target, minScore float64) Comparator {
+	return func(ctx context.Context, req general.ChatCompletionRequest, golden, reply string) error {
+		result := general.Result{Response: general.ChatCompletionResponse{
+			Choices: []general.ChatCompletionChoice{{Message: general.AssistantMessage(reply)}},
+		}}
+		judgement, err := cmd.Judge(ctx, judge, req, []general.Result{result}, judgeReferenceRubric+golden)
+		if err != nil {
+			return err
+		}
+		if s := judgement.Scores[0]; s.Score < minScore {
+			return fmt.Errorf("judge scored %.1f, below %.1f: %s", s.Score, minScore, s.Reason)
+		}
+		return nil
+	}
+}
+
+// Golden keeps the golden answers of a suite in a directory, one file per
+// case and target, so that prompt changes can be checked for regressions
+// like code.
+type Golden struct {
+	Dir string
+	// Compare decides whether a reply matches its golden answer. It
+	// defaults to CompareExact.
+	Compare Comparator
+}
+
+// unsafeName matches the characters not kept in golden file names.
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Path returns the file holding the golden answer of the named case on
+// target.
+func (g Golden) Path(caseName string, target general.Target) string {
+	return filepath.Join(g.Dir, fileName(caseName), fileName(targetName(target))+goldenExt)
+}
+
+// fileName turns name into a file name.
+func fileName(name string) string {
+	name = strings.Trim(unsafeName.ReplaceAllString(name, "_"), "_.")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// Load returns the golden answer of the named case on target, or
+// ErrNoGolden if none is recorded.
+func (g Golden) Load(caseName string, target general.Target) (string, error) {
+	data, err := os.ReadFile(g.Path(caseName, target))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrNoGolden
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read golden answer: %w", err)
+	}
+	return string(data), nil
+}
+
+// Save records answer as the golden answer of the named case on target.
+func (g Golden) Save(caseName string, target general.Target, answer string) error {
+	path := g.Path(caseName, target)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create golden directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(answer), 0o644); err != nil {
+		return fmt.Errorf("failed to write golden answer: %w", err)
+	}
+	return nil
+}
+
+// Assertion checks the replies to c against their golden answers. A reply
+// without one fails with ErrNoGolden.
+func (g Golden) Assertion(c Case) Assertion {
+	compare := g.Compare
+	if compare == nil {
+		compare = CompareExact()
+	}
+	return Check("matches golden answer", func(r general.Result) error {
+		golden, err := g.Load(c.Name, r.Target)
+		if err != nil {
+			return err
+		}
+		return compare(context.Background(), c.request(), golden, r.Content())
+	})
+}
+
+// Apply returns cases with the golden assertion added to each.
+func (g Golden) Apply(cases []Case) []Case {
+	checked := make([]Case, len(cases))
+	for i, c := range cases {
+		c.Assertions = append(append([]Assertion(nil), c.Assertions...), g.Assertion(c))
+		checked[i] = c
+	}
+	return checked
+}
+
+// Update records the replies of the successful outcomes of report as the
+// golden answers, returning how many it wrote.
+func (g Golden) Update(report Report) (int, error) {
+	var n int
+	for _, o := range report.Outcomes {
+		if o.Result.Error != nil {
+			continue
+		}
+		if err := g.Save(o.Case, o.Target, o.Result.Content()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// splitLines splits text into lines.
+func splitLines(text string) []string {
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,189 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/festeh/general"
+)
+
+// Case is one prompt of a suite with the assertions its replies must pass.
+type Case struct {
+	Name string
+	// Request is sent as is. If it has no messages, Prompt is sent as a
+	// user message.
+	Request    general.ChatCompletionRequest
+	Prompt     string
+	Assertions []Assertion
+	// Vars are the dataset row the case was rendered from, if any.
+	Vars Row
+}
+
+// request returns the request of c.
+func (c Case) request() general.ChatCompletionRequest {
+	req := c.Request
+	if len(req.Messages) == 0 {
+		req.Messages = []general.ChatCompletionMessage{general.UserMessage(c.Prompt)}
+	}
+	return req
+}
+
+// Failure is an assertion a result failed.
+type Failure struct {
+	Assertion string
+	Err       error
+}
+
+// Outcome is the result of one case on one target.
+type Outcome struct {
+	// Index is the position of the case in the suite.
+	Index int
+	Case  string
+	// Prompt is the last user message of the case, and Vars its dataset row.
+	Prompt   string
+	Vars     Row
+	Target   general.Target
+	Result   general.Result
+	Failures []Failure
+}
+
+// newOutcome checks the result of the i-th case c.
+func newOutcome(i int, c Case, r general.Result) Outcome {
+	o := Outcome{Index: i, Case: c.Name, Vars: c.Vars, Target: r.Target, Result: r, Failures: Evaluate(r, c.Assertions...)}
+	for _, m := range slices.Backward(c.request().Messages) {
+		if m.Role == general.RoleUser {
+			o.Prompt = m.Text()
+			break
+		}
+	}
+	return o
+}
+
+// Passed reports whether the request succeeded and passed every assertion.
+func (o Outcome) Passed() bool {
+	return len(o.Failures) == 0
+}
+
+// Evaluate checks r against assertions. A failed request fails with its
+// error and is not checked further.
+func Evaluate(r general.Result, assertions ...Assertion) []Failure {
+	if r.Error != nil {
+		return []Failure{{Assertion: "request succeeds", Err: r.Error}}
+	}
+	var failures []Failure
+	for _, a := range assertions {
+		if err := a.Check(r); err != nil {
+			failures = append(failures, Failure{Assertion: a.Name, Err: err})
+		}
+	}
+	return failures
+}
+
+// Report holds the outcomes of a suite, ordered by case and then by the
+// targets of the Command.
+type Report struct {
+	Outcomes []Outcome
+}
+
+// Run sends every case to all targets of cmd, one case at a time, and
+// checks the replies. opts apply to every request.
+func Run(ctx context.Context, cmd *general.Command, cases []Case, opts ...general.CallOption) Report {
+	targets := cmd.Targets()
+	var report Report
+	for i, c := range cases {
+		var outcomes []Outcome
+		for r := range cmd.Broadcast(ctx, c.request(), opts...) {
+			outcomes = append(outcomes, newOutcome(i, c, r))
+		}
+		report.Outcomes = append(report.Outcomes, inTargetOrder(targets, outcomes)...)
+	}
+	return report
+}
+
+// inTargetOrder sorts outcomes, which arrive as targets respond, into the
+// order of targets.
+func inTargetOrder(targets []general.Target, outcomes []Outcome) []Outcome {
+	sorted := make([]Outcome, 0, len(outcomes))
+	taken := make([]bool, len(outcomes))
+	for _, t := range targets {
+		for i, o := range outcomes {
+			if !taken[i] && o.Target.Provider.Endpoint == t.Provider.Endpoint && o.Target.Model == t.Model {
+				taken[i] = true
+				sorted = append(sorted, o)
+				break
+			}
+		}
+	}
+	return sorted
+}
+
+// Passed reports whether every outcome passed.
+func (r Report) Passed() bool {
+	for _, o := range r.Outcomes {
+		if !o.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// TargetSummary counts the cases a target passed and failed.
+type TargetSummary struct {
+	Target         general.Target
+	Passed, Failed int
+}
+
+// Summary returns the pass and fail counts per target, in first-seen order.
+func (r Report) Summary() []TargetSummary {
+	var summaries []TargetSummary
+	index := map[string]int{}
+	for _, o := range r.Outcomes {
+		key := targetName(o.Target)
+		i, ok := index[key]
+		if !ok {
+			i = len(summaries)
+			index[key] = i
+			summaries = append(summaries, TargetSummary{Target: o.Target})
+		}
+		if o.Passed() {
+			summaries[i].Passed++
+		} else {
+			summaries[i].Failed++
+		}
+	}
+	return summaries
+}
+
+// Write prints the failures of r followed by a pass/fail table per target.
+func (r Report) Write(w io.Writer) error {
+	for _, o := range r.Outcomes {
+		for _, f := range o.Failures {
+			if _, err := fmt.Fprintf(w, "FAIL %s [%s] %s: %v\n", o.Case, targetName(o.Target), f.Assertion, f.Err); err != nil {
+				return err
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tPASSED\tFAILED")
+	for _, s := range r.Summary() {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", targetName(s.Target), s.Passed, s.Failed)
+	}
+	return tw.Flush()
+}
+
+// targetName labels t as provider:model.
+func targetName(t general.Target) string {
+	return providerName(t) + ":" + t.Model
+}
+
+// providerName names the provider of t, or gives its endpoint.
+func providerName(t general.Target) string {
+	if name := t.Provider.Name(); name != "" {
+		return name
+	}
+	return t.Provider.Endpoint
+}
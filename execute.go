@@ -4,78 +4,142 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 )
 
-const (
-	maxRetries = 3
-	baseDelay  = time.Second
-)
-
 // Execute fires parallel requests to all configured targets.
 // Results are streamed into the returned channel as each target responds.
 // The channel is closed when all targets have responded.
-func (c *Command) Execute(req ChatCompletionRequest) <-chan Result {
-	results := make(chan Result, len(c.targets))
+func (c *Command) Execute(req ChatCompletionRequest, opts ...CallOption) <-chan Result {
+	cfg := newCallConfig(opts)
+	return c.executeTargets(context.Background(), c.callTargets(cfg), req, cfg)
+}
+
+// executeTargets fires parallel requests to targets, streaming results as they arrive.
+func (c *Command) executeTargets(ctx context.Context, targets []Target, req ChatCompletionRequest, cfg callConfig) <-chan Result {
+	results := make(chan Result, len(targets))
+	ctx, cancelCall := withCallConfig(ctx, cfg)
 
 	c.log(slog.LevelDebug, "starting parallel requests",
-		"targets", len(c.targets),
+		"targets", len(targets),
 	)
 
-	var wg sync.WaitGroup
-	for _, target := range c.targets {
-		wg.Add(1)
-		go func(t Target) {
-			defer wg.Done()
-			c.executeAndSend(t, req, results)
-		}(target)
-	}
-
 	go func() {
-		wg.Wait()
-		close(results)
+		defer close(results)
+		defer cancelCall()
+		requestCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Buffered so that targets cut off by the deadline never block.
+		done := make(chan indexedResult, len(targets))
+		for i, target := range targets {
+			go func() {
+				done <- indexedResult{i, c.executeAndLog(requestCtx, target, req)}
+			}()
+		}
+
+		var cutoff <-chan struct{}
+		if cfg.partial {
+			cutoff = ctx.Done()
+		}
+		pending := make([]bool, len(targets))
+		for i := range pending {
+			pending[i] = true
+		}
+		for range targets {
+			select {
+			case r := <-done:
+				pending[r.index] = false
+				if r.result.Error == nil && cfg.cancelOnFirst {
+					cancel()
+				} else if r.result.Error != nil && requestCtx.Err() != nil && ctx.Err() == nil {
+					r.result.Error = ErrSuperseded
+				}
+				results <- r.result
+			case <-cutoff:
+				err := contextError(ctx)
+				for i, t := range targets {
+					if pending[i] {
+						results <- Result{Target: t, Error: err}
+					}
+				}
+				c.log(slog.LevelDebug, "stopped waiting for targets", "error", err.Error())
+				return
+			}
+		}
 		c.log(slog.LevelDebug, "all targets completed")
 	}()
 
 	return results
 }
 
+// indexedResult is a result with the position of its target.
+type indexedResult struct {
+	index  int
+	result Result
+}
+
 // ExecuteOne sends a request to the first configured target and blocks until complete.
 // Useful for simple cases and debugging.
 func (c *Command) ExecuteOne(req ChatCompletionRequest) (ChatCompletionResponse, error) {
 	if len(c.targets) == 0 {
 		return ChatCompletionResponse{}, fmt.Errorf("no targets configured")
 	}
-	return c.executeTarget(c.targets[0], req)
+	return c.executeTarget(context.Background(), c.targets[0], req)
 }
 
 // executeTarget sends a request to a specific target.
-func (c *Command) executeTarget(target Target, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+func (c *Command) executeTarget(ctx context.Context, target Target, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	target, err := DefaultAliases.ResolveTarget(target)
+	if err != nil {
+		return ChatCompletionResponse{}, err
+	}
 	req.Model = target.Model
+	return c.chain(c.send)(ctx, Call{Target: target, Request: req})
+}
+
+// executeResult sends req to target and returns the outcome as a Result.
+func (c *Command) executeResult(ctx context.Context, target Target, req ChatCompletionRequest) Result {
+	start := time.Now()
+	resp, err := c.executeTarget(ctx, target, req)
+	return Result{Target: target, Response: resp, Error: err, Duration: time.Since(start)}
+}
 
-	requestBody, err := json.Marshal(req)
+// send is the innermost Handler of plain requests.
+func (c *Command) send(ctx context.Context, call Call) (ChatCompletionResponse, error) {
+	body, err := call.body()
 	if err != nil {
-		return ChatCompletionResponse{}, fmt.Errorf("failed to marshal request: %w", err)
+		return ChatCompletionResponse{}, err
 	}
 
 	c.log(slog.LevelDebug, "sending request",
-		"endpoint", target.Provider.Endpoint,
-		"model", target.Model,
+		"endpoint", call.Target.Provider.Endpoint,
+		"model", call.Target.Model,
 	)
-
-	return c.executeWithRetry(target, requestBody)
+	return c.executeWithRetry(ctx, call.Target, body)
 }
 
-func (c *Command) executeAndSend(target Target, req ChatCompletionRequest, results chan<- Result) {
+// executeAndLog sends req to target and logs the outcome.
+func (c *Command) executeAndLog(ctx context.Context, target Target, req ChatCompletionRequest) Result {
 	start := time.Now()
 
-	resp, err := c.executeTarget(target, req)
+	var resp ChatCompletionResponse
+	var err error
+	if schema := callOptions(ctx).schema; schema != nil {
+		// Corrections change the prompt, so usage is not observed.
+		resp, err = c.executeWithSchema(ctx, target, req, schema)
+	} else {
+		resp, err = c.executeTarget(ctx, target, req)
+		if err == nil {
+			DefaultTokenizers.observeUsage(target.Model, req, resp.Usage)
+		}
+	}
 	duration := time.Since(start)
 
 	result := Result{
@@ -85,8 +149,6 @@ func (c *Command) executeAndSend(target Target, req ChatCompletionRequest, resul
 		Duration: duration,
 	}
 
-	results <- result
-
 	if err != nil {
 		c.log(slog.LevelWarn, "target failed",
 			"endpoint", target.Provider.Endpoint,
@@ -101,18 +163,36 @@ func (c *Command) executeAndSend(target Target, req ChatCompletionRequest, resul
 			"duration", duration,
 		)
 	}
+	return result
 }
 
-func (c *Command) executeWithRetry(target Target, requestBody []byte) (ChatCompletionResponse, error) {
+func (c *Command) executeWithRetry(ctx context.Context, target Target, requestBody []byte) (ChatCompletionResponse, error) {
 	var lastErr error
-
-	for attempt := range maxRetries {
-		result, err := c.executeSingleRequest(target, requestBody)
+	var lastResp ChatCompletionResponse
+	attempts := 0
+	policy := c.retryPolicy(ctx)
+
+	for attempt := range policy.MaxAttempts {
+		attempts++
+		if attempt > 0 {
+			c.stats.retry(target)
+		}
+		if err := c.waitRateLimit(ctx, target.Provider); err != nil {
+			return ChatCompletionResponse{}, err
+		}
+		keyed := target
+		keyed.Provider = c.selectKey(target.Provider)
+		attemptCtx, endSpan := c.startAttempt(ctx, target, attempt, false)
+		result, err := c.executeSingleRequest(attemptCtx, keyed, requestBody)
+		if err == nil && callOptions(ctx).checkResponse {
+			err = CheckResponse(result)
+		}
+		endSpan(result, err)
 		if err == nil {
 			return result, nil
 		}
 
-		lastErr = err
+		lastErr, lastResp = err, result
 		c.log(slog.LevelWarn, "request attempt failed",
 			"endpoint", target.Provider.Endpoint,
 			"model", target.Model,
@@ -120,32 +200,63 @@ func (c *Command) executeWithRetry(target Target, requestBody []byte) (ChatCompl
 			"error", err.Error(),
 		)
 
-		if attempt == maxRetries-1 {
+		if attempt == policy.MaxAttempts-1 {
 			break
 		}
 
-		if !shouldRetry(err) {
+		// A rate-limited key is retried at once with another key from the pool.
+		rotated := c.rotateOnRateLimit(target.Provider, keyed.Provider.APIKey, err)
+		if !rotated && !retryable(ctx, err) {
+			break
+		}
+		if !allowRetry(ctx) {
+			c.log(slog.LevelWarn, "retry budget exhausted",
+				"endpoint", target.Provider.Endpoint,
+				"model", target.Model,
+			)
 			break
 		}
+		if rotated {
+			continue
+		}
 
-		time.Sleep(time.Duration(1<<uint(attempt)) * baseDelay)
+		select {
+		case <-ctx.Done():
+			return ChatCompletionResponse{}, fmt.Errorf("request to %s/%s aborted: %w", target.Provider.Endpoint, target.Model, ctx.Err())
+		case <-time.After(retryDelay(policy, attempt, err)):
+		}
 	}
 
-	return ChatCompletionResponse{}, fmt.Errorf("request to %s/%s failed after %d attempts: %w", target.Provider.Endpoint, target.Model, maxRetries, lastErr)
+	return lastResp, fmt.Errorf("request to %s/%s failed after %d attempts: %w", target.Provider.Endpoint, target.Model, attempts, lastErr)
 }
 
-func (c *Command) executeSingleRequest(target Target, requestBody []byte) (ChatCompletionResponse, error) {
-	httpReq, err := http.NewRequestWithContext(context.Background(), "POST", target.Provider.Endpoint, bytes.NewBuffer(requestBody))
+func (c *Command) executeSingleRequest(ctx context.Context, target Target, requestBody []byte) (ChatCompletionResponse, error) {
+	// Time queued for a slot does not count towards the request timeout.
+	release, err := c.acquireSlot(ctx)
+	if err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	defer release()
+	ctx, cancel := c.requestContext(ctx, false)
+	defer cancel()
+	ctx, trace := traceRequest(ctx)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", requestURL(target, false), bytes.NewBuffer(requestBody))
 	if err != nil {
 		return ChatCompletionResponse{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+target.Provider.APIKey)
+	target.Provider.setHeaders(httpReq.Header)
+	setCallHeaders(ctx, httpReq.Header)
+	setTraceHeaders(ctx, httpReq.Header)
 
-	httpResp, err := c.client.Do(httpReq)
+	client, err := c.httpClient(target.Provider)
 	if err != nil {
-		return ChatCompletionResponse{}, fmt.Errorf("HTTP request failed: %w", err)
+		return ChatCompletionResponse{}, err
+	}
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return ChatCompletionResponse{}, fmt.Errorf("HTTP request failed: %w", timeoutCause(ctx, err))
 	}
 	defer httpResp.Body.Close()
 
@@ -154,17 +265,21 @@ func (c *Command) executeSingleRequest(target Target, requestBody []byte) (ChatC
 		if httpResp.Body != nil {
 			responseBody, _ = io.ReadAll(httpResp.Body)
 		}
-		return ChatCompletionResponse{}, fmt.Errorf("API request failed with status %d: %s", httpResp.StatusCode, string(responseBody))
+		return ChatCompletionResponse{}, c.responseError(httpResp, responseBody)
 	}
 
-	var response ChatCompletionResponse
-	if err := json.NewDecoder(httpResp.Body).Decode(&response); err != nil {
-		return ChatCompletionResponse{}, fmt.Errorf("failed to decode response: %w", err)
+	response, err := decodeResponse(target, httpResp.Body)
+	if err != nil {
+		if errors.Is(context.Cause(ctx), ErrRequestTimeout) {
+			return ChatCompletionResponse{}, fmt.Errorf("HTTP request failed: %w", ErrRequestTimeout)
+		}
+		return ChatCompletionResponse{}, err
 	}
 
 	if len(response.Choices) == 0 {
 		return ChatCompletionResponse{}, fmt.Errorf("no choices in response")
 	}
+	response.Timing = trace.timing()
 
 	c.log(slog.LevelDebug, "request successful",
 		"endpoint", target.Provider.Endpoint,
@@ -175,7 +290,66 @@ func (c *Command) executeSingleRequest(target Target, requestBody []byte) (ChatC
 	return response, nil
 }
 
+// marshalRequest encodes req according to the API mode of target's provider.
+func marshalRequest(target Target, req ChatCompletionRequest) ([]byte, error) {
+	switch {
+	case target.Provider.TextCompletion:
+		return marshalTextCompletion(req)
+	case target.Provider.GeminiNative:
+		return marshalGeminiNative(target, req)
+	default:
+		return buildRequestBody(target, req)
+	}
+}
+
+// requestURL returns the URL requests to target are sent to.
+func requestURL(target Target, stream bool) string {
+	if target.Provider.GeminiNative {
+		return geminiURL(target.Provider, target.Model, stream)
+	}
+	return target.Provider.Endpoint
+}
+
+// decodeResponse reads a provider response body according to the provider's API mode.
+func decodeResponse(target Target, body io.Reader) (ChatCompletionResponse, error) {
+	switch {
+	case target.Provider.TextCompletion:
+		return decodeTextCompletion(body)
+	case target.Provider.GeminiNative:
+		return decodeGeminiNative(body)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return ChatCompletionResponse{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	var response ChatCompletionResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return ChatCompletionResponse{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if target.Provider.Name() == ProviderGroq {
+		response.Diagnostics = groqDiagnostics(data)
+	}
+	return response, nil
+}
+
+// retryDelay returns how long to wait before retrying an attempt that
+// failed with err: the Retry-After delay of the provider if it gave one,
+// and otherwise the exponential backoff of policy.
+func retryDelay(policy RetryPolicy, attempt int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
+	return time.Duration(1<<uint(attempt)) * policy.BaseDelay
+}
+
 func shouldRetry(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
 	errStr := err.Error()
 
 	if strings.Contains(errStr, "HTTP request failed") {
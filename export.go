@@ -0,0 +1,183 @@
+package general
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// conversationFormat is the version of the JSON conversation format.
+const conversationFormat = 1
+
+// Provenance records who produced an assistant reply and how long it took.
+type Provenance struct {
+	Provider string        `json:"provider"`
+	Model    string        `json:"model"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration_ns"`
+	Usage    *Usage        `json:"usage,omitempty"`
+	Cached   bool          `json:"cached,omitempty"`
+}
+
+// newProvenance describes resp, received from target for a request sent at start.
+func newProvenance(target Target, resp ChatCompletionResponse, start time.Time) *Provenance {
+	if resolved, err := DefaultAliases.ResolveTarget(target); err == nil {
+		target = resolved
+	}
+	provider := target.Provider.Name()
+	if provider == "" {
+		provider = target.Provider.Endpoint
+	}
+	return &Provenance{
+		Provider: provider,
+		Model:    target.Model,
+		Time:     start,
+		Duration: time.Since(start),
+		Usage:    resp.Usage,
+		Cached:   resp.Cached,
+	}
+}
+
+// exportedConversation is the canonical JSON form of a Conversation.
+type exportedConversation struct {
+	Format   int               `json:"format"`
+	Messages []exportedMessage `json:"messages"`
+}
+
+// exportedMessage is a message with the fields that are not sent to
+// providers, and its content always as a string or a list of parts.
+type exportedMessage struct {
+	Role       Role          `json:"role"`
+	Content    string        `json:"content,omitempty"`
+	Parts      []ContentPart `json:"parts,omitempty"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
+	Reasoning  string        `json:"reasoning,omitempty"`
+	Refusal    string        `json:"refusal,omitempty"`
+	Provenance *Provenance   `json:"provenance,omitempty"`
+}
+
+// ExportJSON writes the conversation, with reasoning and the provenance of
+// replies, in a canonical JSON format that ImportConversation reads back.
+func (c *Conversation) ExportJSON(w io.Writer) error {
+	out := exportedConversation{Format: conversationFormat, Messages: make([]exportedMessage, len(c.Messages))}
+	for i, m := range c.Messages {
+		out.Messages[i] = exportedMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			Parts:      m.Parts,
+			ToolCalls:  m.ToolCalls,
+			ToolCallID: m.ToolCallID,
+			Reasoning:  m.Reasoning,
+			Refusal:    m.Refusal,
+			Provenance: m.Provenance,
+		}
+		if len(m.Parts) > 0 {
+			out.Messages[i].Content = ""
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return fmt.Errorf("failed to export conversation: %w", err)
+	}
+	return nil
+}
+
+// ImportConversation reads a conversation written by ExportJSON.
+func ImportConversation(r io.Reader) (*Conversation, error) {
+	var in exportedConversation
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, fmt.Errorf("failed to import conversation: %w", err)
+	}
+	if in.Format != conversationFormat {
+		return nil, fmt.Errorf("unsupported conversation format %d", in.Format)
+	}
+	conv := &Conversation{Messages: make([]ChatCompletionMessage, len(in.Messages))}
+	for i, m := range in.Messages {
+		conv.Messages[i] = ChatCompletionMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			Parts:      m.Parts,
+			ToolCalls:  m.ToolCalls,
+			ToolCallID: m.ToolCallID,
+			Reasoning:  m.Reasoning,
+			Refusal:    m.Refusal,
+			Provenance: m.Provenance,
+		}
+		if len(m.Parts) > 0 {
+			conv.Messages[i].Content = conv.Messages[i].Text()
+		}
+	}
+	return conv, nil
+}
+
+// ExportMarkdown writes the conversation as Markdown for sharing: a section
+// per message, headed by its role and, for replies, the model that answered
+// and its timing, with tool calls and results as code blocks.
+func (c *Conversation) ExportMarkdown(w io.Writer) error {
+	blocks := []string{"# Conversation"}
+	for _, m := range c.Messages {
+		blocks = append(blocks, "## "+markdownHeading(m))
+		if m.Reasoning != "" {
+			blocks = append(blocks, "<details>\n<summary>Reasoning</summary>\n\n"+m.Reasoning+"\n\n</details>")
+		}
+		switch {
+		case m.Role == RoleTool:
+			blocks = append(blocks, fence(m.Text(), ""))
+		case m.Refusal != "":
+			blocks = append(blocks, "> Refused: "+m.Refusal)
+		default:
+			for _, p := range m.Parts {
+				if p.Type == "image_url" && p.ImageURL != nil && !strings.HasPrefix(p.ImageURL.URL, "data:") {
+					blocks = append(blocks, fmt.Sprintf("![image](%s)", p.ImageURL.URL))
+				}
+			}
+			if text := m.Text(); text != "" {
+				blocks = append(blocks, text)
+			}
+		}
+		for _, call := range m.ToolCalls {
+			blocks = append(blocks, fmt.Sprintf("Tool call `%s` (%s):", call.Function.Name, call.ID), fence(call.Function.Arguments, "json"))
+		}
+	}
+	if _, err := io.WriteString(w, strings.Join(blocks, "\n\n")+"\n"); err != nil {
+		return fmt.Errorf("failed to export conversation: %w", err)
+	}
+	return nil
+}
+
+// markdownHeading returns the section heading of m.
+func markdownHeading(m ChatCompletionMessage) string {
+	role := string(m.Role)
+	if role != "" {
+		role = strings.ToUpper(role[:1]) + role[1:]
+	}
+	if m.Role == RoleTool {
+		return fmt.Sprintf("Tool result (%s)", m.ToolCallID)
+	}
+	p := m.Provenance
+	if p == nil {
+		return role
+	}
+	details := []string{p.Provider + ":" + p.Model, p.Time.Format(time.DateTime), p.Duration.Round(time.Millisecond).String()}
+	if p.Usage != nil {
+		details = append(details, fmt.Sprintf("%d tokens", p.Usage.TotalTokens))
+	}
+	if p.Cached {
+		details = append(details, "cached")
+	}
+	return role + " · " + strings.Join(details, " · ")
+}
+
+// fence wraps text in a code block whose fence is longer than any backtick
+// run inside it.
+func fence(text, lang string) string {
+	ticks := "```"
+	for strings.Contains(text, ticks) {
+		ticks += "`"
+	}
+	return ticks + lang + "\n" + text + "\n" + ticks
+}
@@ -0,0 +1,118 @@
+package general
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// requestAlias and choiceAlias have the fields of their types without the JSON methods.
+type (
+	requestAlias ChatCompletionRequest
+	choiceAlias  ChatCompletionChoice
+)
+
+var (
+	requestFields = jsonFieldNames(reflect.TypeOf(requestAlias{}))
+	choiceFields  = jsonFieldNames(reflect.TypeOf(choiceAlias{}))
+)
+
+// MarshalJSON encodes the request with Extra merged into the top-level object.
+// Extra entries override typed fields with the same name.
+func (r ChatCompletionRequest) MarshalJSON() ([]byte, error) {
+	return marshalWithExtra(requestAlias(r), r.Extra)
+}
+
+// UnmarshalJSON decodes the request, collecting unknown fields into Extra.
+func (r *ChatCompletionRequest) UnmarshalJSON(data []byte) error {
+	extra, err := unmarshalWithExtra(data, (*requestAlias)(r), requestFields)
+	if err != nil {
+		return err
+	}
+	if len(extra) > 0 {
+		r.Extra = make(map[string]any, len(extra))
+		for k, v := range extra {
+			var value any
+			if err := json.Unmarshal(v, &value); err != nil {
+				return err
+			}
+			r.Extra[k] = value
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the choice with Raw merged back into the object.
+func (c ChatCompletionChoice) MarshalJSON() ([]byte, error) {
+	extra := make(map[string]any, len(c.Raw))
+	for k, v := range c.Raw {
+		extra[k] = v
+	}
+	return marshalWithExtra(choiceAlias(c), extra)
+}
+
+// UnmarshalJSON decodes the choice, collecting unknown fields into Raw.
+func (c *ChatCompletionChoice) UnmarshalJSON(data []byte) error {
+	extra, err := unmarshalWithExtra(data, (*choiceAlias)(c), choiceFields)
+	if err != nil {
+		return err
+	}
+	if len(extra) > 0 {
+		c.Raw = extra
+	}
+	return nil
+}
+
+func marshalWithExtra(v any, extra map[string]any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	body := requestBody{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	if err := body.merge(extra); err != nil {
+		return nil, err
+	}
+	return json.Marshal(body)
+}
+
+func unmarshalWithExtra(data []byte, v any, known map[string]bool) (map[string]json.RawMessage, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name := range fields {
+		if known[name] {
+			delete(fields, name)
+		}
+	}
+	return fields, nil
+}
+
+// jsonFieldNames returns the JSON names of the exported, non-ignored fields of t.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		names[name] = true
+	}
+	return names
+}
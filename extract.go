@@ -0,0 +1,111 @@
+package general
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ExtractJSON returns the JSON document in a model reply. It accepts bare
+// JSON, JSON in markdown code fences (preferring ones tagged json) and JSON
+// surrounded by prose, as models tend to wrap their output.
+func ExtractJSON(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if json.Valid([]byte(text)) {
+		return text, nil
+	}
+
+	blocks := fencedBlocks(text)
+	for _, tagged := range []bool{true, false} {
+		for _, b := range blocks {
+			if b.json == tagged && json.Valid([]byte(b.body)) {
+				return b.body, nil
+			}
+		}
+	}
+
+	for start := 0; start < len(text); start++ {
+		if text[start] != '{' && text[start] != '[' {
+			continue
+		}
+		if end := matchingBracket(text, start); end > 0 && json.Valid([]byte(text[start:end])) {
+			return text[start:end], nil
+		}
+	}
+	return "", fmt.Errorf("no JSON found in reply")
+}
+
+// DecodeJSON extracts the JSON of the first choice of resp and unmarshals it into v.
+func DecodeJSON(resp ChatCompletionResponse, v any) error {
+	if len(resp.Choices) == 0 {
+		return fmt.Errorf("no choices in response")
+	}
+	data, err := ExtractJSON(resp.Choices[0].Message.Text())
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return fmt.Errorf("failed to decode reply: %w", err)
+	}
+	return nil
+}
+
+type fencedBlock struct {
+	body string
+	json bool
+}
+
+// fencedBlocks returns the bodies of the ``` code blocks in text.
+func fencedBlocks(text string) []fencedBlock {
+	var blocks []fencedBlock
+	for {
+		start := strings.Index(text, "```")
+		if start < 0 {
+			return blocks
+		}
+		rest := text[start+3:]
+		nl := strings.IndexByte(rest, '\n')
+		if nl < 0 {
+			return blocks
+		}
+		lang := strings.ToLower(strings.TrimSpace(rest[:nl]))
+		body := rest[nl+1:]
+		end := strings.Index(body, "```")
+		if end < 0 {
+			// An unterminated fence, as in truncated replies, runs to the end.
+			end = len(body)
+		}
+		blocks = append(blocks, fencedBlock{body: strings.TrimSpace(body[:end]), json: lang == "json" || lang == "jsonc"})
+		if end == len(body) {
+			return blocks
+		}
+		text = body[end+3:]
+	}
+}
+
+// matchingBracket returns the index just past the bracket closing the one at
+// text[start], skipping brackets inside strings, or -1 if it is unclosed.
+func matchingBracket(text string, start int) int {
+	depth := 0
+	inString, escaped := false, false
+	for i := start; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && ch == '\\':
+			escaped = true
+		case ch == '"':
+			inString = !inString
+		case inString:
+		case ch == '{' || ch == '[':
+			depth++
+		case ch == '}' || ch == ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,194 @@
+package general
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ErrorClass groups request errors by how a fallback chain reacts to them.
+type ErrorClass int
+
+const (
+	// ErrorTransient covers network errors, rate limits and 5xx responses.
+	ErrorTransient ErrorClass = iota
+	// ErrorModelUnavailable covers unknown and decommissioned models.
+	ErrorModelUnavailable
+	// ErrorContentFilter covers requests or responses rejected by moderation.
+	ErrorContentFilter
+	// ErrorRefusal covers refusals and empty responses, reported with
+	// WithResponseChecks.
+	ErrorRefusal
+	// ErrorPermanent covers every other error, such as invalid requests or keys.
+	ErrorPermanent
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorTransient:
+		return "transient"
+	case ErrorModelUnavailable:
+		return "model unavailable"
+	case ErrorContentFilter:
+		return "content filter"
+	case ErrorRefusal:
+		return "refusal"
+	default:
+		return "permanent"
+	}
+}
+
+// FailoverAction is what a fallback chain does after an error of some class.
+type FailoverAction int
+
+const (
+	// Retry retries the target under the retry policy, then moves on to the
+	// next target. Outside a fallback chain, only transient errors are retried.
+	Retry FailoverAction = iota
+	// Failover moves on to the next target without retrying.
+	Failover
+	// Abort stops the chain and returns the error.
+	Abort
+)
+
+// FallbackPolicy maps error classes to the action taken by ExecuteFallback.
+// Classes missing from the map are aborted on.
+type FallbackPolicy map[ErrorClass]FailoverAction
+
+// action returns the action for class, defaulting to Abort.
+func (p FallbackPolicy) action(class ErrorClass) FailoverAction {
+	if action, ok := p[class]; ok {
+		return action
+	}
+	return Abort
+}
+
+// DefaultFallbackPolicy retries transient errors, fails over at once when
+// the model is unavailable, the content was filtered or refused, and aborts on
+// anything else, since another target would most likely fail the same way.
+var DefaultFallbackPolicy = FallbackPolicy{
+	ErrorTransient:        Retry,
+	ErrorModelUnavailable: Failover,
+	ErrorContentFilter:    Failover,
+	ErrorRefusal:          Failover,
+	ErrorPermanent:        Abort,
+}
+
+// ClassifyError returns the class of an error returned for a request.
+func ClassifyError(err error) ErrorClass {
+	switch {
+	case errors.Is(err, ErrContentFiltered):
+		return ErrorContentFilter
+	case errors.Is(err, ErrRefusal), errors.Is(err, ErrEmptyResponse):
+		return ErrorRefusal
+	}
+	if class, ok := apiErrorClass(err); ok {
+		return class
+	}
+	if shouldRetry(err) {
+		return ErrorTransient
+	}
+	return ErrorPermanent
+}
+
+// apiErrorClass classifies provider errors whose code or message says the
+// target cannot serve the request.
+func apiErrorClass(err error) (ErrorClass, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return 0, false
+	}
+	message := strings.ToLower(apiErr.Message)
+	switch {
+	case apiErr.HasCode(ErrorCodeModelNotFound), apiErr.HasCode(ErrorCodeModelDecommissioned),
+		strings.Contains(message, "decommissioned"), strings.Contains(message, "not a valid model"):
+		return ErrorModelUnavailable, true
+	case apiErr.HasCode(ErrorCodeContentFilter), apiErr.HasCode("content_policy_violation"),
+		strings.Contains(message, "flagged"), strings.Contains(message, "moderation"):
+		return ErrorContentFilter, true
+	}
+	return 0, false
+}
+
+// WithFallbackPolicy sets the policy of ExecuteFallback. The default is
+// DefaultFallbackPolicy.
+func WithFallbackPolicy(policy FallbackPolicy) Option {
+	return func(c *Command) {
+		c.fallback = policy
+	}
+}
+
+// ExecuteFallback sends req to the configured targets in order until one
+// succeeds, reacting to each error as the fallback policy of its class
+// says. It returns the first successful result, or the last failed one with
+// the errors of every target tried.
+func (c *Command) ExecuteFallback(ctx context.Context, req ChatCompletionRequest, opts ...CallOption) Result {
+	return c.executeFallback(ctx, c.callTargets(newCallConfig(opts)), req, opts)
+}
+
+// executeFallback is ExecuteFallback over targets.
+func (c *Command) executeFallback(ctx context.Context, targets []Target, req ChatCompletionRequest, opts []CallOption) Result {
+	if len(targets) == 0 {
+		return Result{Error: fmt.Errorf("no targets configured")}
+	}
+	cfg := newCallConfig(opts)
+	cfg.fallback = c.fallbackPolicy()
+	ctx, cancel := withCallConfig(ctx, cfg)
+	defer cancel()
+	start := time.Now()
+	var errs []error
+	var result Result
+	for i, target := range targets {
+		result = c.executeAndLog(ctx, target, req)
+		if result.Error == nil || ctx.Err() != nil {
+			break
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", target.Model, result.Error))
+
+		class := ClassifyError(result.Error)
+		if cfg.fallback.action(class) == Abort || i == len(targets)-1 {
+			break
+		}
+		c.log(slog.LevelWarn, "failing over to next target",
+			"model", target.Model,
+			"class", class.String(),
+			"next", targets[i+1].Model,
+		)
+	}
+
+	result.Duration = time.Since(start)
+	if result.Error != nil && len(errs) > 1 {
+		result.Error = fmt.Errorf("%d targets failed: %w", len(errs), errors.Join(errs...))
+	}
+	return result
+}
+
+// fallbackPolicy returns the fallback policy of the Command, or the default.
+func (c *Command) fallbackPolicy() FallbackPolicy {
+	if c.fallback == nil {
+		return DefaultFallbackPolicy
+	}
+	return c.fallback
+}
+
+// maxRetryAfter is the longest Retry-After delay waited out before a
+// retry. Rate limits asking for longer fail at once, so that a fallback
+// chain can move on to another target.
+const maxRetryAfter = time.Minute
+
+// retryable reports whether a failed attempt may be retried on the same
+// target: per the fallback policy of the call if it has one, and for
+// transient errors otherwise.
+func retryable(ctx context.Context, err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > maxRetryAfter {
+		return false
+	}
+	if policy := callOptions(ctx).fallback; policy != nil {
+		return policy.action(ClassifyError(err)) == Retry
+	}
+	return shouldRetry(err)
+}
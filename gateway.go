@@ -0,0 +1,703 @@
+package general
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxGatewayBody bounds the size of request bodies a Gateway accepts.
+const maxGatewayBody = 32 << 20
+
+// GatewayPolicy decides how a Gateway spreads a request over the targets of
+// its route.
+type GatewayPolicy int
+
+const (
+	// PolicyFallback tries the targets in order, moving on as the
+	// Command's FallbackPolicy allows.
+	PolicyFallback GatewayPolicy = iota
+	// PolicyRace sends the request to every target and answers with the
+	// first to succeed, or for streams the first to produce tokens.
+	PolicyRace
+	// PolicyBalance sends each request to one target, in proportion to
+	// the target weights.
+	PolicyBalance
+)
+
+var gatewayPolicyNames = [...]string{"fallback", "race", "balance"}
+
+func (p GatewayPolicy) String() string {
+	if int(p) < len(gatewayPolicyNames) {
+		return gatewayPolicyNames[p]
+	}
+	return fmt.Sprintf("GatewayPolicy(%d)", int(p))
+}
+
+// ParseGatewayPolicy returns the policy with the given name.
+func ParseGatewayPolicy(name string) (GatewayPolicy, error) {
+	for i, n := range gatewayPolicyNames {
+		if n == name {
+			return GatewayPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown gateway policy %q (available: %s)", name, strings.Join(gatewayPolicyNames[:], ", "))
+}
+
+// GatewayRoute is a set of targets that serve requests together under a
+// policy.
+type GatewayRoute struct {
+	Name   string
+	Policy GatewayPolicy
+	// Cache, when set, answers repeated identical requests to the route,
+	// streamed or not, without sending them upstream. Responses report
+	// HIT, MISS or BYPASS in the X-Cache header; clients bypass the cache
+	// with a Cache-Control: no-cache request header.
+	Cache Cache
+
+	targets  []Target
+	balancer *Balancer
+}
+
+// NewGatewayRoute creates a route over targets. Weights only matter to
+// PolicyBalance.
+func NewGatewayRoute(name string, policy GatewayPolicy, targets ...WeightedTarget) *GatewayRoute {
+	r := &GatewayRoute{Name: name, Policy: policy, balancer: NewBalancer(targets...)}
+	for _, t := range targets {
+		r.targets = append(r.targets, t.Target)
+	}
+	return r
+}
+
+// Targets returns the targets of the route.
+func (r *GatewayRoute) Targets() []Target {
+	return r.targets
+}
+
+// GatewayRule sends the requests for matching model names to a route.
+type GatewayRule struct {
+	// Model matches a requested model exactly, or every model it is a
+	// prefix of when it ends in "*".
+	Model string
+	// Pattern matches requested models as a regular expression. It is
+	// used when Model is empty.
+	Pattern *regexp.Regexp
+	Route   *GatewayRoute
+}
+
+// matches reports whether the rule applies to requests for model.
+func (r GatewayRule) matches(model string) bool {
+	switch {
+	case r.Model == "":
+		return r.Pattern != nil && r.Pattern.MatchString(model)
+	case strings.HasSuffix(r.Model, "*"):
+		return strings.HasPrefix(model, strings.TrimSuffix(r.Model, "*"))
+	default:
+		return model == r.Model
+	}
+}
+
+// gatewayRoutes is the routing table of a Gateway.
+type gatewayRoutes struct {
+	rules []GatewayRule
+	def   *GatewayRoute
+}
+
+// GatewayOption configures a Gateway.
+type GatewayOption func(*Gateway)
+
+// GatewayRecord describes a chat completion request served by a Gateway.
+type GatewayRecord struct {
+	// Client is the name of the API key of the request, or "" for an open
+	// gateway.
+	Client string
+	// Model is the model the client asked for and Route the route that
+	// served it, or "" if none did.
+	Model  string
+	Route  string
+	Stream bool
+	// Status is the HTTP status of the response.
+	Status int
+	// Result is the outcome of the request, which only reached a target
+	// when Route is set and Result.Response.Cached is not.
+	Result   Result
+	Duration time.Duration
+}
+
+// WithGatewayLog calls report after every chat completion request, e.g. to
+// write an access log.
+func WithGatewayLog(report func(GatewayRecord)) GatewayOption {
+	return func(g *Gateway) { g.report = report }
+}
+
+// WithGatewayRules routes requests by the model they ask for. The first
+// matching rule wins; requests no rule matches go to the default route.
+func WithGatewayRules(rules ...GatewayRule) GatewayOption {
+	return func(g *Gateway) {
+		g.routes.Store(&gatewayRoutes{rules: rules, def: g.routes.Load().def})
+	}
+}
+
+// Gateway serves an OpenAI-compatible API in front of a Command, so that
+// any OpenAI client can use several providers through one endpoint. It
+// handles POST /v1/chat/completions, streaming included, and GET
+// /v1/models, and names the model that answered in the X-General-Model
+// header. Requests go to the route of the first rule matching the model
+// they ask for, or else to the default route.
+type Gateway struct {
+	cmd    *Command
+	routes atomic.Pointer[gatewayRoutes]
+	mux    *http.ServeMux
+	report func(GatewayRecord)
+
+	mu    sync.Mutex
+	keys  gatewayKeys
+	usage map[string]*UsageSummary
+
+	budgetMu sync.Mutex
+	ledgers  map[string]*tenantLedger
+
+	drainMu  sync.Mutex
+	inflight int
+	draining bool
+	drained  chan struct{}
+}
+
+// NewGateway creates a gateway sending requests through cmd to the targets
+// of route by default. route may be nil if rules cover every model served.
+func NewGateway(cmd *Command, route *GatewayRoute, opts ...GatewayOption) *Gateway {
+	g := &Gateway{cmd: cmd, mux: http.NewServeMux()}
+	g.routes.Store(&gatewayRoutes{def: route})
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.mux.HandleFunc("POST /v1/chat/completions", g.handleChatCompletions)
+	g.mux.HandleFunc("GET /v1/models", g.handleModels)
+	g.mux.HandleFunc("GET /v1/usage", g.handleUsage)
+	return g
+}
+
+// SetRoutes replaces the default route and the rules, e.g. when the
+// configuration is reloaded. Requests already being served keep the route
+// they started with.
+func (g *Gateway) SetRoutes(route *GatewayRoute, rules ...GatewayRule) {
+	g.routes.Store(&gatewayRoutes{rules: rules, def: route})
+}
+
+// route returns the route serving requests for model, or nil.
+func (g *Gateway) route(model string) *GatewayRoute {
+	routes := g.routes.Load()
+	for _, rule := range routes.rules {
+		if rule.matches(model) {
+			return rule.Route
+		}
+	}
+	return routes.def
+}
+
+// ServeHTTP implements http.Handler.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !g.begin() {
+		w.Header().Set("Connection", "close")
+		writeGatewayError(w, http.StatusServiceUnavailable, "server_error", "shutting_down", "gateway is shutting down")
+		return
+	}
+	defer g.end()
+	client, ok := g.authenticate(r)
+	if !ok {
+		writeGatewayError(w, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "missing or invalid API key")
+		return
+	}
+	if client != nil {
+		ctx := context.WithValue(r.Context(), gatewayClientKey{}, client)
+		ctx = context.WithValue(ctx, gatewayChargeKey{}, func(result Result) { g.charge(client.name, result) })
+		r = r.WithContext(ctx)
+	}
+	g.mux.ServeHTTP(w, r)
+}
+
+// Drain makes the gateway refuse new requests with 503 and waits for the
+// requests in flight, streams included, to finish. It returns ctx.Err()
+// if ctx is done first; cancelling the contexts of the remaining requests,
+// e.g. through http.Server.BaseContext, and calling Drain again waits for
+// them to wind down. Use it with http.Server.Shutdown, which stops new
+// connections but does not wait for handlers once its context is done.
+func (g *Gateway) Drain(ctx context.Context) error {
+	g.drainMu.Lock()
+	g.draining = true
+	if g.inflight == 0 {
+		g.drainMu.Unlock()
+		return nil
+	}
+	if g.drained == nil {
+		g.drained = make(chan struct{})
+	}
+	drained := g.drained
+	g.drainMu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// InFlight returns the number of requests being served.
+func (g *Gateway) InFlight() int {
+	g.drainMu.Lock()
+	defer g.drainMu.Unlock()
+	return g.inflight
+}
+
+// begin counts a request in flight, unless the gateway is draining.
+func (g *Gateway) begin() bool {
+	g.drainMu.Lock()
+	defer g.drainMu.Unlock()
+	if g.draining {
+		return false
+	}
+	g.inflight++
+	return true
+}
+
+// end counts a request out, waking Drain after the last one.
+func (g *Gateway) end() {
+	g.drainMu.Lock()
+	defer g.drainMu.Unlock()
+	g.inflight--
+	if g.inflight == 0 && g.drained != nil {
+		close(g.drained)
+		g.drained = nil
+	}
+}
+
+// gatewayResponse is a ChatCompletionResponse with the fields OpenAI
+// clients expect around it.
+type gatewayResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	ChatCompletionResponse
+}
+
+// gatewayChunk is a ChatCompletionChunk with the fields OpenAI clients
+// expect around it.
+type gatewayChunk struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	ChatCompletionChunk
+}
+
+func (g *Gateway) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := GatewayRecord{Client: clientName(r.Context())}
+	defer func() {
+		rec.Duration = time.Since(start)
+		if rec.Route != "" && !rec.Result.Response.Cached {
+			g.account(rec.Client, rec.Result)
+		}
+		if g.report != nil {
+			g.report(rec)
+		}
+	}()
+	if !g.allowClient(w, r) || !g.checkBudget(w, r) {
+		rec.Status = http.StatusTooManyRequests
+		return
+	}
+
+	var req ChatCompletionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGatewayBody)).Decode(&req); err != nil {
+		rec.Status = http.StatusBadRequest
+		writeGatewayError(w, rec.Status, "invalid_request_error", "", fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	rec.Model = req.Model
+	if len(req.Messages) == 0 {
+		rec.Status = http.StatusBadRequest
+		writeGatewayError(w, rec.Status, "invalid_request_error", "", "messages must not be empty")
+		return
+	}
+	stream, _ := req.Extra["stream"].(bool)
+	rec.Stream = stream
+	// The gateway sets stream options itself when it streams from a target.
+	delete(req.Extra, "stream")
+	delete(req.Extra, "stream_options")
+
+	route := g.route(req.Model)
+	if route == nil {
+		rec.Status = http.StatusNotFound
+		writeGatewayError(w, rec.Status, "invalid_request_error", "model_not_found", fmt.Sprintf("no route for model %q", req.Model))
+		return
+	}
+	rec.Route = route.Name
+	g.cmd.log(slog.LevelDebug, "gateway request",
+		"client", rec.Client,
+		"model", req.Model,
+		"route", route.Name,
+		"policy", route.Policy.String(),
+		"stream", stream,
+	)
+	requested := req.Model
+	req.Model = ""
+	id := completionID()
+
+	var key string
+	if route.Cache != nil {
+		key = gatewayCacheKey(route, req)
+		if r.Header.Get("Cache-Control") == "no-cache" {
+			w.Header().Set("X-Cache", "BYPASS")
+		} else if resp, ok := route.Cache.Get(key); ok {
+			w.Header().Set("X-Cache", "HIT")
+			resp.Cached = true
+			rec.Result = Result{Response: resp}
+			if stream {
+				rec.Status, _ = g.stream(w, id, requested, func(send func(Target, ChatCompletionChunk)) Result {
+					send(Target{}, responseChunk(resp))
+					return rec.Result
+				})
+			} else {
+				rec.Status = http.StatusOK
+				writeGatewayResponse(w, id, requested, rec.Result)
+			}
+			return
+		} else {
+			w.Header().Set("X-Cache", "MISS")
+		}
+	}
+
+	if stream {
+		rec.Status, rec.Result = g.stream(w, id, requested, func(send func(Target, ChatCompletionChunk)) Result {
+			return g.cmd.streamRoute(r.Context(), route, req, send)
+		})
+	} else {
+		rec.Result = g.cmd.completeRoute(r.Context(), route, req)
+		if rec.Result.Error != nil {
+			rec.Status = g.writeError(w, rec.Result.Error)
+		} else {
+			rec.Status = http.StatusOK
+			writeGatewayResponse(w, id, requested, rec.Result)
+		}
+	}
+	if key != "" && rec.Result.Error == nil {
+		route.Cache.Set(key, rec.Result.Response)
+	}
+}
+
+// gatewayCacheKey identifies req sent to route.
+func gatewayCacheKey(route *GatewayRoute, req ChatCompletionRequest) string {
+	body, _ := json.Marshal(req)
+	return cacheKey(Target{Provider: Provider{Endpoint: "gateway:" + route.Name}}, body)
+}
+
+// writeGatewayResponse answers with the response of result. Responses
+// from the cache name the requested model.
+func writeGatewayResponse(w http.ResponseWriter, id, requested string, result Result) {
+	w.Header().Set("Content-Type", "application/json")
+	if result.Target.Model != "" {
+		w.Header().Set("X-General-Model", result.Target.Model)
+	}
+	json.NewEncoder(w).Encode(gatewayResponse{
+		ID:                     id,
+		Object:                 "chat.completion",
+		Created:                time.Now().Unix(),
+		Model:                  cmp.Or(result.Target.Model, requested),
+		ChatCompletionResponse: result.Response,
+	})
+}
+
+// stream answers with the chunks that source passes to its send function
+// as server-sent events, returning the status of the response and the
+// result of source. Errors before the first chunk get a regular error
+// response; later ones end the stream with an error event.
+func (g *Gateway) stream(w http.ResponseWriter, id, requested string, source func(send func(Target, ChatCompletionChunk)) Result) (int, Result) {
+	flusher, _ := w.(http.Flusher)
+	created := time.Now().Unix()
+	started := false
+	var writeErr error
+	write := func(v any) {
+		if writeErr != nil {
+			return
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			writeErr = err
+			return
+		}
+		if _, writeErr = fmt.Fprintf(w, "data: %s\n\n", data); writeErr == nil && flusher != nil {
+			flusher.Flush()
+		}
+	}
+	result := source(func(target Target, chunk ChatCompletionChunk) {
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			if target.Model != "" {
+				w.Header().Set("X-General-Model", target.Model)
+			}
+			w.WriteHeader(http.StatusOK)
+		}
+		write(gatewayChunk{
+			ID:                  id,
+			Object:              "chat.completion.chunk",
+			Created:             created,
+			Model:               cmp.Or(target.Model, requested),
+			ChatCompletionChunk: chunk,
+		})
+	})
+	switch {
+	case result.Error != nil && !started:
+		return g.writeError(w, result.Error), result
+	case result.Error != nil:
+		_, errType, message := g.errorDetails(result.Error)
+		write(gatewayError{Error: gatewayErrorBody{Message: message, Type: errType}})
+	default:
+		if writeErr == nil {
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	return http.StatusOK, result
+}
+
+func (g *Gateway) handleModels(w http.ResponseWriter, r *http.Request) {
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		OwnedBy string `json:"owned_by"`
+	}
+	list := struct {
+		Object string  `json:"object"`
+		Data   []model `json:"data"`
+	}{Object: "list", Data: []model{}}
+	add := func(id, owner string) {
+		if !slices.ContainsFunc(list.Data, func(m model) bool { return m.ID == id }) {
+			list.Data = append(list.Data, model{ID: id, Object: "model", OwnedBy: owner})
+		}
+	}
+	routes := g.routes.Load()
+	// Rules for exact names are the models clients can ask for by name.
+	for _, rule := range routes.rules {
+		if rule.Model != "" && !strings.HasSuffix(rule.Model, "*") {
+			add(rule.Model, "general")
+		}
+	}
+	if routes.def != nil {
+		for _, t := range routes.def.Targets() {
+			owner := t.Provider.Name()
+			if owner == "" {
+				owner = "custom"
+			}
+			add(t.Model, owner)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// gatewayError is the OpenAI error response format.
+type gatewayError struct {
+	Error gatewayErrorBody `json:"error"`
+}
+
+type gatewayErrorBody struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+// errorDetails returns the status, OpenAI error type and message a client
+// gets for err. Provider errors keep their status; anything else is a bad
+// gateway.
+func (g *Gateway) errorDetails(err error) (status int, errType, message string) {
+	status, errType = http.StatusBadGateway, "upstream_error"
+	var apiErr *APIError
+	var modErr *ModerationError
+	switch {
+	case errors.As(err, &modErr):
+		status, errType = http.StatusBadRequest, "invalid_request_error"
+	case errors.As(err, &apiErr):
+		status = apiErr.StatusCode
+		if apiErr.Type != "" {
+			errType = apiErr.Type
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		status, errType = http.StatusGatewayTimeout, "timeout"
+	}
+	return status, errType, g.cmd.redact(err.Error())
+}
+
+// writeError writes err as an OpenAI error response and returns its status.
+func (g *Gateway) writeError(w http.ResponseWriter, err error) int {
+	status, errType, message := g.errorDetails(err)
+	g.cmd.log(slog.LevelWarn, "gateway request failed", "status", status, "error", message)
+	writeGatewayError(w, status, errType, "", message)
+	return status
+}
+
+func writeGatewayError(w http.ResponseWriter, status int, errType, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(gatewayError{Error: gatewayErrorBody{Message: message, Type: errType, Code: code}})
+}
+
+// completionID returns a fresh OpenAI-style completion ID.
+func completionID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
+
+// completeRoute sends req to the targets of route under its policy.
+func (c *Command) completeRoute(ctx context.Context, route *GatewayRoute, req ChatCompletionRequest) Result {
+	switch route.Policy {
+	case PolicyRace:
+		return c.race(ctx, route.targets, req, callConfig{})
+	case PolicyBalance:
+		return c.Balance(ctx, route.balancer, req)
+	default:
+		return c.executeFallback(ctx, route.targets, req, nil)
+	}
+}
+
+// streamRoute streams the response to req from the targets of route under
+// its policy, passing send the chunks of the one target that serves it.
+// Under PolicyFallback the next target is only tried while nothing has
+// been sent.
+func (c *Command) streamRoute(ctx context.Context, route *GatewayRoute, req ChatCompletionRequest, send func(Target, ChatCompletionChunk)) Result {
+	if len(route.targets) == 0 {
+		return Result{Error: fmt.Errorf("no targets configured")}
+	}
+	ctx, cancel := withCallConfig(ctx, callConfig{})
+	defer cancel()
+	switch route.Policy {
+	case PolicyRace:
+		return c.raceStream(ctx, route.targets, req, send)
+	case PolicyBalance:
+		target, err := route.balancer.Next()
+		if err != nil {
+			return Result{Error: err}
+		}
+		return c.streamResult(ctx, target, req, send)
+	}
+
+	policy := c.fallbackPolicy()
+	var errs []error
+	var result Result
+	for i, target := range route.targets {
+		sent := false
+		result = c.streamResult(ctx, target, req, func(t Target, chunk ChatCompletionChunk) {
+			sent = true
+			send(t, chunk)
+		})
+		if result.Error == nil {
+			return result
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", target.Model, result.Error))
+		class := ClassifyError(result.Error)
+		if sent || ctx.Err() != nil || policy.action(class) == Abort || i == len(route.targets)-1 {
+			break
+		}
+		c.log(slog.LevelWarn, "failing over to next target",
+			"model", target.Model,
+			"class", class.String(),
+			"next", route.targets[i+1].Model,
+		)
+	}
+	if len(errs) > 1 {
+		result.Error = errors.Join(errs...)
+	}
+	return result
+}
+
+// streamResult streams the response of target to req into send.
+func (c *Command) streamResult(ctx context.Context, target Target, req ChatCompletionRequest, send func(Target, ChatCompletionChunk)) Result {
+	start := time.Now()
+	resp, err := c.streamContinuing(ctx, target, req, func(chunk ChatCompletionChunk) {
+		send(target, chunk)
+	})
+	return Result{Target: target, Response: resp, Error: err, Duration: time.Since(start)}
+}
+
+// raceStream streams req from all targets at once. The first to produce
+// tokens wins: its chunks so far and from then on go to send, and the
+// other streams are cancelled.
+func (c *Command) raceStream(ctx context.Context, targets []Target, req ChatCompletionRequest, send func(Target, ChatCompletionChunk)) Result {
+	var (
+		mu      sync.Mutex
+		winner  = -1
+		pending = make([][]ChatCompletionChunk, len(targets))
+		results = make([]Result, len(targets))
+		cancels = make([]context.CancelFunc, len(targets))
+		ctxs    = make([]context.Context, len(targets))
+		wg      sync.WaitGroup
+	)
+	for i := range targets {
+		ctxs[i], cancels[i] = context.WithCancel(ctx)
+	}
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancels[i]()
+			results[i] = c.streamResult(ctxs[i], target, req, func(t Target, chunk ChatCompletionChunk) {
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case winner == i:
+					send(t, chunk)
+				case winner >= 0:
+				case chunk.hasTokens():
+					winner = i
+					for j, cancel := range cancels {
+						if j != i {
+							cancel()
+						}
+					}
+					for _, p := range pending[i] {
+						send(t, p)
+					}
+					pending[i] = nil
+					send(t, chunk)
+				default:
+					pending[i] = append(pending[i], chunk)
+				}
+			})
+		}()
+	}
+	wg.Wait()
+
+	if winner >= 0 {
+		return results[winner]
+	}
+	// No target produced tokens; answer with the first to succeed anyway.
+	var errs []error
+	for i, r := range results {
+		if r.Error == nil {
+			for _, p := range pending[i] {
+				send(r.Target, p)
+			}
+			return r
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", r.Target.Model, r.Error))
+	}
+	return Result{Error: errors.Join(errs...)}
+}
@@ -0,0 +1,184 @@
+package general
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GatewayKey is an API key that clients of a Gateway authenticate with, so
+// that it can be shared without handing out the provider keys behind it.
+type GatewayKey struct {
+	Key string
+	// Name identifies the holder of the key in usage and logs. Keys with
+	// the same name share their usage.
+	Name string
+	// RPS limits the requests of the key per second, allowing bursts of up
+	// to Burst. Zero means no limit.
+	RPS   float64
+	Burst int
+	// Budget caps the spend of the holder; requests over it get a 429.
+	Budget GatewayBudget
+}
+
+// gatewayClient is an authenticated holder of a GatewayKey.
+type gatewayClient struct {
+	name   string
+	bucket *tokenBucket
+	budget GatewayBudget
+}
+
+// gatewayClientKey is the context key of the gatewayClient of a request.
+type gatewayClientKey struct{}
+
+// gatewayKeys maps the hashes of the keys of a Gateway to their holders.
+// Looking keys up by hash keeps their comparison from leaking their
+// prefixes through timing.
+type gatewayKeys map[[sha256.Size]byte]*gatewayClient
+
+// WithGatewayKeys requires clients to present one of keys as a bearer
+// token or in an x-api-key header. Without keys, the gateway is open to
+// anyone who can reach it.
+func WithGatewayKeys(keys ...GatewayKey) GatewayOption {
+	return func(g *Gateway) { g.SetKeys(keys...) }
+}
+
+// SetKeys replaces the accepted keys, e.g. when the key file is reloaded.
+// Keys kept with the same limits keep their rate limit state. An empty
+// set opens the gateway to anyone.
+func (g *Gateway) SetKeys(keys ...GatewayKey) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	previous := g.keys
+	if len(keys) == 0 {
+		g.keys = nil
+		return
+	}
+	g.keys = make(gatewayKeys, len(keys))
+	for _, k := range keys {
+		hash := sha256.Sum256([]byte(k.Key))
+		client := &gatewayClient{name: k.Name, budget: k.Budget}
+		if k.RPS > 0 {
+			limit := rateLimit{rps: k.RPS, burst: max(k.Burst, 1)}
+			if old, ok := previous[hash]; ok && old.bucket != nil && old.bucket.limit == limit {
+				client.bucket = old.bucket
+			} else {
+				client.bucket = newTokenBucket(limit)
+			}
+		}
+		g.keys[hash] = client
+	}
+}
+
+// authenticate returns the client presenting a valid key in r, or nil if
+// the gateway is open. It reports false if the key is missing or invalid.
+func (g *Gateway) authenticate(r *http.Request) (*gatewayClient, bool) {
+	g.mu.Lock()
+	keys := g.keys
+	g.mu.Unlock()
+	if keys == nil {
+		return nil, true
+	}
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		key = r.Header.Get("X-Api-Key")
+	}
+	if key == "" {
+		return nil, false
+	}
+	client, ok := keys[sha256.Sum256([]byte(strings.TrimSpace(key)))]
+	return client, ok
+}
+
+// clientName returns the name of the client of ctx, or "" for an open
+// gateway.
+func clientName(ctx context.Context) string {
+	if client, ok := ctx.Value(gatewayClientKey{}).(*gatewayClient); ok {
+		return client.name
+	}
+	return ""
+}
+
+// allowClient applies the rate limit of the client of r. If the limit is
+// exhausted it answers with 429 and returns false.
+func (g *Gateway) allowClient(w http.ResponseWriter, r *http.Request) bool {
+	client, ok := r.Context().Value(gatewayClientKey{}).(*gatewayClient)
+	if !ok || client.bucket == nil {
+		return true
+	}
+	allowed, wait := client.bucket.allow()
+	if allowed {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeGatewayError(w, http.StatusTooManyRequests, "rate_limit_error", "rate_limit_exceeded",
+		"rate limit of API key exceeded, retry in "+wait.Round(time.Millisecond).String())
+	return false
+}
+
+// Usage returns the aggregate usage of the requests the gateway sent
+// upstream, by client name. Requests to an open gateway count under "".
+func (g *Gateway) Usage() map[string]UsageSummary {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	usage := make(map[string]UsageSummary, len(g.usage))
+	for name, s := range g.usage {
+		usage[name] = *s
+	}
+	return usage
+}
+
+// account adds r to the usage of the named client.
+func (g *Gateway) account(name string, r Result) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.usage == nil {
+		g.usage = make(map[string]*UsageSummary)
+	}
+	s, ok := g.usage[name]
+	if !ok {
+		s = &UsageSummary{}
+		g.usage[name] = s
+	}
+	s.add(r)
+}
+
+// periodSpend is the spend of a client in a budget period, with its
+// limits.
+type periodSpend struct {
+	Cost       float64 `json:"cost"`
+	Tokens     int     `json:"tokens"`
+	CostLimit  float64 `json:"cost_limit,omitempty"`
+	TokenLimit int     `json:"token_limit,omitempty"`
+}
+
+// handleUsage answers with the usage of the client making the request and,
+// if it has a budget, its spend in the current day and month.
+func (g *Gateway) handleUsage(w http.ResponseWriter, r *http.Request) {
+	name := clientName(r.Context())
+	s := g.Usage()[name]
+	usage := struct {
+		Client           string       `json:"client"`
+		Requests         int          `json:"requests"`
+		Errors           int          `json:"errors"`
+		PromptTokens     int          `json:"prompt_tokens"`
+		CompletionTokens int          `json:"completion_tokens"`
+		Cost             float64      `json:"cost"`
+		Daily            *periodSpend `json:"daily,omitempty"`
+		Monthly          *periodSpend `json:"monthly,omitempty"`
+	}{Client: name, Requests: s.Requests, Errors: s.Errors, PromptTokens: s.PromptTokens, CompletionTokens: s.CompletionTokens, Cost: s.Cost}
+	if client, ok := r.Context().Value(gatewayClientKey{}).(*gatewayClient); ok && client.budget != (GatewayBudget{}) {
+		if l, err := g.ledger(r.Context(), name); err == nil {
+			b := client.budget
+			usage.Daily = &periodSpend{l.daily.Cost, ledgerTokens(l.daily), b.DailyCost, b.DailyTokens}
+			usage.Monthly = &periodSpend{l.monthly.Cost, ledgerTokens(l.monthly), b.MonthlyCost, b.MonthlyTokens}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
@@ -0,0 +1,152 @@
+package general
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GatewayBudget caps the spend of the holder of a GatewayKey per calendar
+// day and month, in UTC. Zero fields impose no limit. Costs are in USD, as
+// reported by the provider or estimated from the catalog.
+type GatewayBudget struct {
+	DailyCost     float64
+	MonthlyCost   float64
+	DailyTokens   int
+	MonthlyTokens int
+}
+
+// tenantLedger is the spend of a client in the current day and month.
+type tenantLedger struct {
+	day, month     time.Time
+	daily, monthly UsageSummary
+}
+
+// budgetExceeded is the refusal of a request whose client has exhausted a
+// budget.
+type budgetExceeded struct {
+	period string
+	limit  string
+	resets time.Time
+}
+
+func (e budgetExceeded) Error() string {
+	return fmt.Sprintf("%s budget of %s exhausted, resets at %s", e.period, e.limit, e.resets.Format(time.RFC3339))
+}
+
+// checkBudget refuses r with a 429 if its client has exhausted a budget,
+// and returns false. Spend is totalled from the Command's ResultStore when
+// it has one, so budgets hold across restarts.
+func (g *Gateway) checkBudget(w http.ResponseWriter, r *http.Request) bool {
+	client, ok := r.Context().Value(gatewayClientKey{}).(*gatewayClient)
+	if !ok || client.budget == (GatewayBudget{}) {
+		return true
+	}
+	l, err := g.ledger(r.Context(), client.name)
+	if err != nil {
+		// Serving without the spend so far is better than refusing everyone
+		// while the store is unavailable.
+		g.cmd.log(slog.LevelWarn, "failed to load gateway spend", "client", client.name, "error", err.Error())
+		return true
+	}
+	b := client.budget
+	nextDay, nextMonth := l.day.AddDate(0, 0, 1), l.month.AddDate(0, 1, 0)
+	var exceeded *budgetExceeded
+	switch {
+	case b.MonthlyCost > 0 && l.monthly.Cost >= b.MonthlyCost:
+		exceeded = &budgetExceeded{"monthly", fmt.Sprintf("$%.2f", b.MonthlyCost), nextMonth}
+	case b.MonthlyTokens > 0 && ledgerTokens(l.monthly) >= b.MonthlyTokens:
+		exceeded = &budgetExceeded{"monthly", fmt.Sprintf("%d tokens", b.MonthlyTokens), nextMonth}
+	case b.DailyCost > 0 && l.daily.Cost >= b.DailyCost:
+		exceeded = &budgetExceeded{"daily", fmt.Sprintf("$%.2f", b.DailyCost), nextDay}
+	case b.DailyTokens > 0 && ledgerTokens(l.daily) >= b.DailyTokens:
+		exceeded = &budgetExceeded{"daily", fmt.Sprintf("%d tokens", b.DailyTokens), nextDay}
+	default:
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(exceeded.resets).Seconds()))))
+	writeGatewayError(w, http.StatusTooManyRequests, "budget_exceeded", "budget_exceeded", exceeded.Error())
+	return false
+}
+
+// ledgerTokens returns the tokens spent in s.
+func ledgerTokens(s UsageSummary) int {
+	return s.PromptTokens + s.CompletionTokens
+}
+
+// ledger returns the spend of the named client in the current day and
+// month, loading it from the result store when a period starts.
+func (g *Gateway) ledger(ctx context.Context, name string) (tenantLedger, error) {
+	now := time.Now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	g.budgetMu.Lock()
+	defer g.budgetMu.Unlock()
+	if g.ledgers == nil {
+		g.ledgers = make(map[string]*tenantLedger)
+	}
+	l := g.ledgers[name]
+	if l == nil || !l.month.Equal(month) {
+		monthly, err := g.spendSince(ctx, name, month)
+		if err != nil {
+			return tenantLedger{}, err
+		}
+		l = &tenantLedger{month: month, monthly: monthly}
+	}
+	if !l.day.Equal(day) {
+		daily, err := g.spendSince(ctx, name, day)
+		if err != nil {
+			return tenantLedger{}, err
+		}
+		l.day, l.daily = day, daily
+	}
+	g.ledgers[name] = l
+	return *l, nil
+}
+
+// spendSince returns the spend of the named client recorded in the result
+// store since start, or nothing without a store.
+func (g *Gateway) spendSince(ctx context.Context, name string, start time.Time) (UsageSummary, error) {
+	if g.cmd.store == nil || name == "" {
+		return UsageSummary{}, nil
+	}
+	return g.cmd.store.Usage(ctx, RecordFilter{Client: name, Since: start})
+}
+
+// gatewayChargeKey is the context key of the function charging the calls
+// made for a client of a Gateway to its budget.
+type gatewayChargeKey struct{}
+
+// chargeMiddleware charges every call made for a client of a gateway, the
+// losers of a race and the failed attempts of a fallback included, so that
+// its ledger agrees with the spend the result store records. Calls made
+// outside a gateway carry no charge function and pass through.
+func chargeMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call Call) (ChatCompletionResponse, error) {
+		charge, ok := ctx.Value(gatewayChargeKey{}).(func(Result))
+		if !ok {
+			return next(ctx, call)
+		}
+		start := time.Now()
+		resp, err := next(ctx, call)
+		if !resp.Cached {
+			charge(Result{Target: call.Target, Response: resp, Error: err, Duration: time.Since(start)})
+		}
+		return resp, err
+	}
+}
+
+// charge adds r to the ledger of the named client, if it is tracked.
+func (g *Gateway) charge(name string, r Result) {
+	g.budgetMu.Lock()
+	defer g.budgetMu.Unlock()
+	if l := g.ledgers[name]; l != nil {
+		l.daily.add(r)
+		l.monthly.add(r)
+	}
+}
@@ -0,0 +1,58 @@
+package general
+
+// Gemini harm categories for SafetySetting.Category.
+const (
+	HarmCategoryHarassment       = "HARM_CATEGORY_HARASSMENT"
+	HarmCategoryHateSpeech       = "HARM_CATEGORY_HATE_SPEECH"
+	HarmCategorySexuallyExplicit = "HARM_CATEGORY_SEXUALLY_EXPLICIT"
+	HarmCategoryDangerousContent = "HARM_CATEGORY_DANGEROUS_CONTENT"
+	HarmCategoryCivicIntegrity   = "HARM_CATEGORY_CIVIC_INTEGRITY"
+)
+
+// Gemini block thresholds for SafetySetting.Threshold.
+const (
+	HarmBlockNone           = "BLOCK_NONE"
+	HarmBlockOnlyHigh       = "BLOCK_ONLY_HIGH"
+	HarmBlockMediumAndAbove = "BLOCK_MEDIUM_AND_ABOVE"
+	HarmBlockLowAndAbove    = "BLOCK_LOW_AND_ABOVE"
+	HarmBlockOff            = "OFF"
+)
+
+// GeminiOptions holds request parameters only understood by Gemini.
+// They are ignored for other providers.
+type GeminiOptions struct {
+	SafetySettings []SafetySetting
+
+	// The remaining options require a GeminiNative provider.
+
+	// CodeExecution lets the model write and run Python code.
+	CodeExecution bool
+	// GoogleSearch grounds replies with Google Search results. The grounding
+	// metadata is returned in the "grounding_metadata" field of Choice.Raw.
+	GoogleSearch bool
+	// CachedContent is the name of a cached content resource ("cachedContents/...")
+	// used as the prefix of the prompt.
+	CachedContent string
+}
+
+// SafetySetting sets the block threshold for one harm category.
+type SafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+// RelaxedSafety returns settings that disable blocking for every adjustable category.
+func RelaxedSafety() []SafetySetting {
+	categories := []string{
+		HarmCategoryHarassment,
+		HarmCategoryHateSpeech,
+		HarmCategorySexuallyExplicit,
+		HarmCategoryDangerousContent,
+		HarmCategoryCivicIntegrity,
+	}
+	settings := make([]SafetySetting, len(categories))
+	for i, c := range categories {
+		settings[i] = SafetySetting{Category: c, Threshold: HarmBlockNone}
+	}
+	return settings
+}
@@ -0,0 +1,504 @@
+package general
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GeminiNativeEndpoint is the root of the native Gemini API.
+const GeminiNativeEndpoint = "https://generativelanguage.googleapis.com/v1beta"
+
+// geminiUploadEndpoint is the File API upload root matching GeminiNativeEndpoint.
+const geminiUploadEndpoint = "https://generativelanguage.googleapis.com/upload/v1beta/files"
+
+// GeminiNative returns a Provider for the native Gemini generateContent API,
+// which unlocks features missing from the OpenAI-compatible mode: code
+// execution, Google Search grounding, cached content and File API uploads.
+func GeminiNative(apiKey string) Provider {
+	return Provider{Endpoint: GeminiNativeEndpoint, APIKey: apiKey, GeminiNative: true}
+}
+
+// geminiFilePart is the ContentPart type of files uploaded with UploadGeminiFile.
+const geminiFilePart = "gemini_file"
+
+// GeminiFilePart returns a content part referencing a file uploaded with
+// UploadGeminiFile. It is only understood by GeminiNative providers.
+func GeminiFilePart(file GeminiFile) ContentPart {
+	return ContentPart{Type: geminiFilePart, FileURI: file.URI, MIMEType: file.MIMEType}
+}
+
+// geminiURL returns the generateContent URL of model, or the streaming
+// variant, which sends server-sent events.
+func geminiURL(p Provider, model string, stream bool) string {
+	base := strings.TrimRight(p.Endpoint, "/") + "/models/" + model
+	if stream {
+		return base + ":streamGenerateContent?alt=sse"
+	}
+	return base + ":generateContent"
+}
+
+// Native Gemini request types.
+type (
+	geminiRequest struct {
+		Contents          []geminiContent  `json:"contents"`
+		SystemInstruction *geminiContent   `json:"systemInstruction,omitempty"`
+		Tools             []map[string]any `json:"tools,omitempty"`
+		ToolConfig        map[string]any   `json:"toolConfig,omitempty"`
+		GenerationConfig  map[string]any   `json:"generationConfig,omitempty"`
+		SafetySettings    []SafetySetting  `json:"safetySettings,omitempty"`
+		CachedContent     string           `json:"cachedContent,omitempty"`
+	}
+
+	geminiContent struct {
+		Role  string       `json:"role,omitempty"`
+		Parts []geminiPart `json:"parts"`
+	}
+
+	geminiPart struct {
+		Text                string               `json:"text,omitempty"`
+		Thought             bool                 `json:"thought,omitempty"`
+		InlineData          *geminiBlob          `json:"inlineData,omitempty"`
+		FileData            *geminiFileData      `json:"fileData,omitempty"`
+		FunctionCall        *geminiFunctionCall  `json:"functionCall,omitempty"`
+		FunctionResponse    *geminiFunctionReply `json:"functionResponse,omitempty"`
+		ExecutableCode      *geminiCode          `json:"executableCode,omitempty"`
+		CodeExecutionResult *geminiCodeResult    `json:"codeExecutionResult,omitempty"`
+	}
+
+	geminiBlob struct {
+		MIMEType string `json:"mimeType"`
+		Data     string `json:"data"`
+	}
+
+	geminiFileData struct {
+		MIMEType string `json:"mimeType,omitempty"`
+		FileURI  string `json:"fileUri"`
+	}
+
+	geminiFunctionCall struct {
+		Name string          `json:"name"`
+		Args json.RawMessage `json:"args,omitempty"`
+	}
+
+	geminiFunctionReply struct {
+		Name     string          `json:"name"`
+		Response json.RawMessage `json:"response"`
+	}
+
+	geminiCode struct {
+		Language string `json:"language"`
+		Code     string `json:"code"`
+	}
+
+	geminiCodeResult struct {
+		Outcome string `json:"outcome"`
+		Output  string `json:"output"`
+	}
+)
+
+// geminiGenerationFields maps OpenAI request fields to generation config fields.
+var geminiGenerationFields = map[string]string{
+	"temperature": "temperature",
+	"top_p":       "topP",
+	"max_tokens":  "maxOutputTokens",
+	"seed":        "seed",
+}
+
+// marshalGeminiNative converts a chat request into a generateContent body.
+func marshalGeminiNative(target Target, req ChatCompletionRequest) ([]byte, error) {
+	var body geminiRequest
+
+	// Tool results carry only the call ID; Gemini wants the function name.
+	toolNames := make(map[string]string)
+	for _, m := range req.Messages {
+		switch m.Role {
+		case RoleSystem:
+			if body.SystemInstruction == nil {
+				body.SystemInstruction = &geminiContent{}
+			}
+			body.SystemInstruction.Parts = append(body.SystemInstruction.Parts, geminiPart{Text: m.Text()})
+			continue
+		case RoleTool:
+			body.Contents = appendGeminiContent(body.Contents, "user", geminiPart{FunctionResponse: &geminiFunctionReply{
+				Name:     toolNames[m.ToolCallID],
+				Response: geminiToolResponse(m.Text()),
+			}})
+			continue
+		}
+
+		role := "user"
+		if m.Role == RoleAssistant {
+			role = "model"
+		}
+		parts, err := geminiParts(m)
+		if err != nil {
+			return nil, err
+		}
+		for _, call := range m.ToolCalls {
+			toolNames[call.ID] = call.Function.Name
+			args := json.RawMessage(call.Function.Arguments)
+			if len(args) == 0 {
+				args = json.RawMessage("{}")
+			}
+			parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: call.Function.Name, Args: args}})
+		}
+		body.Contents = appendGeminiContent(body.Contents, role, parts...)
+	}
+
+	if len(req.Tools) > 0 {
+		declarations := make([]ToolFunc, len(req.Tools))
+		for i, t := range req.Tools {
+			declarations[i] = t.Function
+		}
+		body.Tools = append(body.Tools, map[string]any{"functionDeclarations": declarations})
+	}
+	if mode := geminiToolMode(req.ToolChoice); mode != "" {
+		body.ToolConfig = map[string]any{"functionCallingConfig": map[string]any{"mode": mode}}
+	}
+
+	config := map[string]any{}
+	if req.Temperature != 0 {
+		config["temperature"] = req.Temperature
+	}
+	if req.TopP != 0 {
+		config["topP"] = req.TopP
+	}
+	if limit := max(req.MaxTokens, req.MaxCompletionTokens); limit > 0 {
+		config["maxOutputTokens"] = limit
+	}
+	if len(req.Stop) > 0 {
+		config["stopSequences"] = req.Stop
+	}
+	if req.N > 0 {
+		config["candidateCount"] = req.N
+	}
+	if req.Seed != nil {
+		config["seed"] = *req.Seed
+	}
+	if req.ThinkingBudget > 0 {
+		config["thinkingConfig"] = map[string]any{"thinkingBudget": req.ThinkingBudget, "includeThoughts": true}
+	}
+	// Sampling parameters passed as extra fields, such as an explicit zero
+	// temperature, belong in the generation config.
+	extra := make(map[string]any, len(req.Extra))
+	for k, v := range req.Extra {
+		if name, ok := geminiGenerationFields[k]; ok {
+			config[name] = v
+		} else {
+			extra[k] = v
+		}
+	}
+	if len(config) > 0 {
+		body.GenerationConfig = config
+	}
+
+	if g := req.Gemini; g != nil {
+		body.SafetySettings = g.SafetySettings
+		body.CachedContent = g.CachedContent
+		if g.CodeExecution {
+			body.Tools = append(body.Tools, map[string]any{"codeExecution": map[string]any{}})
+		}
+		if g.GoogleSearch {
+			body.Tools = append(body.Tools, map[string]any{"googleSearch": map[string]any{}})
+		}
+	}
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	fields := requestBody{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	if err := fields.merge(extra); err != nil {
+		return nil, err
+	}
+	if err := fields.merge(target.Extra); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// appendGeminiContent adds parts to contents, merging consecutive turns of
+// the same role as Gemini requires alternating roles.
+func appendGeminiContent(contents []geminiContent, role string, parts ...geminiPart) []geminiContent {
+	if len(parts) == 0 {
+		return contents
+	}
+	if n := len(contents); n > 0 && contents[n-1].Role == role {
+		contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+		return contents
+	}
+	return append(contents, geminiContent{Role: role, Parts: parts})
+}
+
+// geminiParts converts the content of m into native parts.
+func geminiParts(m ChatCompletionMessage) ([]geminiPart, error) {
+	if len(m.Parts) == 0 {
+		if m.Content == "" {
+			return nil, nil
+		}
+		return []geminiPart{{Text: m.Content}}, nil
+	}
+
+	var parts []geminiPart
+	for _, p := range m.Parts {
+		switch p.Type {
+		case "text":
+			parts = append(parts, geminiPart{Text: p.Text})
+		case "image_url":
+			if p.ImageURL == nil {
+				continue
+			}
+			if mimeType, data, ok := parseDataURI(p.ImageURL.URL); ok {
+				parts = append(parts, geminiPart{InlineData: &geminiBlob{MIMEType: mimeType, Data: data}})
+			} else {
+				parts = append(parts, geminiPart{FileData: &geminiFileData{FileURI: p.ImageURL.URL}})
+			}
+		case geminiFilePart:
+			parts = append(parts, geminiPart{FileData: &geminiFileData{MIMEType: p.MIMEType, FileURI: p.FileURI}})
+		default:
+			return nil, fmt.Errorf("content part type %q is not supported by native Gemini", p.Type)
+		}
+	}
+	return parts, nil
+}
+
+// parseDataURI splits a base64 data URI into its MIME type and data.
+func parseDataURI(uri string) (mimeType, data string, ok bool) {
+	rest, ok := strings.CutPrefix(uri, "data:")
+	if !ok {
+		return "", "", false
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mimeType, ok = strings.CutSuffix(meta, ";base64")
+	return mimeType, data, ok
+}
+
+// geminiToolResponse wraps a tool result as the JSON object Gemini expects.
+func geminiToolResponse(text string) json.RawMessage {
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	wrapped, _ := json.Marshal(map[string]string{"content": text})
+	return wrapped
+}
+
+// geminiToolMode translates an OpenAI tool_choice into a function calling mode.
+func geminiToolMode(choice any) string {
+	switch choice {
+	case "auto":
+		return "AUTO"
+	case "none":
+		return "NONE"
+	case "required":
+		return "ANY"
+	}
+	return ""
+}
+
+// Native Gemini response types.
+type (
+	geminiResponse struct {
+		Candidates    []geminiCandidate `json:"candidates"`
+		UsageMetadata *geminiUsage      `json:"usageMetadata,omitempty"`
+	}
+
+	geminiCandidate struct {
+		Index             int             `json:"index"`
+		Content           geminiContent   `json:"content"`
+		FinishReason      string          `json:"finishReason,omitempty"`
+		GroundingMetadata json.RawMessage `json:"groundingMetadata,omitempty"`
+	}
+
+	geminiUsage struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+		TotalTokenCount         int `json:"totalTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	}
+)
+
+// decodeGeminiNative reads a generateContent response as a chat response.
+func decodeGeminiNative(body io.Reader) (ChatCompletionResponse, error) {
+	var raw geminiResponse
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return ChatCompletionResponse{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	chunk := raw.chunk()
+
+	acc := &streamAccumulator{}
+	if err := acc.add(chunk); err != nil {
+		return ChatCompletionResponse{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	response := acc.response()
+	for _, c := range raw.Candidates {
+		if len(c.GroundingMetadata) > 0 && c.Index >= 0 && c.Index < len(response.Choices) {
+			response.Choices[c.Index].Raw = map[string]json.RawMessage{"grounding_metadata": c.GroundingMetadata}
+		}
+	}
+	return response, nil
+}
+
+// chunk converts a native response, complete or streamed, into a chunk.
+// Code execution parts are rendered into the text as fenced blocks and
+// function calls become tool calls.
+func (r geminiResponse) chunk() ChatCompletionChunk {
+	var chunk ChatCompletionChunk
+	for _, c := range r.Candidates {
+		choice := ChunkChoice{Index: c.Index, FinishReason: geminiFinishReason(c.FinishReason)}
+		var text, thoughts strings.Builder
+		for _, p := range c.Content.Parts {
+			switch {
+			case p.Thought:
+				thoughts.WriteString(p.Text)
+			case p.FunctionCall != nil:
+				args := string(p.FunctionCall.Args)
+				if args == "" {
+					args = "{}"
+				}
+				n := len(choice.Delta.ToolCalls)
+				choice.Delta.ToolCalls = append(choice.Delta.ToolCalls, ToolCallDelta{
+					Index:    n,
+					ID:       "call_" + strconv.Itoa(n),
+					Type:     ToolTypeFunction,
+					Function: ToolCallFunction{Name: p.FunctionCall.Name, Arguments: args},
+				})
+			case p.ExecutableCode != nil:
+				fmt.Fprintf(&text, "\n```%s\n%s\n```\n", strings.ToLower(p.ExecutableCode.Language), strings.TrimRight(p.ExecutableCode.Code, "\n"))
+			case p.CodeExecutionResult != nil:
+				fmt.Fprintf(&text, "\n```output\n%s\n```\n", strings.TrimRight(p.CodeExecutionResult.Output, "\n"))
+			default:
+				text.WriteString(p.Text)
+			}
+		}
+		choice.Delta.Content = text.String()
+		choice.Delta.Reasoning = thoughts.String()
+		if choice.FinishReason != "" && len(choice.Delta.ToolCalls) > 0 {
+			choice.FinishReason = "tool_calls"
+		}
+		chunk.Choices = append(chunk.Choices, choice)
+	}
+
+	if u := r.UsageMetadata; u != nil {
+		chunk.Usage = &Usage{
+			PromptTokens:     u.PromptTokenCount,
+			CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+			TotalTokens:      u.TotalTokenCount,
+		}
+		if u.CachedContentTokenCount > 0 {
+			chunk.Usage.PromptTokensDetails = &PromptTokensDetails{CachedTokens: u.CachedContentTokenCount}
+		}
+	}
+	return chunk
+}
+
+// geminiFinishReason maps a native finish reason to its OpenAI equivalent.
+func geminiFinishReason(reason string) string {
+	switch reason {
+	case "", "FINISH_REASON_UNSPECIFIED":
+		return ""
+	case "STOP":
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "content_filter"
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
+// GeminiFile is a file stored with the Gemini File API.
+type GeminiFile struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	MIMEType    string `json:"mimeType"`
+	SizeBytes   string `json:"sizeBytes"`
+	URI         string `json:"uri"`
+	State       string `json:"state"`
+	ExpireTime  string `json:"expireTime"`
+}
+
+// UploadGeminiFile uploads data to the Gemini File API of provider using the
+// resumable upload protocol. Reference the returned file in messages with
+// GeminiFilePart.
+func (c *Command) UploadGeminiFile(ctx context.Context, provider Provider, displayName, mimeType string, data []byte) (GeminiFile, error) {
+	provider = c.selectKey(provider)
+	client, err := c.httpClient(provider)
+	if err != nil {
+		return GeminiFile{}, err
+	}
+	release, err := c.acquireSlot(ctx)
+	if err != nil {
+		return GeminiFile{}, err
+	}
+	defer release()
+	ctx, cancel := c.requestContext(ctx, false)
+	defer cancel()
+
+	metadata, err := json.Marshal(map[string]any{"file": map[string]string{"display_name": displayName}})
+	if err != nil {
+		return GeminiFile{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	start, err := http.NewRequestWithContext(ctx, "POST", geminiUploadEndpoint, bytes.NewReader(metadata))
+	if err != nil {
+		return GeminiFile{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	provider.setHeaders(start.Header)
+	start.Header.Set("X-Goog-Upload-Protocol", "resumable")
+	start.Header.Set("X-Goog-Upload-Command", "start")
+	start.Header.Set("X-Goog-Upload-Header-Content-Length", strconv.Itoa(len(data)))
+	start.Header.Set("X-Goog-Upload-Header-Content-Type", mimeType)
+
+	startResp, err := client.Do(start)
+	if err != nil {
+		return GeminiFile{}, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer startResp.Body.Close()
+	if startResp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(startResp.Body)
+		return GeminiFile{}, c.apiError(startResp.StatusCode, body)
+	}
+	uploadURL := startResp.Header.Get("X-Goog-Upload-URL")
+	if uploadURL == "" {
+		return GeminiFile{}, fmt.Errorf("no upload URL in response")
+	}
+
+	upload, err := http.NewRequestWithContext(ctx, "POST", uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return GeminiFile{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	upload.Header.Set("X-Goog-Upload-Offset", "0")
+	upload.Header.Set("X-Goog-Upload-Command", "upload, finalize")
+
+	uploadResp, err := client.Do(upload)
+	if err != nil {
+		return GeminiFile{}, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer uploadResp.Body.Close()
+	if uploadResp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(uploadResp.Body)
+		return GeminiFile{}, c.apiError(uploadResp.StatusCode, body)
+	}
+
+	var result struct {
+		File GeminiFile `json:"file"`
+	}
+	if err := json.NewDecoder(uploadResp.Body).Decode(&result); err != nil {
+		return GeminiFile{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.File, nil
+}
@@ -0,0 +1,318 @@
+package generaltest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/festeh/general"
+)
+
+// Fault is a failure a Server injects into its response to a request.
+type Fault int
+
+const (
+	// FaultNone answers normally.
+	FaultNone Fault = iota
+	// FaultRateLimit answers 429 with a Retry-After header.
+	FaultRateLimit
+	// FaultServerError answers 500.
+	FaultServerError
+	// FaultSlowBody sends the response in pieces, pausing between them:
+	// between words of a stream, and between halves of a plain body.
+	FaultSlowBody
+	// FaultTruncated cuts the response off: a plain body ends mid-JSON and a
+	// stream stops after its first content chunk, without [DONE].
+	FaultTruncated
+	// FaultMalformedSSE sends a stream whose second event is not valid JSON.
+	// Plain requests are answered normally.
+	FaultMalformedSSE
+)
+
+// String returns the name of f.
+func (f Fault) String() string {
+	switch f {
+	case FaultNone:
+		return "none"
+	case FaultRateLimit:
+		return "rate_limit"
+	case FaultServerError:
+		return "server_error"
+	case FaultSlowBody:
+		return "slow_body"
+	case FaultTruncated:
+		return "truncated"
+	case FaultMalformedSSE:
+		return "malformed_sse"
+	}
+	return fmt.Sprintf("Fault(%d)", int(f))
+}
+
+// Profile decides the fault of the nth request to a Server, counting from 0.
+type Profile func(n int) Fault
+
+// Healthy injects no faults.
+func Healthy() Profile {
+	return func(int) Fault { return FaultNone }
+}
+
+// Always injects f into every request.
+func Always(f Fault) Profile {
+	return func(int) Fault { return f }
+}
+
+// Sequence injects faults[n] into the nth request and no fault after the
+// sequence ends.
+func Sequence(faults ...Fault) Profile {
+	return func(n int) Fault {
+		if n < len(faults) {
+			return faults[n]
+		}
+		return FaultNone
+	}
+}
+
+// Burst injects f into the first n requests, as a provider shedding load.
+func Burst(f Fault, n int) Profile {
+	return func(i int) Fault {
+		if i < n {
+			return f
+		}
+		return FaultNone
+	}
+}
+
+// Every injects f into every kth request, starting with request k-1.
+func Every(f Fault, k int) Profile {
+	return func(n int) Fault {
+		if k > 0 && (n+1)%k == 0 {
+			return f
+		}
+		return FaultNone
+	}
+}
+
+// Random injects f into requests with probability rate, drawn from a source
+// seeded with seed so runs are reproducible.
+func Random(f Fault, rate float64, seed int64) Profile {
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+	return func(int) Fault {
+		mu.Lock()
+		defer mu.Unlock()
+		if rng.Float64() < rate {
+			return f
+		}
+		return FaultNone
+	}
+}
+
+// ServerOption configures a Server.
+type ServerOption func(*Server)
+
+// ServerReply sets the content of successful replies. It defaults to
+// "Hello from the test server."
+func ServerReply(text string) ServerOption {
+	return func(s *Server) { s.reply = text }
+}
+
+// ServerDelay sets the pause between the pieces of a FaultSlowBody response.
+// It defaults to 100ms.
+func ServerDelay(d time.Duration) ServerOption {
+	return func(s *Server) { s.delay = d }
+}
+
+// ServerRetryAfter sets the Retry-After of FaultRateLimit responses, rounded
+// up to whole seconds. It defaults to 1s.
+func ServerRetryAfter(d time.Duration) ServerOption {
+	return func(s *Server) { s.retryAfter = d }
+}
+
+// Server is an OpenAI-compatible chat completions server that injects
+// faults chosen by a Profile, for exercising the retry and streaming paths
+// of code using general. It answers every path and method.
+type Server struct {
+	*httptest.Server
+
+	reply      string
+	delay      time.Duration
+	retryAfter time.Duration
+
+	mu      sync.Mutex
+	profile Profile
+	faults  []Fault
+}
+
+// NewServer starts a Server injecting faults by profile. Close it when done.
+func NewServer(profile Profile, opts ...ServerOption) *Server {
+	s := &Server{
+		reply:      "Hello from the test server.",
+		delay:      100 * time.Millisecond,
+		retryAfter: time.Second,
+		profile:    profile,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Endpoint returns the chat completions URL of s.
+func (s *Server) Endpoint() string {
+	return s.URL + "/v1/chat/completions"
+}
+
+// Target returns a target for model served by s.
+func (s *Server) Target(model string) general.Target {
+	return general.Target{Provider: general.Provider{Endpoint: s.Endpoint(), APIKey: "test"}, Model: model}
+}
+
+// SetProfile replaces the profile of s and restarts its request count.
+func (s *Server) SetProfile(profile Profile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profile = profile
+	s.faults = nil
+}
+
+// Requests returns the number of requests s has received since it started
+// or its profile was last set.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.faults)
+}
+
+// Faults returns the fault injected into each request, in arrival order.
+func (s *Server) Faults() []Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Fault(nil), s.faults...)
+}
+
+// next returns the fault of a new request.
+func (s *Server) next() Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fault := s.profile(len(s.faults))
+	s.faults = append(s.faults, fault)
+	return fault
+}
+
+type serverRequest struct {
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	var req serverRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	switch fault := s.next(); fault {
+	case FaultRateLimit:
+		seconds := int((s.retryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		writeError(w, http.StatusTooManyRequests, "rate_limit_exceeded", "Rate limit reached, retry later")
+	case FaultServerError:
+		writeError(w, http.StatusInternalServerError, "server_error", "The server had an error processing your request")
+	default:
+		if req.Stream {
+			s.stream(w, req.Model, fault)
+		} else {
+			s.complete(w, req.Model, fault)
+		}
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]string{"message": message, "type": code, "code": code},
+	})
+}
+
+// usage returns the usage reported for a reply of text.
+func usage(text string) map[string]int {
+	completion := len(strings.Fields(text))
+	return map[string]int{"prompt_tokens": 10, "completion_tokens": completion, "total_tokens": 10 + completion}
+}
+
+// complete answers a plain request.
+func (s *Server) complete(w http.ResponseWriter, model string, fault Fault) {
+	body, _ := json.Marshal(map[string]any{
+		"id":     "chatcmpl-test",
+		"object": "chat.completion",
+		"model":  model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": s.reply},
+			"finish_reason": "stop",
+		}},
+		"usage": usage(s.reply),
+	})
+	w.Header().Set("Content-Type", "application/json")
+
+	half := len(body) / 2
+	switch fault {
+	case FaultTruncated:
+		w.Write(body[:half])
+	case FaultSlowBody:
+		w.Write(body[:half])
+		w.(http.Flusher).Flush()
+		time.Sleep(s.delay)
+		w.Write(body[half:])
+	default:
+		w.Write(body)
+	}
+}
+
+// stream answers a streaming request with one chunk per word of the reply.
+func (s *Server) stream(w http.ResponseWriter, model string, fault Fault) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher := w.(http.Flusher)
+	event := func(data any) {
+		line, _ := json.Marshal(data)
+		fmt.Fprintf(w, "data: %s\n\n", line)
+		flusher.Flush()
+	}
+	chunk := func(delta map[string]string, finish any) map[string]any {
+		return map[string]any{
+			"id":      "chatcmpl-test",
+			"object":  "chat.completion.chunk",
+			"model":   model,
+			"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finish}},
+		}
+	}
+
+	words := strings.SplitAfter(s.reply, " ")
+	for i, word := range words {
+		delta := map[string]string{"content": word}
+		if i == 0 {
+			delta["role"] = "assistant"
+		}
+		event(chunk(delta, nil))
+
+		switch {
+		case fault == FaultTruncated:
+			return
+		case fault == FaultMalformedSSE && i == 0:
+			fmt.Fprint(w, "data: {\"choices\": [{\"index\": 0, \"delta\": {\"content\n\n")
+			flusher.Flush()
+		case fault == FaultSlowBody && i < len(words)-1:
+			time.Sleep(s.delay)
+		}
+	}
+	event(chunk(map[string]string{}, "stop"))
+	event(map[string]any{"id": "chatcmpl-test", "object": "chat.completion.chunk", "model": model, "choices": []any{}, "usage": usage(s.reply)})
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
@@ -0,0 +1,269 @@
+// Package generaltest provides helpers for testing code built on general.
+package generaltest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/festeh/general"
+)
+
+// Mode selects whether a Recorder talks to providers or to its fixture.
+type Mode int
+
+const (
+	// ModeReplay serves responses from the fixture file. Requests that were
+	// not recorded get a 404 response, which Commands do not retry. No
+	// request reaches the network.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to providers and writes every interaction
+	// to the fixture file on Close, replacing its contents.
+	ModeRecord
+)
+
+// RecordEnv is the environment variable that makes VCR record instead of
+// replay when set to "record".
+const RecordEnv = "GENERAL_VCR"
+
+// Interaction is one recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the part of a request that identifies it on replay.
+// Secrets are redacted from the URL and body and headers are not kept.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// RecordedResponse is a recorded response. Streams are kept whole and
+// replayed at once.
+type RecordedResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body"`
+}
+
+// fixture is the file format of a Recorder.
+type fixture struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder is an http.RoundTripper that records provider interactions to a
+// fixture file or replays them from it. Identical requests are replayed in
+// the order they were recorded. It is safe for concurrent use.
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         map[int]bool
+}
+
+// NewRecorder returns a Recorder for the fixture at path. In ModeReplay the
+// fixture must exist; in ModeRecord requests are sent with
+// http.DefaultTransport.
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{path: path, mode: mode, transport: http.DefaultTransport, used: make(map[int]bool)}
+	if mode == ModeRecord {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	r.interactions = f.Interactions
+	return r, nil
+}
+
+// VCR returns a Recorder for testdata/fixtures/<name>.json that replays,
+// or records when RecordEnv is "record". The fixture is written when the
+// test finishes, and a replay or write failure fails the test.
+func VCR(t testing.TB, name string) *Recorder {
+	t.Helper()
+	mode := ModeReplay
+	if os.Getenv(RecordEnv) == "record" {
+		mode = ModeRecord
+	}
+	r, err := NewRecorder(filepath.Join("testdata", "fixtures", name+".json"), mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := r.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return r
+}
+
+// Client returns an HTTP client sending requests through r, for use with
+// general.WithHTTPClient. Providers with their own proxy or TLS settings
+// and Commands with transport tuning build their own transport and bypass r.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Option returns a general.Option sending the Command's requests through r.
+func (r *Recorder) Option() general.Option {
+	return general.WithHTTPClient(r.Client())
+}
+
+// RoundTrip records or replays req.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.mode == ModeReplay {
+		return r.replay(req, recorded)
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, Interaction{
+		Request:  recorded,
+		Response: RecordedResponse{Status: resp.StatusCode, Headers: resp.Header.Clone(), Body: string(body)},
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// replay returns the first unused interaction matching recorded.
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, in := range r.interactions {
+		if r.used[i] || in.Request != recorded {
+			continue
+		}
+		r.used[i] = true
+		return newResponse(req, in.Response), nil
+	}
+
+	message := fmt.Sprintf("no recorded interaction for %s %s in %s", recorded.Method, recorded.URL, r.path)
+	body, _ := json.Marshal(map[string]any{"error": map[string]string{"message": message, "code": "vcr_miss"}})
+	return newResponse(req, RecordedResponse{
+		Status:  http.StatusNotFound,
+		Headers: http.Header{"Content-Type": {"application/json"}},
+		Body:    string(body),
+	}), nil
+}
+
+// newResponse returns the replay of recorded as the response to req.
+func newResponse(req *http.Request, recorded RecordedResponse) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Headers.Clone(),
+		Body:          io.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}
+}
+
+// Close writes the recorded interactions to the fixture in ModeRecord.
+func (r *Recorder) Close() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(fixture{Interactions: r.interactions}, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode fixture: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	if err := os.WriteFile(r.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
+
+// recordRequest returns the identifying part of req, restoring its body
+// for sending.
+func recordRequest(req *http.Request) (RecordedRequest, error) {
+	recorded := RecordedRequest{Method: req.Method, URL: redactURL(req.URL)}
+	if req.Body == nil {
+		return recorded, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return RecordedRequest{}, fmt.Errorf("failed to read request: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		if body, err = gunzip(body); err != nil {
+			return RecordedRequest{}, err
+		}
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, body) == nil {
+		body = compact.Bytes()
+	}
+	recorded.Body = general.RedactSecrets(string(body))
+	return recorded, nil
+}
+
+// redactURL returns u without API keys passed as query parameters.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	for _, name := range []string{"key", "api_key"} {
+		if query.Has(name) {
+			query.Set(name, "REDACTED")
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	return general.RedactSecrets(redacted.String())
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress request: %w", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to decompress request: %w", err)
+	}
+	return body, nil
+}
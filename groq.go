@@ -0,0 +1,119 @@
+package general
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Groq service tiers for GroqOptions.ServiceTier.
+const (
+	GroqTierOnDemand = "on_demand"
+	GroqTierFlex     = "flex"
+	GroqTierAuto     = "auto"
+)
+
+// Groq reasoning formats for GroqOptions.ReasoningFormat.
+const (
+	GroqReasoningParsed = "parsed"
+	GroqReasoningRaw    = "raw"
+	GroqReasoningHidden = "hidden"
+)
+
+// GroqOptions holds request parameters only understood by Groq.
+// They are ignored for other providers.
+type GroqOptions struct {
+	// ServiceTier selects the capacity pool; flex trades availability for
+	// higher rate limits and fails fast when capacity is short.
+	ServiceTier string
+	// ReasoningFormat controls how reasoning models return their thinking.
+	// With "parsed" it is returned separately in Message.Reasoning.
+	ReasoningFormat string
+}
+
+// Diagnostics are provider-reported details of how a request was served.
+// Only Groq reports them so far.
+type Diagnostics struct {
+	RequestID   string `json:"request_id,omitempty"`
+	ServiceTier string `json:"service_tier,omitempty"`
+
+	// Server-side timings: time spent queued, processing the prompt,
+	// generating the completion, and in total.
+	QueueTime      time.Duration `json:"queue_time,omitempty"`
+	PromptTime     time.Duration `json:"prompt_time,omitempty"`
+	CompletionTime time.Duration `json:"completion_time,omitempty"`
+	TotalTime      time.Duration `json:"total_time,omitempty"`
+}
+
+// groqTiming is the timing block Groq adds to usage, in seconds.
+type groqTiming struct {
+	QueueTime      float64 `json:"queue_time"`
+	PromptTime     float64 `json:"prompt_time"`
+	CompletionTime float64 `json:"completion_time"`
+	TotalTime      float64 `json:"total_time"`
+}
+
+// groqMetadata holds the Groq-specific fields of a response or chunk. Full
+// responses put the timings in usage; streams send them in x_groq.usage with
+// the final chunk.
+type groqMetadata struct {
+	ServiceTier string      `json:"service_tier"`
+	Usage       *groqTiming `json:"usage"`
+	XGroq       *struct {
+		ID    string      `json:"id"`
+		Usage *groqTiming `json:"usage"`
+	} `json:"x_groq"`
+}
+
+func applyGroqFields(req ChatCompletionRequest, body requestBody) error {
+	if req.ReasoningEffort != "" {
+		if err := body.set("reasoning_effort", req.ReasoningEffort); err != nil {
+			return err
+		}
+	}
+	if req.Groq == nil {
+		return nil
+	}
+	if req.Groq.ServiceTier != "" {
+		if err := body.set("service_tier", req.Groq.ServiceTier); err != nil {
+			return err
+		}
+	}
+	if req.Groq.ReasoningFormat != "" {
+		if err := body.set("reasoning_format", req.Groq.ReasoningFormat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groqDiagnostics extracts the diagnostics from a Groq response or chunk,
+// returning nil when data carries none.
+func groqDiagnostics(data []byte) *Diagnostics {
+	var meta groqMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil
+	}
+
+	timing := meta.Usage
+	diag := Diagnostics{ServiceTier: meta.ServiceTier}
+	if meta.XGroq != nil {
+		diag.RequestID = meta.XGroq.ID
+		if meta.XGroq.Usage != nil {
+			timing = meta.XGroq.Usage
+		}
+	}
+	if timing != nil {
+		diag.QueueTime = seconds(timing.QueueTime)
+		diag.PromptTime = seconds(timing.PromptTime)
+		diag.CompletionTime = seconds(timing.CompletionTime)
+		diag.TotalTime = seconds(timing.TotalTime)
+	}
+	if diag == (Diagnostics{}) {
+		return nil
+	}
+	return &diag
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
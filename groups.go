@@ -0,0 +1,39 @@
+package general
+
+import "slices"
+
+// Group is a named set of targets that is executed together, such as an
+// ensemble of fast models queried side by side.
+type Group struct {
+	Name    string
+	Targets []Target
+}
+
+// NewGroup creates a group from targets.
+func NewGroup(name string, targets ...Target) Group {
+	return Group{Name: name, Targets: slices.Clone(targets)}
+}
+
+// Targets flattens groups into a single target list, in order.
+func Targets(groups ...Group) []Target {
+	var targets []Target
+	for _, g := range groups {
+		targets = append(targets, g.Targets...)
+	}
+	return targets
+}
+
+// WithGroups sends an Execute, ExecuteStream, Broadcast, Race, Quorum or
+// ExecuteFallback call to the targets of groups, in order, instead of the
+// configured targets.
+func WithGroups(groups ...Group) CallOption {
+	return func(cfg *callConfig) { cfg.targets = Targets(groups...) }
+}
+
+// callTargets returns the targets of a call made with cfg.
+func (c *Command) callTargets(cfg callConfig) []Target {
+	if cfg.targets != nil {
+		return cfg.targets
+	}
+	return c.targets
+}
@@ -0,0 +1,91 @@
+package general
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthStatus is the outcome of probing a provider.
+type HealthStatus struct {
+	Provider Provider
+	// Reachable is true when the provider answered with any HTTP response.
+	Reachable bool
+	// Authorized is true when the provider accepted the API key.
+	Authorized bool
+	Latency    time.Duration
+	// Models is the number of models listed by the provider.
+	Models int
+	Error  error
+}
+
+// OK reports whether the provider is reachable and accepted the API key.
+func (s HealthStatus) OK() bool {
+	return s.Reachable && s.Authorized && s.Error == nil
+}
+
+// HealthCheck probes every distinct provider among the configured targets
+// in parallel and returns one status per provider, in target order.
+func (c *Command) HealthCheck(ctx context.Context) []HealthStatus {
+	var providers []Provider
+	seen := make(map[[2]string]bool)
+	for _, t := range c.targets {
+		key := [2]string{t.Provider.Endpoint, t.Provider.keyPoolID()}
+		if !seen[key] {
+			seen[key] = true
+			providers = append(providers, t.Provider)
+		}
+	}
+
+	statuses := make([]HealthStatus, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = c.CheckProvider(ctx, p)
+		}()
+	}
+	wg.Wait()
+	return statuses
+}
+
+// CheckProvider probes provider by listing its models, which verifies
+// reachability and the API key without spending tokens.
+func (c *Command) CheckProvider(ctx context.Context, provider Provider) HealthStatus {
+	start := time.Now()
+	models, err := c.ListModels(ctx, provider)
+	status := HealthStatus{
+		Provider: provider,
+		Latency:  time.Since(start),
+		Models:   len(models),
+	}
+
+	var apiErr *APIError
+	switch {
+	case err == nil:
+		status.Reachable = true
+		status.Authorized = true
+	case errors.As(err, &apiErr):
+		status.Reachable = true
+		status.Authorized = apiErr.StatusCode != http.StatusUnauthorized && apiErr.StatusCode != http.StatusForbidden
+		// Providers without a models endpoint are healthy as far as the probe can tell.
+		if apiErr.StatusCode != http.StatusNotFound {
+			status.Error = err
+		}
+	default:
+		status.Error = err
+	}
+
+	if !status.OK() {
+		c.log(slog.LevelWarn, "health check failed",
+			"endpoint", provider.Endpoint,
+			"latency", status.Latency,
+			"error", err,
+		)
+	}
+	return status
+}
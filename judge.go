@@ -0,0 +1,145 @@
+package general
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DefaultRubric is the rubric Judge uses when none is given.
+const DefaultRubric = "Score how correct, complete, relevant and clear each response is as an answer to the prompt."
+
+// maxJudgeScore is the top of the scale judges score on.
+const maxJudgeScore = 10
+
+// judgeSystemPrompt instructs the judge model; the rubric is appended.
+const judgeSystemPrompt = `You are an impartial judge comparing responses to the same prompt.
+Score every response from 0 to 10 following the rubric, and give a one-sentence reason.
+Judge the content only: ignore response order and length unless the rubric says otherwise.
+Reply with only a JSON object: {"scores": [{"response": <number>, "score": <0-10>, "reason": "<text>"}]}.
+
+Rubric:
+`
+
+// judgeSchema is the reply Judge asks for.
+var judgeSchema = Schema{
+	"type":     "object",
+	"required": []string{"scores"},
+	"properties": map[string]any{
+		"scores": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type":     "object",
+				"required": []string{"response", "score"},
+				"properties": map[string]any{
+					"response": map[string]any{"type": "integer", "minimum": 1},
+					"score":    map[string]any{"type": "number", "minimum": 0, "maximum": maxJudgeScore},
+					"reason":   map[string]any{"type": "string"},
+				},
+			},
+		},
+	},
+}
+
+// JudgeScore is a judge's score of one result, from 0 to 10.
+type JudgeScore struct {
+	Result Result
+	Score  float64
+	Reason string
+}
+
+// Judgement is a judge model's assessment of a set of results.
+type Judgement struct {
+	// Scores holds the scores of the successful results, in input order.
+	Scores []JudgeScore
+	// Response is the judge's reply.
+	Response ChatCompletionResponse
+}
+
+// Ranking returns the scores from best to worst. Ties keep input order.
+func (j Judgement) Ranking() []JudgeScore {
+	ranked := slices.Clone(j.Scores)
+	slices.SortStableFunc(ranked, func(a, b JudgeScore) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+	return ranked
+}
+
+// Judge asks the judge target to score the successful results, typically
+// of a Broadcast of req, against rubric, or DefaultRubric if it is empty.
+// The judge sees the prompt of req and the anonymized replies, not which
+// target produced them.
+func (c *Command) Judge(ctx context.Context, judge Target, req ChatCompletionRequest, results []Result, rubric string) (Judgement, error) {
+	var judged []Result
+	for _, r := range results {
+		if r.Error == nil && len(r.Response.Choices) > 0 {
+			judged = append(judged, r)
+		}
+	}
+	if len(judged) == 0 {
+		return Judgement{}, errors.New("no successful results to judge")
+	}
+	if strings.TrimSpace(rubric) == "" {
+		rubric = DefaultRubric
+	}
+
+	judgeReq := ChatCompletionRequest{Messages: []ChatCompletionMessage{
+		SystemMessage(judgeSystemPrompt + rubric),
+		UserMessage(judgePrompt(req, judged)),
+	}}
+	resp, err := c.executeWithSchema(ctx, judge, judgeReq, judgeSchema)
+	if err != nil {
+		return Judgement{Response: resp}, fmt.Errorf("judge request failed: %w", err)
+	}
+
+	var reply struct {
+		Scores []struct {
+			Response int     `json:"response"`
+			Score    float64 `json:"score"`
+			Reason   string  `json:"reason"`
+		} `json:"scores"`
+	}
+	if err := DecodeJSON(resp, &reply); err != nil {
+		return Judgement{Response: resp}, fmt.Errorf("failed to decode judgement: %w", err)
+	}
+
+	judgement := Judgement{Response: resp, Scores: make([]JudgeScore, len(judged))}
+	scored := make([]bool, len(judged))
+	for _, s := range reply.Scores {
+		i := s.Response - 1
+		if i < 0 || i >= len(judged) {
+			return judgement, fmt.Errorf("judge scored unknown response %d", s.Response)
+		}
+		judgement.Scores[i] = JudgeScore{Result: judged[i], Score: s.Score, Reason: s.Reason}
+		scored[i] = true
+	}
+	for i, ok := range scored {
+		if !ok {
+			return judgement, fmt.Errorf("judge did not score response %d", i+1)
+		}
+	}
+	return judgement, nil
+}
+
+// judgePrompt presents the prompt of req and the replies of results.
+func judgePrompt(req ChatCompletionRequest, results []Result) string {
+	var b strings.Builder
+	b.WriteString("Prompt:\n")
+	for _, m := range req.Messages {
+		if text := m.Text(); text != "" {
+			fmt.Fprintf(&b, "[%s] %s\n", m.Role, text)
+		}
+	}
+	for i, r := range results {
+		fmt.Fprintf(&b, "\nResponse %d:\n%s\n", i+1, r.Content())
+	}
+	return b.String()
+}
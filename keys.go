@@ -0,0 +1,72 @@
+package general
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// KeyRotation selects how a Provider spreads requests across its APIKeys.
+type KeyRotation int
+
+const (
+	// RotateRoundRobin uses the next key for every request.
+	RotateRoundRobin KeyRotation = iota
+	// RotateOnRateLimit keeps using one key until it is rate limited.
+	RotateOnRateLimit
+)
+
+// WithKeys returns a copy of p that rotates across keys with the given strategy.
+func (p Provider) WithKeys(rotation KeyRotation, keys ...string) Provider {
+	p.APIKeys = append([]string(nil), keys...)
+	p.KeyRotation = rotation
+	return p
+}
+
+// keyPoolID identifies the key pool of p, so providers sharing an endpoint
+// and keys also share rotation state.
+func (p Provider) keyPoolID() string {
+	if len(p.APIKeys) == 0 {
+		return p.APIKey
+	}
+	return p.Endpoint + "\x00" + strings.Join(p.APIKeys, "\x00")
+}
+
+// selectKey returns p with APIKey set to the pool key for the next request.
+func (c *Command) selectKey(p Provider) Provider {
+	if len(p.APIKeys) == 0 {
+		return p
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		c.keys = make(map[string]int)
+	}
+	id := p.keyPoolID()
+	next := c.keys[id]
+	if p.KeyRotation == RotateRoundRobin {
+		c.keys[id] = (next + 1) % len(p.APIKeys)
+	}
+	p.APIKey = p.APIKeys[next%len(p.APIKeys)]
+	return p
+}
+
+// rotateOnRateLimit advances p's key pool past key when err is a rate limit
+// response, and reports whether another key is available to retry with.
+func (c *Command) rotateOnRateLimit(p Provider, key string, err error) bool {
+	var apiErr *APIError
+	if len(p.APIKeys) < 2 || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	if p.KeyRotation == RotateOnRateLimit {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		id := p.keyPoolID()
+		// Only advance if no concurrent request has already moved past key.
+		if p.APIKeys[c.keys[id]%len(p.APIKeys)] == key {
+			c.keys[id] = (c.keys[id] + 1) % len(p.APIKeys)
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package general
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ConcurrencyLimiter bounds the number of HTTP requests in flight across
+// every Command that shares it. Requests over the limit queue and are served
+// by priority (see WithPriority). A stream counts as in flight until it ends.
+type ConcurrencyLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	active int
+	queue  waitQueue
+	seq    uint64
+}
+
+// NewConcurrencyLimiter returns a limiter allowing n requests in flight.
+// A limit of 0 or less allows any number.
+func NewConcurrencyLimiter(n int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{limit: n}
+}
+
+// DefaultLimiter is shared by all Commands without their own limiter. It is
+// unlimited until SetLimit is called, so it bounds the whole process:
+//
+//	general.DefaultLimiter.SetLimit(32)
+var DefaultLimiter = NewConcurrencyLimiter(0)
+
+// WithConcurrencyLimiter makes the Command share limiter instead of DefaultLimiter.
+func WithConcurrencyLimiter(limiter *ConcurrencyLimiter) Option {
+	return func(c *Command) { c.limiter = limiter }
+}
+
+// SetLimit changes the number of requests allowed in flight. Raising it
+// releases queued requests at once; lowering it lets the excess finish.
+func (l *ConcurrencyLimiter) SetLimit(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = n
+	l.dispatch()
+}
+
+// InFlight returns the number of requests currently holding a slot.
+func (l *ConcurrencyLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active
+}
+
+// Waiting returns the number of requests queued for a slot.
+func (l *ConcurrencyLimiter) Waiting() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queue.Len()
+}
+
+// acquire blocks until a slot is free or ctx is done. The returned function
+// releases the slot and must be called once the request is complete.
+func (l *ConcurrencyLimiter) acquire(ctx context.Context, priority Priority) (func(), error) {
+	l.mu.Lock()
+	if l.queue.Len() == 0 && l.free() {
+		l.active++
+		l.mu.Unlock()
+		return l.releaser(), nil
+	}
+	w := &waiter{priority: priority, seq: l.seq, ready: make(chan struct{})}
+	l.seq++
+	heap.Push(&l.queue, w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return l.releaser(), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Granted concurrently; hand the slot on.
+			l.active--
+			l.dispatch()
+		default:
+			l.queue.remove(w)
+		}
+		return nil, fmt.Errorf("concurrency limit wait aborted: %w", ctx.Err())
+	}
+}
+
+func (l *ConcurrencyLimiter) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.active--
+			l.dispatch()
+		})
+	}
+}
+
+// free reports whether another request may start. l.mu must be held.
+func (l *ConcurrencyLimiter) free() bool {
+	return l.limit <= 0 || l.active < l.limit
+}
+
+// dispatch hands free slots to queued requests in priority order.
+// l.mu must be held.
+func (l *ConcurrencyLimiter) dispatch() {
+	for l.queue.Len() > 0 && l.free() {
+		l.active++
+		close(heap.Pop(&l.queue).(*waiter).ready)
+	}
+}
+
+// acquireSlot takes a slot of the Command's concurrency limiter for a request.
+func (c *Command) acquireSlot(ctx context.Context) (func(), error) {
+	limiter := c.limiter
+	if limiter == nil {
+		limiter = DefaultLimiter
+	}
+	return limiter.acquire(ctx, callOptions(ctx).priority)
+}
@@ -0,0 +1,36 @@
+package general
+
+import "math"
+
+// Sum returns the total log probability of the sampled tokens.
+func (l *Logprobs) Sum() float64 {
+	if l == nil {
+		return 0
+	}
+	var sum float64
+	for _, t := range l.Content {
+		sum += t.Logprob
+	}
+	return sum
+}
+
+// Mean returns the average log probability per sampled token, or 0 without tokens.
+func (l *Logprobs) Mean() float64 {
+	if l == nil || len(l.Content) == 0 {
+		return 0
+	}
+	return l.Sum() / float64(len(l.Content))
+}
+
+// Perplexity returns exp(-Mean()); lower values mean the model was more certain.
+func (l *Logprobs) Perplexity() float64 {
+	return math.Exp(-l.Mean())
+}
+
+// Confidence returns the geometric mean probability of the sampled tokens, in [0, 1].
+func (l *Logprobs) Confidence() float64 {
+	if l == nil || len(l.Content) == 0 {
+		return 0
+	}
+	return math.Exp(l.Mean())
+}
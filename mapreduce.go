@@ -0,0 +1,260 @@
+package general
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+const (
+	defaultChunkTokens    = 4000
+	defaultMapConcurrency = 4
+
+	// DefaultMapPrompt summarizes one chunk of a document.
+	DefaultMapPrompt = "Summarize part {{.index}} of {{.total}} of a document, keeping every key fact:\n\n{{.chunk}}"
+	// DefaultReducePrompt combines the summaries of consecutive chunks.
+	DefaultReducePrompt = "Combine these summaries of consecutive parts of a document into one coherent summary:\n\n{{.partials}}"
+)
+
+// partialSeparator separates the partial outputs joined into {{.partials}}.
+const partialSeparator = "\n\n---\n\n"
+
+// MapReduce configures Command.MapReduce.
+type MapReduce struct {
+	// Map is the prompt template run on each chunk, with {{.chunk}},
+	// {{.index}} (from 1) and {{.total}}. It defaults to DefaultMapPrompt.
+	Map string
+	// Reduce is the prompt template combining the map outputs, with
+	// {{.partials}} joined by separator lines and {{.parts}} as a list. It
+	// defaults to DefaultReducePrompt.
+	Reduce string
+	// ChunkTokens is the size limit of chunks, counted with the tokenizer of
+	// the first target's model. It defaults to 4000. Partials that together
+	// exceed it are reduced in several rounds.
+	ChunkTokens int
+	// Concurrency bounds the map requests in flight. It defaults to 4.
+	Concurrency int
+	// Request is the base of every request: generation parameters and any
+	// leading messages.
+	Request ChatCompletionRequest
+}
+
+// MapReduceResult holds the requests of a map-reduce run.
+type MapReduceResult struct {
+	Chunks []string
+	// Map holds the result of each chunk, in chunk order.
+	Map []Result
+	// Reduce holds the reduce requests in the order they ran; the last one
+	// produced the output.
+	Reduce []Result
+}
+
+// Output returns the final reply.
+func (r MapReduceResult) Output() string {
+	if len(r.Reduce) > 0 {
+		return r.Reduce[len(r.Reduce)-1].Content()
+	}
+	if len(r.Map) == 1 {
+		return r.Map[0].Content()
+	}
+	return ""
+}
+
+// MapReduce splits input into chunks, runs the map prompt on every chunk,
+// spreading the chunks over the Command's targets, and combines the outputs
+// with the reduce prompt on the first target. A chunk whose target fails is
+// retried on the other targets. Requests are subject to the Command's rate
+// and concurrency limits. A single chunk is not reduced.
+func (c *Command) MapReduce(ctx context.Context, input string, mr MapReduce) (MapReduceResult, error) {
+	if len(c.targets) == 0 {
+		return MapReduceResult{}, errors.New("no targets configured")
+	}
+	if mr.Map == "" {
+		mr.Map = DefaultMapPrompt
+	}
+	if mr.Reduce == "" {
+		mr.Reduce = DefaultReducePrompt
+	}
+	if mr.ChunkTokens <= 0 {
+		mr.ChunkTokens = defaultChunkTokens
+	}
+	if mr.Concurrency <= 0 {
+		mr.Concurrency = defaultMapConcurrency
+	}
+	mapTmpl, err := template.New("map").Option("missingkey=error").Parse(mr.Map)
+	if err != nil {
+		return MapReduceResult{}, fmt.Errorf("invalid map prompt: %w", err)
+	}
+	reduceTmpl, err := template.New("reduce").Option("missingkey=error").Parse(mr.Reduce)
+	if err != nil {
+		return MapReduceResult{}, fmt.Errorf("invalid reduce prompt: %w", err)
+	}
+
+	ctx, cancel := withCallConfig(ctx, callConfig{})
+	defer cancel()
+	tokenizer := TokenizerFor(c.targets[0].Model)
+	result := MapReduceResult{Chunks: ChunkText(input, mr.ChunkTokens, tokenizer)}
+	if len(result.Chunks) == 0 {
+		return result, errors.New("empty input")
+	}
+
+	prompts := make([]string, len(result.Chunks))
+	for i, chunk := range result.Chunks {
+		prompts[i], err = render(mapTmpl, map[string]any{"chunk": chunk, "index": i + 1, "total": len(result.Chunks)})
+		if err != nil {
+			return result, err
+		}
+	}
+	result.Map = c.mapChunks(ctx, mr, prompts)
+	partials := make([]string, len(result.Map))
+	for i, r := range result.Map {
+		if r.Error != nil {
+			return result, fmt.Errorf("map of chunk %d failed: %w", i+1, r.Error)
+		}
+		partials[i] = r.Content()
+	}
+
+	for len(partials) > 1 {
+		groups := groupPartials(partials, mr.ChunkTokens, tokenizer)
+		if len(groups) == len(partials) {
+			// No two partials fit in one request; combine them all at once.
+			groups = [][]string{partials}
+		}
+		var next []string
+		for _, group := range groups {
+			prompt, err := render(reduceTmpl, map[string]any{"partials": strings.Join(group, partialSeparator), "parts": group})
+			if err != nil {
+				return result, err
+			}
+			r := c.mapReduceRequest(ctx, mr, c.targets[:1], prompt)
+			result.Reduce = append(result.Reduce, r)
+			if r.Error != nil {
+				return result, fmt.Errorf("reduce failed: %w", r.Error)
+			}
+			next = append(next, r.Content())
+		}
+		partials = next
+	}
+	return result, nil
+}
+
+// mapChunks runs prompts with at most mr.Concurrency in flight, assigning
+// them to the targets round-robin. It stops starting requests once one
+// fails for good.
+func (c *Command) mapChunks(ctx context.Context, mr MapReduce, prompts []string) []Result {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]Result, len(prompts))
+	slots := make(chan struct{}, mr.Concurrency)
+	var wg sync.WaitGroup
+	for i, prompt := range prompts {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = Result{Error: ctx.Err()}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			first := i % len(c.targets)
+			targets := slices.Concat(c.targets[first:], c.targets[:first])
+			results[i] = c.mapReduceRequest(ctx, mr, targets, prompt)
+			if results[i].Error != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// mapReduceRequest sends prompt to the first of targets that succeeds.
+func (c *Command) mapReduceRequest(ctx context.Context, mr MapReduce, targets []Target, prompt string) Result {
+	req := mr.Request
+	req.Messages = append(req.Messages[:len(req.Messages):len(req.Messages)], UserMessage(prompt))
+	var r Result
+	for _, target := range targets {
+		if r = c.executeAndLog(ctx, target, req); r.Error == nil || ctx.Err() != nil {
+			return r
+		}
+	}
+	return r
+}
+
+// groupPartials splits partials into consecutive groups of at most limit
+// tokens, each holding at least one partial.
+func groupPartials(partials []string, limit int, tokenizer Tokenizer) [][]string {
+	var groups [][]string
+	var group []string
+	size := 0
+	for _, p := range partials {
+		n := tokenizer.Count(p)
+		if len(group) > 0 && size+n > limit {
+			groups = append(groups, group)
+			group, size = nil, 0
+		}
+		group = append(group, p)
+		size += n
+	}
+	return append(groups, group)
+}
+
+// ChunkText splits text into chunks of at most limit tokens as counted by
+// tokenizer, breaking between paragraphs where possible, then between
+// lines, then between words. Words longer than limit are kept whole.
+func ChunkText(text string, limit int, tokenizer Tokenizer) []string {
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if chunk := strings.TrimSpace(current.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+	}
+
+	var add func(piece string, separators []string)
+	add = func(piece string, separators []string) {
+		if strings.TrimSpace(piece) == "" {
+			return
+		}
+		joined := current.String() + separators[0] + piece
+		if current.Len() == 0 {
+			joined = piece
+		}
+		if tokenizer.Count(joined) <= limit {
+			current.Reset()
+			current.WriteString(joined)
+			return
+		}
+		flush()
+		if tokenizer.Count(piece) <= limit || len(separators) == 1 {
+			current.WriteString(piece)
+			return
+		}
+		for _, sub := range strings.Split(piece, separators[1]) {
+			add(sub, separators[1:])
+		}
+		flush()
+	}
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		add(paragraph, []string{"\n\n", "\n", " "})
+	}
+	flush()
+	return chunks
+}
+
+// render executes tmpl with data.
+func render(tmpl *template.Template, data map[string]any) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render %s prompt: %w", tmpl.Name(), err)
+	}
+	return b.String(), nil
+}
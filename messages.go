@@ -0,0 +1,190 @@
+package general
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Role identifies the author of a message.
+type Role string
+
+// Message roles understood by OpenAI-compatible APIs.
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+	RoleTool      Role = "tool"
+)
+
+// MarshalText encodes the role as its plain string value.
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r), nil
+}
+
+// UnmarshalText decodes a role, normalizing case so "Assistant" reads as RoleAssistant.
+func (r *Role) UnmarshalText(text []byte) error {
+	*r = Role(strings.ToLower(string(text)))
+	return nil
+}
+
+// ToolType identifies the kind of a tool or tool call.
+type ToolType string
+
+// ToolTypeFunction is the only tool type defined by OpenAI-compatible APIs.
+const ToolTypeFunction ToolType = "function"
+
+// MarshalText encodes the tool type, defaulting an empty value to ToolTypeFunction.
+func (t ToolType) MarshalText() ([]byte, error) {
+	if t == "" {
+		return []byte(ToolTypeFunction), nil
+	}
+	return []byte(t), nil
+}
+
+// UnmarshalText decodes a tool type, treating an empty value as ToolTypeFunction.
+func (t *ToolType) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*t = ToolTypeFunction
+		return nil
+	}
+	*t = ToolType(text)
+	return nil
+}
+
+// SystemMessage returns a system message with the given content.
+func SystemMessage(content string) ChatCompletionMessage {
+	return ChatCompletionMessage{Role: RoleSystem, Content: content}
+}
+
+// UserMessage returns a user message with the given content.
+func UserMessage(content string) ChatCompletionMessage {
+	return ChatCompletionMessage{Role: RoleUser, Content: content}
+}
+
+// AssistantMessage returns an assistant message with the given content.
+func AssistantMessage(content string) ChatCompletionMessage {
+	return ChatCompletionMessage{Role: RoleAssistant, Content: content}
+}
+
+// ToolResult returns a tool message answering the tool call with the given ID.
+func ToolResult(toolCallID, content string) ChatCompletionMessage {
+	return ChatCompletionMessage{Role: RoleTool, Content: content, ToolCallID: toolCallID}
+}
+
+// FunctionTool returns a function tool definition.
+func FunctionTool(name, description string, parameters ToolParameters) Tool {
+	return Tool{
+		Type: ToolTypeFunction,
+		Function: ToolFunc{
+			Name:        name,
+			Description: description,
+			Parameters:  parameters,
+		},
+	}
+}
+
+// messageAlias has the fields of ChatCompletionMessage without its JSON methods.
+type messageAlias ChatCompletionMessage
+
+// MarshalJSON encodes the message, sending Parts or a cache-controlled Content
+// as a content array and plain Content as a string.
+func (m ChatCompletionMessage) MarshalJSON() ([]byte, error) {
+	wire := struct {
+		messageAlias
+		Content any `json:"content,omitempty"`
+	}{messageAlias: messageAlias(m)}
+
+	switch {
+	case len(m.Parts) > 0:
+		wire.Content = m.Parts
+	case m.CacheControl != nil && m.Content != "":
+		wire.Content = []ContentPart{{Type: "text", Text: m.Content, CacheControl: m.CacheControl}}
+	case m.Content != "":
+		wire.Content = m.Content
+	}
+	return json.Marshal(wire)
+}
+
+// UnmarshalJSON decodes a message whose content is either a string or an
+// array of parts. Text parts are also joined into Content. Reasoning is read
+// from the reasoning_content or reasoning field.
+func (m *ChatCompletionMessage) UnmarshalJSON(data []byte) error {
+	wire := struct {
+		*messageAlias
+		Content          json.RawMessage `json:"content"`
+		ReasoningContent string          `json:"reasoning_content"`
+		ReasoningText    string          `json:"reasoning"`
+		Refusal          string          `json:"refusal"`
+	}{messageAlias: (*messageAlias)(m)}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	m.Reasoning = wire.ReasoningContent + wire.ReasoningText
+	m.Refusal = wire.Refusal
+
+	content := bytes.TrimSpace(wire.Content)
+	switch {
+	case len(content) == 0 || bytes.Equal(content, []byte("null")):
+		return nil
+	case content[0] == '[':
+		if err := json.Unmarshal(content, &m.Parts); err != nil {
+			return err
+		}
+		m.Content = m.Text()
+		return nil
+	default:
+		return json.Unmarshal(content, &m.Content)
+	}
+}
+
+// Text returns the message content, joining text parts when Parts is set.
+func (m ChatCompletionMessage) Text() string {
+	if len(m.Parts) == 0 {
+		return m.Content
+	}
+	var texts []string
+	for _, p := range m.Parts {
+		if p.Type == "text" && p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// TextPart returns a text content part.
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: "text", Text: text}
+}
+
+// ImagePart returns an image content part referencing url.
+func ImagePart(url string) ContentPart {
+	return ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url}}
+}
+
+// EphemeralCache returns the cache control hint for Anthropic's default cache.
+func EphemeralCache() *CacheControl {
+	return &CacheControl{Type: "ephemeral"}
+}
+
+// CacheReadTokens returns the number of prompt tokens served from cache.
+func (u Usage) CacheReadTokens() int {
+	if u.CacheReadInputTokens > 0 {
+		return u.CacheReadInputTokens
+	}
+	if u.PromptTokensDetails != nil {
+		return u.PromptTokensDetails.CachedTokens
+	}
+	return 0
+}
+
+// CacheWriteTokens returns the number of prompt tokens written to cache.
+func (u Usage) CacheWriteTokens() int {
+	if u.CacheCreationInputTokens > 0 {
+		return u.CacheCreationInputTokens
+	}
+	if u.PromptTokensDetails != nil {
+		return u.PromptTokensDetails.CacheWriteTokens
+	}
+	return 0
+}
@@ -0,0 +1,141 @@
+package general
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Call is one request to one target as seen by middleware. Target aliases
+// are resolved and Request.Model is the target's model.
+type Call struct {
+	Target  Target
+	Request ChatCompletionRequest
+	// Stream is set when the caller consumes the response as a stream.
+	Stream bool
+}
+
+// Handler sends a call and returns the assembled response.
+type Handler func(ctx context.Context, call Call) (ChatCompletionResponse, error)
+
+// Middleware wraps the Handler that sends every request of a Command. It
+// may modify the call before passing it on, inspect or replace the response,
+// or return without calling next to short-circuit the request. A streaming
+// call that is short-circuited delivers the returned response as one chunk.
+type Middleware func(next Handler) Handler
+
+// Use adds mw to the Command's middleware chain. Middleware added first runs
+// outermost. The built-in scrubbing, moderation, audit logging, result
+// recording, gateway budget charging, caching and statistics run inside all
+// added middleware, in that order, so added middleware sees the request
+// before it is scrubbed and observes cache hits. To run scrubbing or
+// moderation elsewhere, or not at all, Use ScrubMiddleware and
+// ModerationMiddleware instead of WithScrubbers and SetModeration.
+func (c *Command) Use(mw Middleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.middleware = append(c.middleware, mw)
+}
+
+// chain returns send wrapped in the added and built-in middleware.
+func (c *Command) chain(send Handler) Handler {
+	c.mu.Lock()
+	middleware := append([]Middleware(nil), c.middleware...)
+	c.mu.Unlock()
+
+	middleware = append(middleware, c.guards()...)
+	if c.audit != nil {
+		middleware = append(middleware, c.auditMiddleware)
+	}
+	if c.store != nil {
+		middleware = append(middleware, c.storeMiddleware)
+	}
+	middleware = append(middleware, chargeMiddleware)
+	if c.cache != nil {
+		middleware = append(middleware, c.cacheMiddleware)
+	}
+	middleware = append(middleware, c.statsMiddleware)
+
+	h := send
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// guards returns the built-in middleware that scrubs and moderates
+// requests, in the order the chain runs it.
+func (c *Command) guards() []Middleware {
+	var middleware []Middleware
+	if len(c.scrubbers) > 0 {
+		middleware = append(middleware, ScrubMiddleware(c.scrubbers...))
+	}
+	if c.moderation != nil {
+		middleware = append(middleware, c.ModerationMiddleware(*c.moderation))
+	}
+	return middleware
+}
+
+// body encodes the request of call as it is sent to the provider.
+func (call Call) body() ([]byte, error) {
+	body, err := marshalRequest(call.Target, call.Request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	// The native Gemini API streams from its own URL instead.
+	if call.Stream && !call.Target.Provider.GeminiNative {
+		return withStreamFields(body)
+	}
+	return body, nil
+}
+
+// auditMiddleware records every call, cache hits included, in the audit log.
+func (c *Command) auditMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call Call) (ChatCompletionResponse, error) {
+		start := time.Now()
+		resp, err := next(ctx, call)
+		body, _ := call.body()
+		c.auditRequest(call.Target, body, resp, err, start, call.Stream, resp.Cached)
+		return resp, err
+	}
+}
+
+// cacheMiddleware serves repeated plain requests from the Command's cache
+// unless the call disables it.
+func (c *Command) cacheMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call Call) (ChatCompletionResponse, error) {
+		if call.Stream || callOptions(ctx).noCache {
+			return next(ctx, call)
+		}
+		body, err := call.body()
+		if err != nil {
+			return ChatCompletionResponse{}, err
+		}
+		key := cacheKey(call.Target, body)
+		if resp, ok := c.cache.Get(key); ok {
+			c.log(slog.LevelDebug, "cache hit",
+				"endpoint", call.Target.Provider.Endpoint,
+				"model", call.Target.Model,
+			)
+			resp.Cached = true
+			return resp, nil
+		}
+
+		resp, err := next(ctx, call)
+		if err == nil {
+			c.cache.Set(key, resp)
+		}
+		return resp, err
+	}
+}
+
+// statsMiddleware records the outcome of requests sent to providers.
+func (c *Command) statsMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call Call) (ChatCompletionResponse, error) {
+		start := time.Now()
+		resp, err := next(ctx, call)
+		c.stats.record(call.Target, resp.Usage, err, time.Since(start))
+		return resp, err
+	}
+}
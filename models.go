@@ -0,0 +1,108 @@
+package general
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// modelQuirks lists API differences by model name prefix. Prefixes are matched
+// after vendor prefixes such as "openai/" are stripped.
+var modelQuirks = []struct {
+	prefix              string
+	maxCompletionTokens bool
+}{
+	{prefix: "o1", maxCompletionTokens: true},
+	{prefix: "o3", maxCompletionTokens: true},
+	{prefix: "o4", maxCompletionTokens: true},
+	{prefix: "gpt-5", maxCompletionTokens: true},
+}
+
+// requiresMaxCompletionTokens reports whether model rejects the legacy
+// max_tokens field in favor of max_completion_tokens.
+func requiresMaxCompletionTokens(model string) bool {
+	name := baseModelName(model)
+	for _, q := range modelQuirks {
+		if strings.HasPrefix(name, q.prefix) {
+			return q.maxCompletionTokens
+		}
+	}
+	return false
+}
+
+// baseModelName lowercases model and strips any vendor prefix.
+func baseModelName(model string) string {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// Model describes a model offered by a provider.
+type Model struct {
+	ID            string
+	Name          string
+	OwnedBy       string
+	Created       int64
+	ContextLength int
+}
+
+// modelsResponse covers the /models response shapes of the supported providers.
+type modelsResponse struct {
+	Data []struct {
+		ID            string `json:"id"`
+		Name          string `json:"name"`
+		DisplayName   string `json:"display_name"`
+		OwnedBy       string `json:"owned_by"`
+		Created       int64  `json:"created"`
+		ContextLength int    `json:"context_length"`
+		ContextWindow int    `json:"context_window"`
+	} `json:"data"`
+
+	// Models is the listing of the native Gemini API.
+	Models []struct {
+		Name            string `json:"name"`
+		DisplayName     string `json:"displayName"`
+		InputTokenLimit int    `json:"inputTokenLimit"`
+	} `json:"models"`
+}
+
+// ListModels fetches the models available from provider's /models endpoint,
+// sorted by ID. IDs are normalized so they can be used as Target.Model.
+func (c *Command) ListModels(ctx context.Context, provider Provider) ([]Model, error) {
+	var response modelsResponse
+	if err := c.doJSON(ctx, provider, "GET", provider.baseURL()+"/models", nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+
+	models := make([]Model, 0, len(response.Data))
+	for _, m := range response.Data {
+		model := Model{
+			// Gemini reports IDs as "models/<name>" but expects the bare name.
+			ID:            strings.TrimPrefix(m.ID, "models/"),
+			Name:          m.Name,
+			OwnedBy:       m.OwnedBy,
+			Created:       m.Created,
+			ContextLength: m.ContextLength,
+		}
+		if model.Name == "" {
+			model.Name = m.DisplayName
+		}
+		if model.ContextLength == 0 {
+			model.ContextLength = m.ContextWindow
+		}
+		models = append(models, model)
+	}
+	for _, m := range response.Models {
+		models = append(models, Model{
+			ID:            strings.TrimPrefix(m.Name, "models/"),
+			Name:          m.DisplayName,
+			ContextLength: m.InputTokenLimit,
+		})
+	}
+
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
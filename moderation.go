@@ -0,0 +1,132 @@
+package general
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const defaultModerationModel = "omni-moderation-latest"
+
+// ModerationResult is the outcome of moderating a single input.
+type ModerationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// FlaggedCategories returns the sorted names of the categories that were flagged.
+func (r ModerationResult) FlaggedCategories() []string {
+	var flagged []string
+	for name, on := range r.Categories {
+		if on {
+			flagged = append(flagged, name)
+		}
+	}
+	sort.Strings(flagged)
+	return flagged
+}
+
+// ModerationError is returned when the pre-flight moderation check flags a prompt.
+type ModerationError struct {
+	Result ModerationResult
+}
+
+func (e *ModerationError) Error() string {
+	categories := e.Result.FlaggedCategories()
+	if len(categories) == 0 {
+		return "prompt flagged by moderation"
+	}
+	return fmt.Sprintf("prompt flagged by moderation: %s", strings.Join(categories, ", "))
+}
+
+type moderationRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type moderationResponse struct {
+	Results []ModerationResult `json:"results"`
+}
+
+// SetModeration enables a moderation check against provider, run by
+// ModerationMiddleware among the built-in middleware, after scrubbing.
+// Prompts that are flagged fail every target with a *ModerationError
+// before any completion request is sent.
+func (c *Command) SetModeration(provider Provider) {
+	c.moderation = &provider
+}
+
+// ModerationMiddleware returns middleware that checks the user messages of
+// every call against provider's moderation endpoint and fails calls whose
+// prompt is flagged with a *ModerationError, without sending them. The
+// calls of one Execute, Broadcast or batch share the check of a prompt.
+// Use it instead of SetModeration to choose where in the chain it runs.
+func (c *Command) ModerationMiddleware(provider Provider) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call Call) (ChatCompletionResponse, error) {
+			if err := c.moderate(ctx, provider, call.Request); err != nil {
+				return ChatCompletionResponse{}, err
+			}
+			return next(ctx, call)
+		}
+	}
+}
+
+// Moderate runs input through the provider's /moderations endpoint.
+func (c *Command) Moderate(ctx context.Context, provider Provider, input string) (ModerationResult, error) {
+	var response moderationResponse
+	err := c.doJSON(ctx, provider, "POST", provider.baseURL()+"/moderations",
+		moderationRequest{Model: defaultModerationModel, Input: input}, &response)
+	if err != nil {
+		return ModerationResult{}, fmt.Errorf("moderation request failed: %w", err)
+	}
+	if len(response.Results) == 0 {
+		return ModerationResult{}, fmt.Errorf("no results in moderation response")
+	}
+
+	return response.Results[0], nil
+}
+
+// moderate checks the user messages of req against provider, once per
+// call made with ctx.
+func (c *Command) moderate(ctx context.Context, provider Provider, req ChatCompletionRequest) error {
+	var parts []string
+	for _, m := range req.Messages {
+		if text := m.Text(); m.Role == RoleUser && text != "" {
+			parts = append(parts, text)
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+
+	input := strings.Join(parts, "\n\n")
+	check := func() error { return c.checkModeration(ctx, provider, input) }
+	if checks := callOptions(ctx).moderations; checks != nil {
+		key := sha256.Sum256([]byte(provider.Endpoint + "\x00" + input))
+		once, _ := checks.LoadOrStore(key, sync.OnceValue(check))
+		return once.(func() error)()
+	}
+	return check()
+}
+
+// checkModeration runs input through provider and returns a
+// *ModerationError if it is flagged.
+func (c *Command) checkModeration(ctx context.Context, provider Provider, input string) error {
+	result, err := c.Moderate(ctx, provider, input)
+	if err != nil {
+		return fmt.Errorf("moderation check failed: %w", err)
+	}
+	if result.Flagged {
+		c.log(slog.LevelWarn, "prompt flagged by moderation",
+			"categories", result.FlaggedCategories(),
+		)
+		return &ModerationError{Result: result}
+	}
+	return nil
+}
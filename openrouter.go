@@ -0,0 +1,51 @@
+package general
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Cost returns the USD cost of the request as reported by the provider, or 0
+// if it reported none. OpenRouter reports it for every request.
+func (r Result) Cost() float64 {
+	if r.Response.Usage == nil {
+		return 0
+	}
+	return r.Response.Usage.Cost
+}
+
+// Credits is the balance of an OpenRouter account in USD.
+type Credits struct {
+	Total float64 // credits purchased
+	Used  float64 // credits spent
+}
+
+// Remaining returns the unspent balance.
+func (c Credits) Remaining() float64 {
+	return c.Total - c.Used
+}
+
+// Credits fetches the account balance of the first OpenRouter target.
+func (c *Command) Credits(ctx context.Context) (Credits, error) {
+	for _, t := range c.targets {
+		if t.Provider.Name() == ProviderOpenRouter {
+			return c.ProviderCredits(ctx, t.Provider)
+		}
+	}
+	return Credits{}, errors.New("no OpenRouter target configured")
+}
+
+// ProviderCredits fetches the account balance of an OpenRouter provider.
+func (c *Command) ProviderCredits(ctx context.Context, provider Provider) (Credits, error) {
+	var response struct {
+		Data struct {
+			TotalCredits float64 `json:"total_credits"`
+			TotalUsage   float64 `json:"total_usage"`
+		} `json:"data"`
+	}
+	if err := c.doJSON(ctx, provider, "GET", provider.baseURL()+"/credits", nil, &response); err != nil {
+		return Credits{}, fmt.Errorf("failed to fetch credits: %w", err)
+	}
+	return Credits{Total: response.Data.TotalCredits, Used: response.Data.TotalUsage}, nil
+}
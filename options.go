@@ -0,0 +1,70 @@
+package general
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Option configures a Command created by NewCommand.
+type Option func(*Command)
+
+// RetryPolicy controls how failed requests are retried. Attempts back off
+// exponentially from BaseDelay, except that rate limits wait as long as the
+// provider asks in a Retry-After header.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	BaseDelay   time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy of a Command without WithRetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second}
+
+// WithLogger logs requests to logger. Without it nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Command) { c.logger = logger }
+}
+
+// WithTimeout sets the total timeout of each HTTP request, streams
+// included. Use WithTimeouts for finer control.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Command) { c.timeouts.Total = timeout }
+}
+
+// WithHTTPClient sends requests with client. Providers with their own proxy
+// or TLS configuration, and Commands with transport tuning or connection
+// timeouts, get a copy of client whose *http.Transport carries those
+// settings. A Transport of another type, such as a generaltest.Recorder, is
+// used unchanged.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Command) { c.client = client }
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Command) {
+		policy.MaxAttempts = max(policy.MaxAttempts, 1)
+		c.retry = policy
+	}
+}
+
+// WithCache serves repeated identical requests from cache.
+func WithCache(cache Cache) Option {
+	return func(c *Command) { c.cache = cache }
+}
+
+// WithRateLimit limits requests to each provider endpoint to rps per second,
+// allowing bursts of up to burst requests.
+func WithRateLimit(rps float64, burst int) Option {
+	return func(c *Command) {
+		c.rateLimit = rateLimit{rps: rps, burst: max(burst, 1)}
+	}
+}
+
+// WithStreamIdleTimeout cuts off streams that send nothing for timeout,
+// independently of the total timeout. A stall before the first chunk is
+// retried; a stall later ends the stream with ErrStreamInterrupted.
+func WithStreamIdleTimeout(timeout time.Duration) Option {
+	return func(c *Command) { c.idleTimeout = timeout }
+}
@@ -0,0 +1,120 @@
+package general
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"text/template"
+)
+
+// Step is one stage of a Pipeline: a prompt template sent to a target.
+type Step struct {
+	// Name is the template variable under which later steps see the output
+	// of this step. It defaults to step1, step2 and so on.
+	Name   string
+	Target Target
+	// Prompt is a text/template rendered with the pipeline variables and the
+	// outputs of the previous steps, and sent as a user message. The output
+	// of the step just before is also available as {{.previous}}.
+	Prompt string
+	// Request is the base of the step's request: generation parameters and
+	// any leading messages, such as a system prompt.
+	Request ChatCompletionRequest
+	// Retry overrides the Command's retry policy for this step.
+	Retry *RetryPolicy
+}
+
+// Pipeline runs steps in sequence, each receiving the outputs of the ones
+// before it.
+type Pipeline struct {
+	cmd       *Command
+	steps     []Step
+	templates []*template.Template
+}
+
+// NewPipeline returns a pipeline running steps with cmd. It fails if a
+// prompt template does not parse or two steps share a name.
+func NewPipeline(cmd *Command, steps ...Step) (*Pipeline, error) {
+	p := &Pipeline{cmd: cmd}
+	seen := make(map[string]bool)
+	for i, step := range steps {
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step%d", i+1)
+		}
+		if seen[step.Name] {
+			return nil, fmt.Errorf("duplicate pipeline step %q", step.Name)
+		}
+		seen[step.Name] = true
+
+		tmpl, err := template.New(step.Name).Option("missingkey=error").Parse(step.Prompt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prompt of step %q: %w", step.Name, err)
+		}
+		p.steps = append(p.steps, step)
+		p.templates = append(p.templates, tmpl)
+	}
+	return p, nil
+}
+
+// PipelineResult holds the outcome of each step that ran.
+type PipelineResult struct {
+	// Steps holds the result of each step that ran, in order.
+	Steps []Result
+	// Outputs maps step names to their replies.
+	Outputs map[string]string
+}
+
+// Output returns the reply of the last step that ran.
+func (r PipelineResult) Output() string {
+	if len(r.Steps) == 0 {
+		return ""
+	}
+	return r.Steps[len(r.Steps)-1].Content()
+}
+
+// Run executes the steps with vars as template variables. It stops at the
+// first failing step or when ctx is done, returning the steps run so far.
+func (p *Pipeline) Run(ctx context.Context, vars map[string]any) (PipelineResult, error) {
+	result := PipelineResult{Outputs: make(map[string]string)}
+	data := maps.Clone(vars)
+	if data == nil {
+		data = make(map[string]any)
+	}
+
+	for i, step := range p.steps {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		var prompt strings.Builder
+		if err := p.templates[i].Execute(&prompt, data); err != nil {
+			return result, fmt.Errorf("failed to render prompt of step %q: %w", step.Name, err)
+		}
+		req := step.Request
+		req.Messages = append(req.Messages[:len(req.Messages):len(req.Messages)], UserMessage(prompt.String()))
+
+		r := p.runStep(ctx, step, req)
+		result.Steps = append(result.Steps, r)
+		if r.Error != nil {
+			return result, fmt.Errorf("pipeline step %q failed: %w", step.Name, r.Error)
+		}
+
+		output := r.Content()
+		result.Outputs[step.Name] = output
+		data[step.Name] = output
+		data["previous"] = output
+	}
+	return result, nil
+}
+
+// runStep sends the request of step with its retry policy.
+func (p *Pipeline) runStep(ctx context.Context, step Step, req ChatCompletionRequest) Result {
+	var opts []CallOption
+	if step.Retry != nil {
+		opts = append(opts, WithRetries(*step.Retry))
+	}
+	ctx, cancel := withCallConfig(ctx, newCallConfig(opts))
+	defer cancel()
+	return p.cmd.executeAndLog(ctx, step.Target, req)
+}
@@ -0,0 +1,72 @@
+package general
+
+import "container/heap"
+
+// Priority orders requests waiting for a rate limit or a concurrency slot:
+// higher priorities are sent first, and requests of equal priority in
+// arrival order.
+type Priority int
+
+const (
+	// PriorityLow is for batch and evaluation traffic.
+	PriorityLow Priority = -1
+	// PriorityNormal is the default.
+	PriorityNormal Priority = 0
+	// PriorityHigh is for interactive requests that a user is waiting on.
+	PriorityHigh Priority = 1
+)
+
+// WithPriority sets the priority of the call's requests when they queue for
+// a token of WithRateLimit or a slot of the Command's ConcurrencyLimiter. It
+// has no effect while neither limit is reached.
+func WithPriority(priority Priority) CallOption {
+	return func(cfg *callConfig) { cfg.priority = priority }
+}
+
+// waiter is a request queued for a rate limit token or a concurrency slot.
+type waiter struct {
+	priority Priority
+	seq      uint64
+	index    int
+	ready    chan struct{}
+}
+
+// waitQueue is a heap of waiters, highest priority and then oldest first.
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waitQueue) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	w.index = -1
+	return w
+}
+
+// remove drops w from the queue if it is still waiting.
+func (q *waitQueue) remove(w *waiter) {
+	if w.index >= 0 {
+		heap.Remove(q, w.index)
+	}
+}
@@ -1,13 +1,38 @@
 package general
 
+import (
+	"net/http"
+	"strings"
+)
+
 // Pre-configured endpoints for popular providers
 const (
+	OpenAIEndpoint     = "https://api.openai.com/v1/chat/completions"
 	OpenRouterEndpoint = "https://openrouter.ai/api/v1/chat/completions"
 	GroqEndpoint       = "https://api.groq.com/openai/v1/chat/completions"
 	ChutesEndpoint     = "https://llm.chutes.ai/v1/chat/completions"
 	GeminiEndpoint     = "https://generativelanguage.googleapis.com/v1beta/openai/chat/completions"
 )
 
+const chatCompletionsPath = "/chat/completions"
+
+// Provider names reported by Provider.Name.
+const (
+	ProviderOpenAI     = "openai"
+	ProviderOpenRouter = "openrouter"
+	ProviderGroq       = "groq"
+	ProviderChutes     = "chutes"
+	ProviderGemini     = "gemini"
+)
+
+// knownProviders are the names Provider.Name reports.
+var knownProviders = []string{ProviderOpenAI, ProviderOpenRouter, ProviderGroq, ProviderChutes, ProviderGemini}
+
+// OpenAI returns a Provider for OpenAI API.
+func OpenAI(apiKey string) Provider {
+	return Provider{Endpoint: OpenAIEndpoint, APIKey: apiKey}
+}
+
 // OpenRouter returns a Provider for OpenRouter API.
 func OpenRouter(apiKey string) Provider {
 	return Provider{Endpoint: OpenRouterEndpoint, APIKey: apiKey}
@@ -23,7 +48,72 @@ func Chutes(apiKey string) Provider {
 	return Provider{Endpoint: ChutesEndpoint, APIKey: apiKey}
 }
 
+// WithAttribution returns a copy of p that identifies the calling app to
+// OpenRouter via the HTTP-Referer and X-Title headers, so usage is attributed
+// on the OpenRouter dashboard and rankings. Empty values are not sent.
+func (p Provider) WithAttribution(referer, title string) Provider {
+	if referer != "" {
+		p = p.WithHeader("HTTP-Referer", referer)
+	}
+	if title != "" {
+		p = p.WithHeader("X-Title", title)
+	}
+	return p
+}
+
 // Gemini returns a Provider for Google Gemini API (OpenAI-compatible mode).
 func Gemini(apiKey string) Provider {
 	return Provider{Endpoint: GeminiEndpoint, APIKey: apiKey}
 }
+
+// baseURL returns the API root of the provider, derived from its chat completions endpoint.
+func (p Provider) baseURL() string {
+	return strings.TrimSuffix(strings.TrimRight(p.Endpoint, "/"), chatCompletionsPath)
+}
+
+// Name identifies a well-known provider from its endpoint, or returns "" for
+// custom endpoints.
+func (p Provider) Name() string {
+	switch {
+	case strings.Contains(p.Endpoint, "api.openai.com"):
+		return ProviderOpenAI
+	case strings.Contains(p.Endpoint, "openrouter"):
+		return ProviderOpenRouter
+	case strings.Contains(p.Endpoint, "groq"):
+		return ProviderGroq
+	case strings.Contains(p.Endpoint, "chutes"):
+		return ProviderChutes
+	case strings.Contains(p.Endpoint, "generativelanguage.googleapis"):
+		return ProviderGemini
+	default:
+		return ""
+	}
+}
+
+// WithHeader returns a copy of p that sends an extra header with every request.
+// The Headers map is copied, so p itself is not modified.
+func (p Provider) WithHeader(key, value string) Provider {
+	headers := make(map[string]string, len(p.Headers)+1)
+	for k, v := range p.Headers {
+		headers[k] = v
+	}
+	headers[key] = value
+	p.Headers = headers
+	return p
+}
+
+// setHeaders sets the content type, authorization and provider headers on h.
+// Authorization is omitted when the provider has no API key.
+func (p Provider) setHeaders(h http.Header) {
+	h.Set("Content-Type", "application/json")
+	switch {
+	case p.APIKey == "":
+	case p.GeminiNative:
+		h.Set("x-goog-api-key", p.APIKey)
+	default:
+		h.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	for k, v := range p.Headers {
+		h.Set(k, v)
+	}
+}
@@ -0,0 +1,37 @@
+package general
+
+import (
+	"context"
+	"fmt"
+)
+
+// Quorum fires parallel requests to all configured targets, or to those of
+// WithGroups, and returns as soon as k of them succeed, cancelling the
+// requests still in flight. The returned results hold the k successes in
+// arrival order. If fewer than k targets can succeed, Quorum returns every
+// result it got and an error.
+func (c *Command) Quorum(ctx context.Context, req ChatCompletionRequest, k int, opts ...CallOption) ([]Result, error) {
+	cfg := newCallConfig(opts)
+	targets := c.callTargets(cfg)
+	if k < 1 || k > len(targets) {
+		return nil, fmt.Errorf("quorum %d out of range for %d targets", k, len(targets))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var successes, failures []Result
+	for result := range c.executeTargets(ctx, targets, req, cfg) {
+		if result.Error != nil {
+			failures = append(failures, result)
+			if len(targets)-len(failures) < k {
+				return append(successes, failures...), fmt.Errorf("quorum of %d unreachable: %d of %d targets failed", k, len(failures), len(targets))
+			}
+			continue
+		}
+		successes = append(successes, result)
+		if len(successes) == k {
+			return successes, nil
+		}
+	}
+	return successes, nil
+}
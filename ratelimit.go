@@ -0,0 +1,126 @@
+package general
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateLimit is the per-endpoint request rate set by WithRateLimit.
+// A zero rps means no limit.
+type rateLimit struct {
+	rps   float64
+	burst int
+}
+
+// tokenBucket is a token-bucket rate limiter. Requests that find no token
+// queue and are served by priority as tokens accrue.
+type tokenBucket struct {
+	mu      sync.Mutex
+	limit   rateLimit
+	tokens  float64
+	last    time.Time
+	queue   waitQueue
+	seq     uint64
+	pending *time.Timer
+}
+
+func newTokenBucket(limit rateLimit) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.burst), last: time.Now()}
+}
+
+// refill adds the tokens accrued since the last call. b.mu must be held.
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.limit.rps, float64(b.limit.burst))
+	b.last = now
+}
+
+// wait blocks until a request with the given priority may be sent or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context, priority Priority) error {
+	b.mu.Lock()
+	b.refill()
+	if b.queue.Len() == 0 && b.tokens >= 1 {
+		b.tokens--
+		b.mu.Unlock()
+		return nil
+	}
+	w := &waiter{priority: priority, seq: b.seq, ready: make(chan struct{})}
+	b.seq++
+	heap.Push(&b.queue, w)
+	b.schedule()
+	b.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Granted concurrently; give the token back.
+			b.tokens++
+		default:
+			b.queue.remove(w)
+		}
+		return fmt.Errorf("rate limit wait aborted: %w", ctx.Err())
+	}
+}
+
+// allow takes a token without waiting. If there is none, it returns false
+// and how long until one accrues.
+func (b *tokenBucket) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.queue.Len() == 0 && b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.limit.rps * float64(time.Second))
+}
+
+// dispatch hands accrued tokens to the queued requests in priority order.
+func (b *tokenBucket) dispatch() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = nil
+	b.refill()
+	for b.queue.Len() > 0 && b.tokens >= 1 {
+		b.tokens--
+		close(heap.Pop(&b.queue).(*waiter).ready)
+	}
+	b.schedule()
+}
+
+// schedule arranges a dispatch for when the next token accrues, if requests
+// are queued and none is pending. b.mu must be held.
+func (b *tokenBucket) schedule() {
+	if b.queue.Len() == 0 || b.pending != nil {
+		return
+	}
+	delay := time.Duration(max(1-b.tokens, 0) / b.limit.rps * float64(time.Second))
+	b.pending = time.AfterFunc(delay, b.dispatch)
+}
+
+// waitRateLimit blocks until a request to p is allowed by the Command's rate
+// limit, serving queued requests by the priority of their call.
+func (c *Command) waitRateLimit(ctx context.Context, p Provider) error {
+	if c.rateLimit.rps <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	if c.limiters == nil {
+		c.limiters = make(map[string]*tokenBucket)
+	}
+	bucket, ok := c.limiters[p.Endpoint]
+	if !ok {
+		bucket = newTokenBucket(c.rateLimit)
+		c.limiters[p.Endpoint] = bucket
+	}
+	c.mu.Unlock()
+	return bucket.wait(ctx, callOptions(ctx).priority)
+}
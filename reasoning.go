@@ -0,0 +1,69 @@
+package general
+
+import "strings"
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// SplitReasoning separates <think>...</think> blocks from the rest of text.
+// A reply cut off inside a block counts as reasoning up to the end, and a
+// closing tag without an opening one, as some reasoning models emit, ends
+// reasoning that started at the beginning of text.
+func SplitReasoning(text string) (reasoning, content string) {
+	var thoughts, rest []string
+	if end := strings.Index(text, thinkClose); end >= 0 && !strings.Contains(text[:end], thinkOpen) {
+		thoughts = append(thoughts, text[:end])
+		text = text[end+len(thinkClose):]
+	}
+	for {
+		start := strings.Index(text, thinkOpen)
+		if start < 0 {
+			rest = append(rest, text)
+			break
+		}
+		rest = append(rest, text[:start])
+		text = text[start+len(thinkOpen):]
+		end := strings.Index(text, thinkClose)
+		if end < 0 {
+			thoughts = append(thoughts, text)
+			break
+		}
+		thoughts = append(thoughts, text[:end])
+		text = text[end+len(thinkClose):]
+	}
+
+	for i := range thoughts {
+		thoughts[i] = strings.TrimSpace(thoughts[i])
+	}
+	return strings.Join(thoughts, "\n\n"), strings.TrimSpace(strings.Join(rest, ""))
+}
+
+// Reasoning returns the reasoning of the first choice: the provider's
+// reasoning field, if any, followed by any <think> blocks in the content.
+func (r Result) Reasoning() string {
+	if len(r.Response.Choices) == 0 {
+		return ""
+	}
+	message := r.Response.Choices[0].Message
+	thoughts, _ := SplitReasoning(message.Text())
+	switch {
+	case message.Reasoning == "":
+		return thoughts
+	case thoughts == "":
+		return message.Reasoning
+	default:
+		return message.Reasoning + "\n\n" + thoughts
+	}
+}
+
+// Content returns the text of the first choice without <think> blocks, or
+// "" if there is no choice.
+func (r Result) Content() string {
+	if len(r.Response.Choices) == 0 {
+		return ""
+	}
+	_, content := SplitReasoning(r.Response.Choices[0].Message.Text())
+	return content
+}
@@ -0,0 +1,116 @@
+package general
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// redactedSecret replaces secrets in logs and errors.
+const redactedSecret = "[REDACTED]"
+
+// minSecretLength is the length below which configured API keys are not
+// redacted verbatim, so that placeholder keys do not mangle messages.
+const minSecretLength = 8
+
+// secretPatterns match the API key formats of the supported providers and
+// bearer tokens. A first submatch, if any, is kept as a prefix.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`),
+	regexp.MustCompile(`\bgsk_[A-Za-z0-9]{16,}`),
+	regexp.MustCompile(`\bcpk_[A-Za-z0-9._-]{16,}`),
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{30,}`),
+	regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/=-]{8,}`),
+	regexp.MustCompile(`(?i)(\b(?:api[_-]?key|x-goog-api-key)["']?\s*[:=]\s*["']?)[^\s"'&,;}]{8,}`),
+}
+
+// RedactSecrets replaces anything that looks like an API key or bearer
+// token in s.
+func RedactSecrets(s string) string {
+	return redactPatterns(s, secretPatterns)
+}
+
+func redactPatterns(s string, patterns []*regexp.Regexp) string {
+	for _, p := range patterns {
+		if p.NumSubexp() > 0 {
+			s = p.ReplaceAllString(s, "${1}"+redactedSecret)
+		} else {
+			s = p.ReplaceAllLiteralString(s, redactedSecret)
+		}
+	}
+	return s
+}
+
+// WithSecretPatterns redacts matches of patterns from logs and errors in
+// addition to the built-in API key formats and the Command's own keys.
+// A first submatch, if any, is kept, as in `(token=)\S+`.
+func WithSecretPatterns(patterns ...*regexp.Regexp) Option {
+	return func(c *Command) { c.secrets = append(c.secrets, patterns...) }
+}
+
+// redact removes the Command's API keys, the built-in secret formats and
+// the configured patterns from s.
+func (c *Command) redact(s string) string {
+	for _, key := range c.apiKeys() {
+		s = strings.ReplaceAll(s, key, redactedSecret)
+	}
+	s = redactPatterns(s, secretPatterns)
+	return redactPatterns(s, c.secrets)
+}
+
+// apiKeys returns the keys of every provider the Command knows.
+func (c *Command) apiKeys() []string {
+	var keys []string
+	add := func(p Provider) {
+		for _, key := range append([]string{p.APIKey}, p.APIKeys...) {
+			if len(key) >= minSecretLength {
+				keys = append(keys, key)
+			}
+		}
+	}
+	for _, t := range c.targets {
+		add(t.Provider)
+	}
+	if c.moderation != nil {
+		add(*c.moderation)
+	}
+	return keys
+}
+
+// apiError builds the APIError of a non-200 response with secrets echoed
+// back by the provider removed.
+func (c *Command) apiError(statusCode int, body []byte) *APIError {
+	e := newAPIError(statusCode, body)
+	e.Body = c.redact(e.Body)
+	e.Message = c.redact(e.Message)
+	return e
+}
+
+// responseError is apiError for an HTTP response, keeping its Retry-After
+// delay.
+func (c *Command) responseError(resp *http.Response, body []byte) *APIError {
+	e := c.apiError(resp.StatusCode, body)
+	e.RetryAfter = retryAfter(resp.Header)
+	return e
+}
+
+// redactArgs returns slog arguments with secrets removed from strings and errors.
+func (c *Command) redactArgs(args []any) []any {
+	out := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			out[i] = c.redact(v)
+		case error:
+			if redacted := c.redact(v.Error()); redacted != v.Error() {
+				out[i] = errors.New(redacted)
+			} else {
+				out[i] = v
+			}
+		default:
+			out[i] = arg
+		}
+	}
+	return out
+}
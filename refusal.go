@@ -0,0 +1,86 @@
+package general
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errors of responses rejected by WithResponseChecks.
+var (
+	ErrRefusal         = errors.New("model refused the request")
+	ErrEmptyResponse   = errors.New("empty response")
+	ErrContentFiltered = errors.New("response blocked by content filter")
+)
+
+// refusalPrefixes are openings of replies that decline the request. They are
+// matched case-insensitively against the start of the content.
+var refusalPrefixes = []string{
+	"i can't help with",
+	"i cannot help with",
+	"i can't assist with",
+	"i cannot assist with",
+	"i can't provide",
+	"i cannot provide",
+	"i can't comply",
+	"i cannot comply",
+	"i'm sorry, but i can't",
+	"i'm sorry, but i cannot",
+	"i'm sorry, i can't",
+	"i'm sorry, i cannot",
+	"sorry, but i can't",
+	"sorry, i can't",
+	"i'm unable to help",
+	"i'm unable to assist",
+	"i am unable to help",
+	"i am unable to assist",
+	"i won't be able to help",
+	"as an ai language model, i cannot",
+	"as an ai language model, i can't",
+}
+
+// CheckResponse reports whether the first choice of resp is degenerate: it
+// returns ErrContentFiltered if the provider stopped it with a content
+// filter, ErrRefusal if the model declined the request, ErrEmptyResponse if
+// it has neither content nor tool calls, and nil otherwise.
+func CheckResponse(resp ChatCompletionResponse) error {
+	if len(resp.Choices) == 0 {
+		return ErrEmptyResponse
+	}
+	choice := resp.Choices[0]
+	if choice.FinishReason == ErrorCodeContentFilter {
+		return ErrContentFiltered
+	}
+	if choice.Message.Refusal != "" {
+		return ErrRefusal
+	}
+	if len(choice.Message.ToolCalls) > 0 {
+		return nil
+	}
+	_, content := SplitReasoning(choice.Message.Text())
+	if strings.TrimSpace(content) == "" {
+		return ErrEmptyResponse
+	}
+	if IsRefusal(content) {
+		return ErrRefusal
+	}
+	return nil
+}
+
+// IsRefusal reports whether text opens by declining the request.
+func IsRefusal(text string) bool {
+	text = strings.ToLower(strings.TrimSpace(text))
+	text = strings.ReplaceAll(text, "’", "'")
+	for _, prefix := range refusalPrefixes {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithResponseChecks makes non-streaming calls fail with the error of
+// CheckResponse when a response is degenerate, so ExecuteFallback moves on
+// to the next target. The failed result still carries the response.
+func WithResponseChecks() CallOption {
+	return func(cfg *callConfig) { cfg.checkResponse = true }
+}
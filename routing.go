@@ -0,0 +1,96 @@
+package general
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraints are the requirements a target must meet to serve a request.
+// Zero values impose no constraint.
+type Constraints struct {
+	Tools         bool
+	Vision        bool
+	MinContext    int
+	MaxPromptCost float64 // USD per million prompt tokens
+}
+
+// requirements returns c extended with the needs implied by req: tools when
+// it defines any, vision when it contains image parts, and a context window
+// large enough for its estimated prompt plus the completion limit.
+func (c Constraints) requirements(req ChatCompletionRequest, model string) Constraints {
+	if len(req.Tools) > 0 {
+		c.Tools = true
+	}
+
+	t := TokenizerFor(model)
+	tokens := max(req.MaxTokens, req.MaxCompletionTokens)
+	for _, m := range req.Messages {
+		tokens += t.Count(m.Text())
+		for _, p := range m.Parts {
+			if p.Type == "image_url" {
+				c.Vision = true
+			}
+		}
+	}
+	c.MinContext = max(c.MinContext, tokens)
+	return c
+}
+
+// allows reports why details fail the constraints, or "" if they are met.
+func (c Constraints) allows(details ModelDetails) string {
+	switch {
+	case c.Tools && !details.Tools:
+		return "no tool support"
+	case c.Vision && !details.Vision:
+		return "no vision support"
+	case c.MinContext > 0 && details.ContextWindow < c.MinContext:
+		return fmt.Sprintf("context window %d < %d", details.ContextWindow, c.MinContext)
+	case c.MaxPromptCost > 0 && details.Pricing.Prompt > c.MaxPromptCost:
+		return fmt.Sprintf("prompt cost %.2f > %.2f", details.Pricing.Prompt, c.MaxPromptCost)
+	default:
+		return ""
+	}
+}
+
+// Route picks the cheapest configured target whose DefaultCatalog entry meets
+// constraints and the needs of req. Ties go to the earlier target. Targets
+// missing from the catalog are skipped.
+func (c *Command) Route(req ChatCompletionRequest, constraints Constraints) (Target, error) {
+	if len(c.targets) == 0 {
+		return Target{}, fmt.Errorf("no targets configured")
+	}
+
+	var (
+		best     Target
+		bestCost float64
+		found    bool
+		rejected []string
+	)
+	for _, target := range c.targets {
+		resolved, err := DefaultAliases.ResolveTarget(target)
+		if err != nil {
+			rejected = append(rejected, fmt.Sprintf("%s: %v", target.Model, err))
+			continue
+		}
+
+		details, ok := ModelInfo(resolved.Provider.Name(), resolved.Model)
+		if !ok {
+			rejected = append(rejected, resolved.Model+": not in catalog")
+			continue
+		}
+		if reason := constraints.requirements(req, resolved.Model).allows(details); reason != "" {
+			rejected = append(rejected, resolved.Model+": "+reason)
+			continue
+		}
+
+		cost := details.Pricing.Prompt + details.Pricing.Completion
+		if !found || cost < bestCost {
+			best, bestCost, found = resolved, cost, true
+		}
+	}
+
+	if !found {
+		return Target{}, fmt.Errorf("no target satisfies constraints (%s)", strings.Join(rejected, "; "))
+	}
+	return best, nil
+}
@@ -0,0 +1,259 @@
+package general
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSchemaCorrections is the number of corrective requests WithResponseSchema
+// sends before giving up.
+const maxSchemaCorrections = 2
+
+// Schema is a JSON Schema document. Validate supports the commonly used
+// keywords: type, enum, const, properties, required, additionalProperties,
+// items, minItems, maxItems, minLength, maxLength, pattern, minimum and
+// maximum. Other keywords are ignored.
+type Schema map[string]any
+
+// SchemaError lists the ways a document violates a Schema.
+type SchemaError struct {
+	Violations []string
+}
+
+func (e *SchemaError) Error() string {
+	return "response does not match schema: " + strings.Join(e.Violations, "; ")
+}
+
+// Validate checks that data is a JSON document matching s, returning a
+// *SchemaError listing all violations.
+func (s Schema) Validate(data []byte) error {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return &SchemaError{Violations: []string{"invalid JSON: " + err.Error()}}
+	}
+	normalized, err := normalizeSchema(s)
+	if err != nil {
+		return err
+	}
+
+	var violations []string
+	validateValue(normalized, doc, "$", &violations)
+	if len(violations) > 0 {
+		return &SchemaError{Violations: violations}
+	}
+	return nil
+}
+
+// normalizeSchema round-trips s through JSON so nested values have the
+// types produced by encoding/json, whatever Go values the caller used.
+func normalizeSchema(s Schema) (map[string]any, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	var normalized map[string]any
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return normalized, nil
+}
+
+func validateValue(schema map[string]any, value any, path string, violations *[]string) {
+	fail := func(format string, args ...any) {
+		*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return hasType(value, t) }) {
+		fail("expected %s, got %s", strings.Join(types, " or "), jsonType(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(e any) bool { return jsonEqual(e, value) }) {
+		fail("value not in enum")
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, value) {
+		fail("value does not equal const")
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if name, ok := name.(string); ok {
+					if _, present := v[name]; !present {
+						fail("missing required property %q", name)
+					}
+				}
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if sub, ok := properties[name].(map[string]any); ok {
+				validateValue(sub, v[name], path+"."+name, violations)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					fail("unexpected property %q", name)
+				}
+			case map[string]any:
+				validateValue(additional, v[name], path+"."+name, violations)
+			}
+		}
+	case []any:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			fail("expected at least %v items, got %d", n, len(v))
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			fail("expected at most %v items, got %d", n, len(v))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			fail("expected at least %v characters", n)
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			fail("expected at most %v characters", n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				fail("does not match pattern %q", pattern)
+			}
+		}
+	case float64:
+		if n, ok := schemaNumber(schema, "minimum"); ok && v < n {
+			fail("expected minimum %v, got %v", n, v)
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && v > n {
+			fail("expected maximum %v, got %v", n, v)
+		}
+	}
+}
+
+func schemaTypes(t any) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func schemaNumber(schema map[string]any, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+func hasType(value any, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonType(value) == t
+	}
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func jsonEqual(a, b any) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+// WithResponseSchema validates the first choice of every response against
+// schema, after extracting the JSON from the reply with ExtractJSON. Invalid replies are
+// answered with a corrective message listing the violations, up to
+// maxSchemaCorrections times; a reply that is still invalid fails with a
+// *SchemaError.
+func WithResponseSchema(schema Schema) CallOption {
+	return func(cfg *callConfig) { cfg.schema = schema }
+}
+
+// executeWithSchema sends req to target and asks for corrections until the
+// reply matches schema.
+func (c *Command) executeWithSchema(ctx context.Context, target Target, req ChatCompletionRequest, schema Schema) (ChatCompletionResponse, error) {
+	messages := slices.Clone(req.Messages)
+	for correction := 0; ; correction++ {
+		req.Messages = messages
+		resp, err := c.executeTarget(ctx, target, req)
+		if err != nil {
+			return resp, err
+		}
+
+		reply := resp.Choices[0].Message.Text()
+		data, err := ExtractJSON(reply)
+		if err == nil {
+			err = schema.Validate([]byte(data))
+		}
+		if err == nil || correction == maxSchemaCorrections {
+			return resp, err
+		}
+
+		c.log(slog.LevelDebug, "response does not match schema",
+			"endpoint", target.Provider.Endpoint,
+			"model", target.Model,
+			"error", err.Error(),
+		)
+		messages = append(messages, AssistantMessage(reply), UserMessage(correctionPrompt(err)))
+	}
+}
+
+// correctionPrompt asks the model to fix the violations in err.
+func correctionPrompt(err error) string {
+	var b strings.Builder
+	b.WriteString("Your reply does not match the required JSON schema:\n")
+	if schemaErr, ok := err.(*SchemaError); ok {
+		for _, v := range schemaErr.Violations {
+			b.WriteString("- " + v + "\n")
+		}
+	} else {
+		b.WriteString("- " + err.Error() + "\n")
+	}
+	b.WriteString("Reply again with only the corrected JSON.")
+	return b.String()
+}
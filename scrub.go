@@ -0,0 +1,110 @@
+package general
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// Scrubber rewrites prompt text before it is sent, for example to mask
+// personal data. Scrubbers run on message contents, text parts, tool call
+// arguments and text-completion prompts.
+type Scrubber func(text string) string
+
+// WithScrubbers runs scrubbers in order over every request before it leaves
+// the machine, including the moderation check. The caller's request is not
+// modified, and the cache and audit log see the scrubbed request.
+func WithScrubbers(scrubbers ...Scrubber) Option {
+	return func(c *Command) { c.scrubbers = append(c.scrubbers, scrubbers...) }
+}
+
+// ScrubMiddleware returns middleware applying scrubbers in order to the
+// request of every call. WithScrubbers runs it among the built-in
+// middleware; Use it instead to choose where in the chain it runs.
+func ScrubMiddleware(scrubbers ...Scrubber) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call Call) (ChatCompletionResponse, error) {
+			call.Request = scrubRequest(scrubbers, call.Request)
+			return next(ctx, call)
+		}
+	}
+}
+
+// ScrubPattern returns a scrubber replacing matches of pattern with
+// replacement, which may reference submatches as in Regexp.ReplaceAllString.
+func ScrubPattern(pattern *regexp.Regexp, replacement string) Scrubber {
+	return func(text string) string { return pattern.ReplaceAllString(text, replacement) }
+}
+
+// ScrubHostnames returns a scrubber masking host names under any of the
+// domain suffixes, such as "corp.example.com".
+func ScrubHostnames(suffixes ...string) Scrubber {
+	quoted := make([]string, len(suffixes))
+	for i, s := range suffixes {
+		quoted[i] = regexp.QuoteMeta(strings.TrimPrefix(s, "."))
+	}
+	pattern := regexp.MustCompile(`(?i)\b(?:[a-z0-9-]+\.)+(?:` + strings.Join(quoted, "|") + `)\b`)
+	return ScrubPattern(pattern, "[HOST]")
+}
+
+var (
+	emailPattern    = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b`)
+	ipv4Pattern     = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`)
+	internalDomains = []string{"internal", "local", "localdomain", "corp", "lan", "intranet", "home.arpa"}
+)
+
+// ScrubBasic masks email addresses, API keys and bearer tokens, IPv4
+// addresses and host names under private-use domains such as .internal,
+// .local and .corp. It is a baseline, not a complete PII filter.
+var ScrubBasic Scrubber = func(text string) string {
+	text = RedactSecrets(text)
+	text = emailPattern.ReplaceAllString(text, "[EMAIL]")
+	text = ipv4Pattern.ReplaceAllString(text, "[IP]")
+	return scrubInternalHosts(text)
+}
+
+var scrubInternalHosts = ScrubHostnames(internalDomains...)
+
+// scrubRequest returns req with scrubbers applied, sharing no modified
+// slices with req.
+func scrubRequest(scrubbers []Scrubber, req ChatCompletionRequest) ChatCompletionRequest {
+	if len(scrubbers) == 0 {
+		return req
+	}
+	req.Prompt = scrubText(scrubbers, req.Prompt)
+	req.Suffix = scrubText(scrubbers, req.Suffix)
+
+	messages := make([]ChatCompletionMessage, len(req.Messages))
+	for i, m := range req.Messages {
+		m.Content = scrubText(scrubbers, m.Content)
+		if len(m.Parts) > 0 {
+			parts := make([]ContentPart, len(m.Parts))
+			for j, p := range m.Parts {
+				p.Text = scrubText(scrubbers, p.Text)
+				parts[j] = p
+			}
+			m.Parts = parts
+		}
+		if len(m.ToolCalls) > 0 {
+			calls := make([]ToolCall, len(m.ToolCalls))
+			for j, call := range m.ToolCalls {
+				call.Function.Arguments = scrubText(scrubbers, call.Function.Arguments)
+				calls[j] = call
+			}
+			m.ToolCalls = calls
+		}
+		messages[i] = m
+	}
+	req.Messages = messages
+	return req
+}
+
+func scrubText(scrubbers []Scrubber, text string) string {
+	if text == "" {
+		return text
+	}
+	for _, scrub := range scrubbers {
+		text = scrub(text)
+	}
+	return text
+}
@@ -0,0 +1,100 @@
+package general
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Scorer assigns a score to each choice, in order; higher is better.
+type Scorer func(ctx context.Context, choices []ChatCompletionChoice) ([]float64, error)
+
+// ScoreEach adapts a per-choice scoring function into a Scorer.
+func ScoreEach(score func(ChatCompletionChoice) float64) Scorer {
+	return func(_ context.Context, choices []ChatCompletionChoice) ([]float64, error) {
+		scores := make([]float64, len(choices))
+		for i, choice := range choices {
+			scores[i] = score(choice)
+		}
+		return scores, nil
+	}
+}
+
+// LengthScorer prefers longer answers and ranks choices that were cut off
+// by the token limit below every complete one.
+var LengthScorer = ScoreEach(func(choice ChatCompletionChoice) float64 {
+	score := float64(len(choice.Message.Content))
+	if choice.FinishReason == "length" {
+		score -= 1e9
+	}
+	return score
+})
+
+// ConfidenceScorer prefers the choice with the highest mean token probability.
+// It requires the request to set Logprobs.
+var ConfidenceScorer = ScoreEach(func(choice ChatCompletionChoice) float64 {
+	return choice.Logprobs.Confidence()
+})
+
+// SelectBest returns the choice of resp with the highest score.
+// Ties are resolved in favor of the earlier choice.
+func SelectBest(ctx context.Context, resp ChatCompletionResponse, scorer Scorer) (ChatCompletionChoice, error) {
+	if len(resp.Choices) == 0 {
+		return ChatCompletionChoice{}, fmt.Errorf("no choices in response")
+	}
+	if len(resp.Choices) == 1 {
+		return resp.Choices[0], nil
+	}
+
+	scores, err := scorer(ctx, resp.Choices)
+	if err != nil {
+		return ChatCompletionChoice{}, fmt.Errorf("failed to score choices: %w", err)
+	}
+	if len(scores) != len(resp.Choices) {
+		return ChatCompletionChoice{}, fmt.Errorf("scorer returned %d scores for %d choices", len(scores), len(resp.Choices))
+	}
+
+	best := 0
+	for i, score := range scores {
+		if score > scores[best] {
+			best = i
+		}
+	}
+	return resp.Choices[best], nil
+}
+
+// JudgeScorer returns a Scorer that asks the judge target to rate every
+// choice from 1 to 10 against the given criteria.
+func (c *Command) JudgeScorer(judge Target, criteria string) Scorer {
+	return func(ctx context.Context, choices []ChatCompletionChoice) ([]float64, error) {
+		var b strings.Builder
+		fmt.Fprintf(&b, "Rate each candidate answer from 1 to 10 using these criteria:\n%s\n\n", criteria)
+		for i, choice := range choices {
+			fmt.Fprintf(&b, "Candidate %d:\n%s\n\n", i+1, choice.Message.Content)
+		}
+		fmt.Fprintf(&b, "Reply with only a JSON array of %d numbers, one score per candidate in order.", len(choices))
+
+		resp, err := c.executeTarget(ctx, judge, ChatCompletionRequest{
+			Messages: []ChatCompletionMessage{UserMessage(b.String())},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("judge request failed: %w", err)
+		}
+		return parseScores(resp.Choices[0].Message.Content)
+	}
+}
+
+// parseScores extracts the JSON array of scores from a judge reply.
+func parseScores(content string) ([]float64, error) {
+	data, err := ExtractJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("no score array in judge reply: %q", content)
+	}
+
+	var scores []float64
+	if err := json.Unmarshal([]byte(data), &scores); err != nil {
+		return nil, fmt.Errorf("failed to parse judge scores: %w", err)
+	}
+	return scores, nil
+}
@@ -0,0 +1,34 @@
+package general
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// selfConsistencyTemperature is the sampling temperature SelfConsistent uses
+// when the request sets none.
+const selfConsistencyTemperature = 0.7
+
+// SelfConsistent samples n completions of req from target in parallel and
+// votes on their answers with eq, or ExactMatch if eq is nil. The samples
+// bypass the cache and use temperature 0.7 unless req sets one. The
+// consensus holds the modal answer, and its Agreement is the confidence.
+func (c *Command) SelfConsistent(ctx context.Context, target Target, req ChatCompletionRequest, n int, eq Equivalence, opts ...CallOption) (Consensus, error) {
+	if n < 1 {
+		return Consensus{}, fmt.Errorf("self-consistency needs at least one sample, got %d", n)
+	}
+	if eq == nil {
+		eq = ExactMatch()
+	}
+	if req.Temperature == 0 {
+		req.Temperature = selfConsistencyTemperature
+	}
+
+	cfg := newCallConfig(append(opts, WithoutCache()))
+	var results []Result
+	for r := range c.executeTargets(ctx, slices.Repeat([]Target{target}, n), req, cfg) {
+		results = append(results, r)
+	}
+	return Vote(ctx, results, eq)
+}
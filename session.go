@@ -0,0 +1,169 @@
+package general
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const sessionExt = ".json"
+
+// Session is a persisted chat: its conversation, targets and request parameters.
+type Session struct {
+	ID       string                  `json:"id"`
+	Created  time.Time               `json:"created"`
+	Updated  time.Time               `json:"updated"`
+	Targets  []SessionTarget         `json:"targets"`
+	Params   ChatCompletionRequest   `json:"params"`
+	Messages []ChatCompletionMessage `json:"messages"`
+}
+
+// SessionTarget records a target without its credentials. Provider is the
+// name used to look up an API key when the session is resumed.
+type SessionTarget struct {
+	Provider string `json:"provider"`
+	Endpoint string `json:"endpoint"`
+	Model    string `json:"model"`
+}
+
+// NewSession creates a session with a fresh ID for the given conversation.
+func NewSession(conv *Conversation) *Session {
+	now := time.Now()
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return &Session{
+		ID:       now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix),
+		Created:  now,
+		Updated:  now,
+		Messages: conv.Messages,
+	}
+}
+
+// Conversation returns the session messages as a Conversation.
+func (s *Session) Conversation() *Conversation {
+	return &Conversation{Messages: s.Messages}
+}
+
+// Title returns the start of the first user message, for listings.
+func (s *Session) Title() string {
+	for _, m := range s.Messages {
+		if m.Role == RoleUser {
+			title := []rune(strings.Join(strings.Fields(m.Text()), " "))
+			if len(title) > 60 {
+				return string(title[:57]) + "..."
+			}
+			return string(title)
+		}
+	}
+	return ""
+}
+
+// SessionStore keeps sessions as JSON files in a directory.
+type SessionStore struct {
+	Dir string
+}
+
+// NewSessionStore returns a store in dir, creating the directory if needed.
+func NewSessionStore(dir string) (*SessionStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+	return &SessionStore{Dir: dir}, nil
+}
+
+func (s *SessionStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid session ID %q", id)
+	}
+	return filepath.Join(s.Dir, id+sessionExt), nil
+}
+
+// Save writes the session, updating its Updated time. The file is replaced
+// atomically so a crash never leaves a truncated session.
+func (s *SessionStore) Save(session *Session) error {
+	path, err := s.path(session.ID)
+	if err != nil {
+		return err
+	}
+	session.Updated = time.Now()
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// Load reads the session with the given ID.
+func (s *SessionStore) Load(id string) (*Session, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("session %q not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session %q: %w", id, err)
+	}
+	return &session, nil
+}
+
+// List returns all sessions, most recently updated first.
+func (s *SessionStore) List() ([]*Session, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	var sessions []*Session
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), sessionExt) {
+			continue
+		}
+		session, err := s.Load(strings.TrimSuffix(e.Name(), sessionExt))
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Updated.After(sessions[j].Updated) })
+	return sessions, nil
+}
+
+// Delete removes the session with the given ID.
+func (s *SessionStore) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("session %q not found", id)
+		}
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
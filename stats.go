@@ -0,0 +1,162 @@
+package general
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// statsWindow is the number of recent latencies kept per target for percentiles.
+const statsWindow = 1000
+
+// Stats summarizes the requests sent to one provider/model over the lifetime
+// of a Command.
+type Stats struct {
+	// Provider is the detected provider name, or the endpoint if unknown.
+	Provider string
+	Endpoint string
+	Model    string
+
+	Requests  int
+	Successes int
+	// Retries counts attempts beyond the first, across all requests.
+	Retries int
+
+	// Latency percentiles of successful requests, including retries, over
+	// the most recent statsWindow requests.
+	P50, P95, P99 time.Duration
+
+	CompletionTokens int
+	// TokensPerSecond is completion tokens divided by the total duration
+	// of successful requests.
+	TokensPerSecond float64
+}
+
+// SuccessRate returns the fraction of requests that succeeded.
+func (s Stats) SuccessRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Successes) / float64(s.Requests)
+}
+
+// Stats returns per-target statistics, ordered by provider and model.
+func (c *Command) Stats() []Stats {
+	return c.stats.snapshot()
+}
+
+type statsKey struct {
+	endpoint, model string
+}
+
+type targetStats struct {
+	Stats
+	latencies []time.Duration
+	next      int
+	busy      time.Duration
+}
+
+// summary returns s with percentiles and throughput computed.
+func (s *targetStats) summary() Stats {
+	out := s.Stats
+	sorted := slices.Clone(s.latencies)
+	slices.Sort(sorted)
+	out.P50 = percentile(sorted, 50)
+	out.P95 = percentile(sorted, 95)
+	out.P99 = percentile(sorted, 99)
+	if s.busy > 0 {
+		out.TokensPerSecond = float64(s.CompletionTokens) / s.busy.Seconds()
+	}
+	return out
+}
+
+// statsCollector accumulates Stats. The zero value is ready to use.
+type statsCollector struct {
+	mu      sync.Mutex
+	targets map[statsKey]*targetStats
+}
+
+// get returns the entry for target, creating it if needed. c.mu must be held.
+func (c *statsCollector) get(target Target) *targetStats {
+	if c.targets == nil {
+		c.targets = make(map[statsKey]*targetStats)
+	}
+	key := statsKey{target.Provider.Endpoint, target.Model}
+	s, ok := c.targets[key]
+	if !ok {
+		name := target.Provider.Name()
+		if name == "" {
+			name = target.Provider.Endpoint
+		}
+		s = &targetStats{Stats: Stats{Provider: name, Endpoint: target.Provider.Endpoint, Model: target.Model}}
+		c.targets[key] = s
+	}
+	return s
+}
+
+// retry counts one retry of a request to target.
+func (c *statsCollector) retry(target Target) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(target).Retries++
+}
+
+// record adds the outcome of one request to target.
+func (c *statsCollector) record(target Target, usage *Usage, err error, duration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.get(target)
+	s.Requests++
+	if err != nil {
+		return
+	}
+	s.Successes++
+	s.busy += duration
+	if usage != nil {
+		s.CompletionTokens += usage.CompletionTokens
+	}
+	if len(s.latencies) < statsWindow {
+		s.latencies = append(s.latencies, duration)
+	} else {
+		s.latencies[s.next] = duration
+		s.next = (s.next + 1) % statsWindow
+	}
+}
+
+// lookup returns the statistics of target, if any request was recorded.
+func (c *statsCollector) lookup(target Target) (Stats, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.targets[statsKey{target.Provider.Endpoint, target.Model}]
+	if !ok {
+		return Stats{}, false
+	}
+	return s.summary(), true
+}
+
+func (c *statsCollector) snapshot() []Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]Stats, 0, len(c.targets))
+	for _, s := range c.targets {
+		stats = append(stats, s.summary())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Provider != stats[j].Provider {
+			return stats[i].Provider < stats[j].Provider
+		}
+		return stats[i].Model < stats[j].Model
+	})
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted by nearest rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := max((p*len(sorted)+99)/100, 1)
+	return sorted[rank-1]
+}
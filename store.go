@@ -0,0 +1,349 @@
+package general
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resultStoreSchema creates the table of a ResultStore, in SQLite syntax.
+const resultStoreSchema = `
+CREATE TABLE IF NOT EXISTS requests (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	time              INTEGER NOT NULL,
+	provider          TEXT NOT NULL,
+	endpoint          TEXT NOT NULL,
+	model             TEXT NOT NULL,
+	stream            INTEGER NOT NULL,
+	cached            INTEGER NOT NULL,
+	request           TEXT NOT NULL,
+	body              TEXT NOT NULL,
+	response          TEXT,
+	error             TEXT NOT NULL,
+	prompt_tokens     INTEGER NOT NULL,
+	completion_tokens INTEGER NOT NULL,
+	cost              REAL NOT NULL,
+	duration_ms       INTEGER NOT NULL,
+	client            TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS requests_time ON requests (time);
+`
+
+// resultStoreIndexes creates the indexes on columns added after the first
+// version of the table, once migrateResultStore has added them.
+const resultStoreIndexes = `
+CREATE INDEX IF NOT EXISTS requests_client ON requests (client, time);
+`
+
+const recordColumns = `id, time, provider, endpoint, model, stream, cached, request, body,
+	response, error, prompt_tokens, completion_tokens, cost, duration_ms, client`
+
+// ErrRecordNotFound is returned by ResultStore.Get for an unknown ID.
+var ErrRecordNotFound = errors.New("record not found")
+
+// Record is one request stored in a ResultStore.
+type Record struct {
+	ID       int64
+	Time     time.Time
+	Provider string
+	Endpoint string
+	Model    string
+	Stream   bool
+	Cached   bool
+	// Request is the request as the library saw it, and Body the payload sent
+	// to the provider, without the stream fields.
+	Request json.RawMessage
+	Body    json.RawMessage
+	// Response is nil when the request failed.
+	Response *ChatCompletionResponse
+	Error    string
+	// Cost is the reported or, failing that, the catalog-estimated USD cost.
+	Cost     float64
+	Duration time.Duration
+	// Client is the name of the Gateway API key the request was made
+	// with, or "" outside a gateway.
+	Client string
+}
+
+// Usage returns the usage of the response, or a zero Usage.
+func (r Record) Usage() Usage {
+	if r.Response == nil || r.Response.Usage == nil {
+		return Usage{}
+	}
+	return *r.Response.Usage
+}
+
+// ChatRequest decodes the stored request so it can be sent again. A chat
+// payload is decoded as sent, provider-specific fields included in Extra;
+// requests sent to the native Gemini or text-completion APIs are decoded
+// from Request instead. The model is left empty for the caller to choose.
+func (r Record) ChatRequest() (ChatCompletionRequest, error) {
+	source := r.Request
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(r.Body, &fields) == nil && fields["messages"] != nil {
+		source = r.Body
+	}
+	var req ChatCompletionRequest
+	if err := json.Unmarshal(source, &req); err != nil {
+		return ChatCompletionRequest{}, fmt.Errorf("failed to decode record %d: %w", r.ID, err)
+	}
+	req.Model = ""
+	return req, nil
+}
+
+// Replay sends the request of record to the Command's targets, to
+// reproduce it on other models or providers. The payload is the one
+// originally sent, apart from the model. Replays bypass the cache.
+func (c *Command) Replay(ctx context.Context, record Record, opts ...CallOption) (<-chan Result, error) {
+	req, err := record.ChatRequest()
+	if err != nil {
+		return nil, err
+	}
+	return c.Broadcast(ctx, req, append(opts, WithoutCache())...), nil
+}
+
+// RecordFilter selects the records returned by ResultStore.List. Zero
+// fields select everything.
+type RecordFilter struct {
+	Provider string
+	Model    string
+	Client   string
+	Since    time.Time
+	// Errors selects only failed requests.
+	Errors bool
+	// Limit caps the number of records; 0 means no limit.
+	Limit int
+}
+
+// ResultStore records every request of the Commands using it, with its
+// response, usage, cost and latency, in a SQL database. It is written for
+// SQLite; open the database with any SQLite driver for database/sql. It is
+// safe for concurrent use; writes are serialized, as SQLite allows only one
+// writer at a time.
+type ResultStore struct {
+	mu sync.Mutex
+	db *sql.DB
+}
+
+// NewResultStore returns a store in db, creating its table if needed.
+func NewResultStore(ctx context.Context, db *sql.DB) (*ResultStore, error) {
+	if _, err := db.ExecContext(ctx, resultStoreSchema); err != nil {
+		return nil, fmt.Errorf("failed to create result store: %w", err)
+	}
+	if err := migrateResultStore(ctx, db); err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, resultStoreIndexes); err != nil {
+		return nil, fmt.Errorf("failed to create result store: %w", err)
+	}
+	return &ResultStore{db: db}, nil
+}
+
+// migrateResultStore adds the columns missing from tables created by
+// earlier versions.
+func migrateResultStore(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, "SELECT client FROM requests LIMIT 0")
+	if err == nil {
+		return rows.Close()
+	}
+	if _, err := db.ExecContext(ctx, "ALTER TABLE requests ADD COLUMN client TEXT NOT NULL DEFAULT ''"); err != nil {
+		return fmt.Errorf("failed to migrate result store: %w", err)
+	}
+	return nil
+}
+
+// WithResultStore records every request of the Command in store. Requests
+// are recorded after scrubbing, and cache hits are marked as such.
+func WithResultStore(store *ResultStore) Option {
+	return func(c *Command) { c.store = store }
+}
+
+// Close waits for a write in progress to finish and closes the database.
+func (s *ResultStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Close()
+}
+
+// Add inserts r and returns its ID.
+func (s *ResultStore) Add(ctx context.Context, r Record) (int64, error) {
+	var response []byte
+	if r.Response != nil {
+		var err error
+		if response, err = json.Marshal(r.Response); err != nil {
+			return 0, fmt.Errorf("failed to encode response: %w", err)
+		}
+	}
+	usage := r.Usage()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO requests (time, provider, endpoint, model, stream, cached,
+		request, body, response, error, prompt_tokens, completion_tokens, cost, duration_ms, client)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Time.UnixNano(), r.Provider, r.Endpoint, r.Model, r.Stream, r.Cached,
+		string(r.Request), string(r.Body), nullString(response), r.Error,
+		usage.PromptTokens, usage.CompletionTokens, r.Cost, r.Duration.Milliseconds(), r.Client)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store record: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// Get returns the record with the given ID.
+func (s *ResultStore) Get(ctx context.Context, id int64) (Record, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+recordColumns+" FROM requests WHERE id = ?", id)
+	r, err := scanRecord(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, fmt.Errorf("%w: %d", ErrRecordNotFound, id)
+	}
+	return r, err
+}
+
+// where returns the SQL condition selecting the records of filter, with
+// its arguments, or "" if it selects everything.
+func (filter RecordFilter) where() (string, []any) {
+	var where []string
+	var args []any
+	if filter.Provider != "" {
+		where, args = append(where, "provider = ?"), append(args, filter.Provider)
+	}
+	if filter.Model != "" {
+		where, args = append(where, "model = ?"), append(args, filter.Model)
+	}
+	if filter.Client != "" {
+		where, args = append(where, "client = ?"), append(args, filter.Client)
+	}
+	if !filter.Since.IsZero() {
+		where, args = append(where, "time >= ?"), append(args, filter.Since.UnixNano())
+	}
+	if filter.Errors {
+		where = append(where, "error != ''")
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+// List returns the records matching filter, newest first.
+func (s *ResultStore) List(ctx context.Context, filter RecordFilter) ([]Record, error) {
+	where, args := filter.where()
+	query := "SELECT " + recordColumns + " FROM requests" + where + " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query records: %w", err)
+	}
+	defer rows.Close()
+	var records []Record
+	for rows.Next() {
+		r, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query records: %w", err)
+	}
+	return records, nil
+}
+
+// Usage totals the requests matching filter that reached a provider, cache
+// hits excluded. The limit of filter is ignored.
+func (s *ResultStore) Usage(ctx context.Context, filter RecordFilter) (UsageSummary, error) {
+	where, args := filter.where()
+	if where == "" {
+		where = " WHERE cached = 0"
+	} else {
+		where += " AND cached = 0"
+	}
+	var summary UsageSummary
+	var totalMS, maxMS int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(NULLIF(error, '')),
+		COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(cost), 0),
+		COALESCE(SUM(duration_ms), 0), COALESCE(MAX(duration_ms), 0)
+		FROM requests`+where, args...).Scan(&summary.Requests, &summary.Errors,
+		&summary.PromptTokens, &summary.CompletionTokens, &summary.Cost, &totalMS, &maxMS)
+	if err != nil {
+		return UsageSummary{}, fmt.Errorf("failed to total usage: %w", err)
+	}
+	summary.TotalLatency = time.Duration(totalMS) * time.Millisecond
+	summary.MaxLatency = time.Duration(maxMS) * time.Millisecond
+	return summary, nil
+}
+
+// scanRecord reads a row of recordColumns.
+func scanRecord(row interface{ Scan(...any) error }) (Record, error) {
+	var (
+		r                        Record
+		nanos, durationMS        int64
+		request, body            string
+		response                 sql.NullString
+		promptTokens, completion int
+	)
+	err := row.Scan(&r.ID, &nanos, &r.Provider, &r.Endpoint, &r.Model, &r.Stream, &r.Cached,
+		&request, &body, &response, &r.Error, &promptTokens, &completion, &r.Cost, &durationMS, &r.Client)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Record{}, err
+		}
+		return Record{}, fmt.Errorf("failed to read record: %w", err)
+	}
+	r.Time = time.Unix(0, nanos)
+	r.Duration = time.Duration(durationMS) * time.Millisecond
+	r.Request = json.RawMessage(request)
+	r.Body = json.RawMessage(body)
+	if response.Valid {
+		if err := json.Unmarshal([]byte(response.String), &r.Response); err != nil {
+			return Record{}, fmt.Errorf("failed to decode response of record %d: %w", r.ID, err)
+		}
+	}
+	return r, nil
+}
+
+// nullString returns data as a string, or NULL if it is empty.
+func nullString(data []byte) sql.NullString {
+	return sql.NullString{String: string(data), Valid: len(data) > 0}
+}
+
+// storeMiddleware records every call, cache hits included, in the result store.
+func (c *Command) storeMiddleware(next Handler) Handler {
+	return func(ctx context.Context, call Call) (ChatCompletionResponse, error) {
+		start := time.Now()
+		resp, err := next(ctx, call)
+
+		record := Record{
+			Time:     start,
+			Provider: call.Target.Provider.Name(),
+			Endpoint: call.Target.Provider.Endpoint,
+			Model:    call.Target.Model,
+			Stream:   call.Stream,
+			Cached:   resp.Cached,
+			Duration: time.Since(start),
+			Client:   clientName(ctx),
+		}
+		record.Request, _ = json.Marshal(call.Request)
+		record.Body, _ = marshalRequest(call.Target, call.Request)
+		if err != nil {
+			record.Error = c.redact(err.Error())
+		} else {
+			record.Response = &resp
+			record.Cost, _ = estimateCost(call.Target, resp.Usage)
+		}
+		// Record even when the caller gave up on the request.
+		if _, storeErr := c.store.Add(context.WithoutCancel(ctx), record); storeErr != nil {
+			c.log(slog.LevelWarn, "failed to record request", "error", storeErr)
+		}
+		return resp, err
+	}
+}
@@ -0,0 +1,623 @@
+package general
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStreamInterrupted is returned, wrapped, when a stream breaks off after
+// content was received. The response returned with it holds the partial
+// content accumulated so far.
+var ErrStreamInterrupted = errors.New("stream interrupted")
+
+// ErrStreamIdle is the cause of streams cut off by WithStreamIdleTimeout.
+var ErrStreamIdle = errors.New("stream idle timeout")
+
+// continuePrompt asks the model to resume an interrupted reply.
+const continuePrompt = "Your previous reply was cut off. Continue exactly where it stopped, without repeating anything."
+
+// ChatCompletionChunk is one server-sent event of a streaming response.
+type ChatCompletionChunk struct {
+	Choices []ChunkChoice `json:"choices"`
+	Usage   *Usage        `json:"usage,omitempty"`
+
+	// Diagnostics are reported with the final chunk by providers that have them.
+	Diagnostics *Diagnostics `json:"-"`
+}
+
+// hasTokens reports whether chunk carries generated content, reasoning or
+// tool call arguments.
+func (chunk ChatCompletionChunk) hasTokens() bool {
+	for _, choice := range chunk.Choices {
+		delta := choice.Delta
+		if choice.Text != "" || delta.Content != "" || delta.ReasoningContent != "" || delta.Reasoning != "" || len(delta.ToolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ChunkChoice is the incremental update of one choice.
+type ChunkChoice struct {
+	Index        int        `json:"index"`
+	Delta        ChunkDelta `json:"delta"`
+	FinishReason string     `json:"finish_reason,omitempty"`
+
+	// Text is the delta of text-completion providers.
+	Text string `json:"text,omitempty"`
+}
+
+// ChunkDelta holds the new message content of a choice.
+type ChunkDelta struct {
+	Role      Role            `json:"role,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+
+	// Reasoning deltas, under the field name used by the provider.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	Reasoning        string `json:"reasoning,omitempty"`
+}
+
+// ToolCallDelta is a fragment of a tool call. Fragments with the same Index
+// belong to the same call; Arguments arrive in pieces.
+type ToolCallDelta struct {
+	Index    int              `json:"index"`
+	ID       string           `json:"id,omitempty"`
+	Type     ToolType         `json:"type,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// StreamEvent is an update from one target of ExecuteStream. Delta events
+// carry new content of the first choice; the last event of every target has
+// Result set.
+type StreamEvent struct {
+	Target Target
+	// Index is the position of Target in the targets of the call.
+	Index  int
+	Delta  string
+	Result *Result
+}
+
+// ExecuteStream fires parallel streaming requests to all configured targets,
+// or to those of WithGroups. Content deltas and final results of all
+// targets are interleaved on the returned channel, which is closed when
+// every target has finished.
+func (c *Command) ExecuteStream(req ChatCompletionRequest, opts ...CallOption) <-chan StreamEvent {
+	cfg := newCallConfig(opts)
+	targets := c.callTargets(cfg)
+	events := make(chan StreamEvent, 16*len(targets))
+
+	go func() {
+		defer close(events)
+		ctx, cancel := withCallConfig(context.Background(), cfg)
+		defer cancel()
+		var wg sync.WaitGroup
+		for i, target := range targets {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				start := time.Now()
+				resp, err := c.streamContinuing(ctx, target, req, func(chunk ChatCompletionChunk) {
+					if delta := chunkText(chunk); delta != "" {
+						events <- StreamEvent{Target: target, Index: i, Delta: delta}
+					}
+				})
+				result := Result{Target: target, Response: resp, Error: err, Duration: time.Since(start)}
+				events <- StreamEvent{Target: target, Index: i, Result: &result}
+			}()
+		}
+		wg.Wait()
+	}()
+
+	return events
+}
+
+// StreamHandler receives the events of one streaming response through
+// callbacks, for integrations such as HTTP handlers and TUIs that would
+// otherwise drain a channel. Nil callbacks are skipped. Callbacks are
+// called sequentially from the goroutine calling Stream.
+type StreamHandler struct {
+	// OnDelta receives new content of the first choice.
+	OnDelta func(delta string)
+	// OnToolCallDelta receives tool call fragments of the first choice.
+	OnToolCallDelta func(delta ToolCallDelta)
+	// OnFinish is called once with the assembled response or the error.
+	OnFinish func(resp ChatCompletionResponse, err error)
+}
+
+// Stream sends req to target as a streaming request, calling handler as
+// chunks arrive, and returns the assembled response.
+func (c *Command) Stream(ctx context.Context, target Target, req ChatCompletionRequest, handler StreamHandler, opts ...CallOption) (ChatCompletionResponse, error) {
+	ctx, cancel := withCallConfig(ctx, newCallConfig(opts))
+	defer cancel()
+	resp, err := c.stream(ctx, target, req, handler)
+	if handler.OnFinish != nil {
+		handler.OnFinish(resp, err)
+	}
+	return resp, err
+}
+
+// StreamTo streams the response of target into w as it is generated and
+// returns the assembled response. Writers implementing http.Flusher are
+// flushed after every delta. If writing fails, the stream is still read to
+// the end and the write error is returned with the response.
+func (c *Command) StreamTo(ctx context.Context, target Target, req ChatCompletionRequest, w io.Writer, opts ...CallOption) (ChatCompletionResponse, error) {
+	flusher, _ := w.(http.Flusher)
+	var writeErr error
+	resp, err := c.Stream(ctx, target, req, StreamHandler{
+		OnDelta: func(delta string) {
+			if writeErr != nil {
+				return
+			}
+			if _, writeErr = io.WriteString(w, delta); writeErr == nil && flusher != nil {
+				flusher.Flush()
+			}
+		},
+	}, opts...)
+	if err != nil {
+		return resp, err
+	}
+	if writeErr != nil {
+		return resp, fmt.Errorf("failed to write stream: %w", writeErr)
+	}
+	return resp, nil
+}
+
+func (c *Command) stream(ctx context.Context, target Target, req ChatCompletionRequest, handler StreamHandler) (ChatCompletionResponse, error) {
+	return c.streamContinuing(ctx, target, req, func(chunk ChatCompletionChunk) {
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			if delta := choice.Delta.Content + choice.Text; delta != "" && handler.OnDelta != nil {
+				handler.OnDelta(delta)
+			}
+			if handler.OnToolCallDelta != nil {
+				for _, tc := range choice.Delta.ToolCalls {
+					handler.OnToolCallDelta(tc)
+				}
+			}
+		}
+	})
+}
+
+// streamContinuing is streamTarget with the auto-continue option of the call
+// applied: an interrupted stream is resumed by a follow-up request that
+// passes the partial reply back to the model.
+func (c *Command) streamContinuing(ctx context.Context, target Target, req ChatCompletionRequest, onChunk func(ChatCompletionChunk)) (ChatCompletionResponse, error) {
+	resp, err := c.streamTarget(ctx, target, req, onChunk)
+	for range callOptions(ctx).continues {
+		if !errors.Is(err, ErrStreamInterrupted) || ctx.Err() != nil {
+			break
+		}
+		c.log(slog.LevelInfo, "continuing interrupted stream",
+			"endpoint", target.Provider.Endpoint,
+			"model", target.Model,
+			"error", err.Error(),
+		)
+
+		partial := resp
+		followUp := req
+		followUp.Messages = append(slices.Clone(req.Messages),
+			AssistantMessage(partial.Choices[0].Message.Content), UserMessage(continuePrompt))
+		resp, err = c.streamTarget(ctx, target, followUp, onChunk)
+		resp = appendContinuation(partial, resp)
+		if err != nil && !errors.Is(err, ErrStreamInterrupted) {
+			err = fmt.Errorf("%w: %w", ErrStreamInterrupted, err)
+		}
+	}
+	return resp, err
+}
+
+// appendContinuation merges the response to a continuation request into the
+// partial response it continues.
+func appendContinuation(partial, next ChatCompletionResponse) ChatCompletionResponse {
+	merged := next
+	merged.Choices = slices.Clone(partial.Choices[:1])
+	if len(next.Choices) > 0 {
+		merged.Choices[0] = next.Choices[0]
+		merged.Choices[0].Message.Content = partial.Choices[0].Message.Content + next.Choices[0].Message.Content
+	}
+	if partial.Usage != nil && next.Usage != nil {
+		usage := *next.Usage
+		usage.PromptTokens += partial.Usage.PromptTokens
+		usage.CompletionTokens += partial.Usage.CompletionTokens
+		usage.TotalTokens += partial.Usage.TotalTokens
+		usage.Cost += partial.Usage.Cost
+		merged.Usage = &usage
+	} else if next.Usage == nil {
+		merged.Usage = partial.Usage
+	}
+	if next.Diagnostics == nil {
+		merged.Diagnostics = partial.Diagnostics
+	}
+	return merged
+}
+
+// chunkText returns the content delta of the first choice of chunk.
+func chunkText(chunk ChatCompletionChunk) string {
+	for _, choice := range chunk.Choices {
+		if choice.Index == 0 {
+			return choice.Delta.Content + choice.Text
+		}
+	}
+	return ""
+}
+
+// streamTarget sends a streaming request to target, calling onChunk for every
+// event, and returns the assembled response.
+func (c *Command) streamTarget(ctx context.Context, target Target, req ChatCompletionRequest, onChunk func(ChatCompletionChunk)) (ChatCompletionResponse, error) {
+	target, err := DefaultAliases.ResolveTarget(target)
+	if err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	req.Model = target.Model
+
+	sent := false
+	resp, err := c.chain(func(ctx context.Context, call Call) (ChatCompletionResponse, error) {
+		sent = true
+		body, err := call.body()
+		if err != nil {
+			return ChatCompletionResponse{}, err
+		}
+
+		c.log(slog.LevelDebug, "sending streaming request",
+			"endpoint", call.Target.Provider.Endpoint,
+			"model", call.Target.Model,
+		)
+		return c.streamWithRetry(ctx, call.Target, body, onChunk)
+	})(ctx, Call{Target: target, Request: req, Stream: true})
+	if !sent && err == nil {
+		onChunk(responseChunk(resp))
+	}
+	return resp, err
+}
+
+// responseChunk returns a chunk delivering resp in one piece, for streams
+// short-circuited by middleware.
+func responseChunk(resp ChatCompletionResponse) ChatCompletionChunk {
+	chunk := ChatCompletionChunk{Usage: resp.Usage, Diagnostics: resp.Diagnostics}
+	for i, choice := range resp.Choices {
+		delta := ChunkDelta{
+			Role:      choice.Message.Role,
+			Content:   choice.Message.Content,
+			Reasoning: choice.Message.Reasoning,
+		}
+		for j, call := range choice.Message.ToolCalls {
+			delta.ToolCalls = append(delta.ToolCalls, ToolCallDelta{Index: j, ID: call.ID, Type: call.Type, Function: call.Function})
+		}
+		chunk.Choices = append(chunk.Choices, ChunkChoice{Index: i, Delta: delta, FinishReason: choice.FinishReason})
+	}
+	return chunk
+}
+
+// withStreamFields adds the fields requesting a stream with usage to body.
+func withStreamFields(body []byte) ([]byte, error) {
+	fields := requestBody{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	if err := fields.set("stream", true); err != nil {
+		return nil, err
+	}
+	if err := fields.set("stream_options", map[string]any{"include_usage": true}); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// streamWithRetry is the streaming counterpart of executeWithRetry. Only
+// failures before the first chunk are retried.
+func (c *Command) streamWithRetry(ctx context.Context, target Target, body []byte, onChunk func(ChatCompletionChunk)) (ChatCompletionResponse, error) {
+	var (
+		lastErr error
+		partial ChatCompletionResponse
+	)
+	policy := c.retryPolicy(ctx)
+	for attempt := range policy.MaxAttempts {
+		if attempt > 0 {
+			c.stats.retry(target)
+		}
+		if err := c.waitRateLimit(ctx, target.Provider); err != nil {
+			return ChatCompletionResponse{}, err
+		}
+		keyed := target
+		keyed.Provider = c.selectKey(target.Provider)
+		received := false
+		attemptCtx, endSpan := c.startAttempt(ctx, target, attempt, true)
+		resp, err := c.streamSingleRequest(attemptCtx, keyed, body, func(chunk ChatCompletionChunk) {
+			received = true
+			onChunk(chunk)
+		})
+		endSpan(resp, err)
+		if err == nil {
+			return resp, nil
+		}
+
+		lastErr, partial = err, resp
+		c.log(slog.LevelWarn, "stream attempt failed",
+			"endpoint", target.Provider.Endpoint,
+			"model", target.Model,
+			"attempt", attempt+1,
+			"error", err.Error(),
+		)
+		// Content already delivered to the caller cannot be taken back.
+		if received || attempt == policy.MaxAttempts-1 {
+			break
+		}
+		// A rate-limited key is retried at once with another key from the pool.
+		rotated := c.rotateOnRateLimit(target.Provider, keyed.Provider.APIKey, err)
+		if !rotated && !retryable(ctx, err) {
+			break
+		}
+		if !allowRetry(ctx) {
+			c.log(slog.LevelWarn, "retry budget exhausted",
+				"endpoint", target.Provider.Endpoint,
+				"model", target.Model,
+			)
+			break
+		}
+		if rotated {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ChatCompletionResponse{}, fmt.Errorf("request to %s/%s aborted: %w", target.Provider.Endpoint, target.Model, ctx.Err())
+		case <-time.After(retryDelay(policy, attempt, err)):
+		}
+	}
+
+	return partial, fmt.Errorf("stream from %s/%s failed: %w", target.Provider.Endpoint, target.Model, lastErr)
+}
+
+func (c *Command) streamSingleRequest(ctx context.Context, target Target, body []byte, onChunk func(ChatCompletionChunk)) (ChatCompletionResponse, error) {
+	// Time queued for a slot counts neither as idle time of the stream nor
+	// towards its timeout.
+	release, err := c.acquireSlot(ctx)
+	if err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	defer release()
+	ctx, cancelTimeout := c.requestContext(ctx, true)
+	defer cancelTimeout()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	ctx, trace := traceRequest(ctx)
+	var watchdog *time.Timer
+	if c.idleTimeout > 0 {
+		watchdog = time.AfterFunc(c.idleTimeout, func() { cancel(ErrStreamIdle) })
+		defer watchdog.Stop()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", requestURL(target, true), bytes.NewReader(body))
+	if err != nil {
+		return ChatCompletionResponse{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	target.Provider.setHeaders(httpReq.Header)
+	setCallHeaders(ctx, httpReq.Header)
+	setTraceHeaders(ctx, httpReq.Header)
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	client, err := c.httpClient(target.Provider)
+	if err != nil {
+		return ChatCompletionResponse{}, err
+	}
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return ChatCompletionResponse{}, fmt.Errorf("HTTP request failed: %w", timeoutCause(ctx, idleCause(ctx, err)))
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(httpResp.Body)
+		return ChatCompletionResponse{}, c.responseError(httpResp, responseBody)
+	}
+
+	var events io.Reader = httpResp.Body
+	if watchdog != nil {
+		events = &idleReader{r: httpResp.Body, watchdog: watchdog, timeout: c.idleTimeout}
+	}
+	acc := &streamAccumulator{}
+	done, err := readEvents(events, func(data []byte) error {
+		chunk, err := decodeChunk(target, data)
+		if err != nil {
+			return err
+		}
+		if err := acc.add(chunk); err != nil {
+			return err
+		}
+		if chunk.hasTokens() {
+			trace.token()
+		}
+		onChunk(chunk)
+		return nil
+	})
+	if err == nil && !done && !acc.finished() {
+		err = fmt.Errorf("HTTP request failed: %w", io.ErrUnexpectedEOF)
+	}
+	if err != nil && errors.Is(context.Cause(ctx), ErrStreamIdle) {
+		err = fmt.Errorf("HTTP request failed: %w", ErrStreamIdle)
+	} else if err != nil && errors.Is(context.Cause(ctx), ErrRequestTimeout) {
+		err = fmt.Errorf("HTTP request failed: %w", ErrRequestTimeout)
+	}
+	response := acc.response()
+	response.Timing = trace.timing()
+	if err != nil {
+		if len(acc.choices) > 0 {
+			return response, fmt.Errorf("%w: %w", ErrStreamInterrupted, err)
+		}
+		return ChatCompletionResponse{}, err
+	}
+	if len(response.Choices) == 0 {
+		return ChatCompletionResponse{}, fmt.Errorf("no choices in response")
+	}
+	return response, nil
+}
+
+// decodeChunk decodes the data of one event according to target's API mode.
+func decodeChunk(target Target, data []byte) (ChatCompletionChunk, error) {
+	if target.Provider.GeminiNative {
+		var raw geminiResponse
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return ChatCompletionChunk{}, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return raw.chunk(), nil
+	}
+	var chunk ChatCompletionChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return ChatCompletionChunk{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if target.Provider.Name() == ProviderGroq {
+		chunk.Diagnostics = groqDiagnostics(data)
+	}
+	return chunk, nil
+}
+
+// idleCause returns ErrStreamIdle instead of err if the idle watchdog of ctx
+// cancelled the request.
+func idleCause(ctx context.Context, err error) error {
+	if errors.Is(context.Cause(ctx), ErrStreamIdle) {
+		return ErrStreamIdle
+	}
+	return err
+}
+
+// idleReader restarts the idle watchdog whenever data arrives.
+type idleReader struct {
+	r        io.Reader
+	watchdog *time.Timer
+	timeout  time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.watchdog.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// readEvents calls fn with the data of every server-sent event in r until
+// the [DONE] sentinel or the end of the stream, and reports whether the
+// sentinel was seen.
+func readEvents(r io.Reader, fn func(data []byte) error) (bool, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			continue
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		if string(data) == "[DONE]" {
+			return true, nil
+		}
+		if err := fn(data); err != nil {
+			return false, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	return false, nil
+}
+
+// streamAccumulator assembles chunks into a complete response.
+type streamAccumulator struct {
+	choices []ChatCompletionChoice
+	content []*strings.Builder
+	usage   *Usage
+	diag    *Diagnostics
+}
+
+// Bounds on the choice and tool call indices of a stream, which come from
+// the provider and size the accumulated response.
+const (
+	maxStreamChoices   = 128
+	maxStreamToolCalls = 1024
+)
+
+// add merges chunk into the response. It fails if the chunk has a choice
+// or tool call index out of range.
+func (a *streamAccumulator) add(chunk ChatCompletionChunk) error {
+	if chunk.Usage != nil {
+		a.usage = chunk.Usage
+	}
+	if chunk.Diagnostics != nil {
+		a.diag = chunk.Diagnostics
+	}
+	for _, delta := range chunk.Choices {
+		if delta.Index < 0 || delta.Index >= maxStreamChoices {
+			return fmt.Errorf("choice index %d out of range", delta.Index)
+		}
+		for len(a.choices) <= delta.Index {
+			a.choices = append(a.choices, ChatCompletionChoice{Message: ChatCompletionMessage{Role: RoleAssistant}})
+			a.content = append(a.content, &strings.Builder{})
+		}
+		choice := &a.choices[delta.Index]
+		if delta.Delta.Role != "" {
+			choice.Message.Role = delta.Delta.Role
+		}
+		a.content[delta.Index].WriteString(delta.Delta.Content)
+		a.content[delta.Index].WriteString(delta.Text)
+		choice.Message.Reasoning += delta.Delta.ReasoningContent + delta.Delta.Reasoning
+		if delta.FinishReason != "" {
+			choice.FinishReason = delta.FinishReason
+		}
+
+		for _, tc := range delta.Delta.ToolCalls {
+			if tc.Index < 0 || tc.Index >= maxStreamToolCalls {
+				return fmt.Errorf("tool call index %d out of range", tc.Index)
+			}
+			for len(choice.Message.ToolCalls) <= tc.Index {
+				choice.Message.ToolCalls = append(choice.Message.ToolCalls, ToolCall{Type: ToolTypeFunction})
+			}
+			call := &choice.Message.ToolCalls[tc.Index]
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			if tc.Type != "" {
+				call.Type = tc.Type
+			}
+			call.Function.Name += tc.Function.Name
+			call.Function.Arguments += tc.Function.Arguments
+		}
+	}
+	return nil
+}
+
+// finished reports whether any choice has a finish reason.
+func (a *streamAccumulator) finished() bool {
+	for _, choice := range a.choices {
+		if choice.FinishReason != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *streamAccumulator) response() ChatCompletionResponse {
+	response := ChatCompletionResponse{Usage: a.usage, Diagnostics: a.diag}
+	for i, choice := range a.choices {
+		choice.Message.Content = a.content[i].String()
+		response.Choices = append(response.Choices, choice)
+	}
+	return response
+}
@@ -0,0 +1,107 @@
+package general
+
+import "time"
+
+// UsageSummary aggregates the results of one target, or of a whole run.
+type UsageSummary struct {
+	// Target is the target of a per-target summary and zero in the total.
+	Target Target
+
+	Requests int
+	Errors   int
+
+	PromptTokens     int
+	CompletionTokens int
+	// Cost is the reported or catalog-estimated USD cost of the successful
+	// results. Unpriced counts those whose cost is unknown and not included.
+	Cost     float64
+	Unpriced int
+
+	// TotalLatency is the sum of the result durations and MaxLatency the
+	// longest, which for parallel requests is the wall-clock time of the run.
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+}
+
+// Successes returns the number of results without an error.
+func (s UsageSummary) Successes() int {
+	return s.Requests - s.Errors
+}
+
+// MeanLatency returns the average result duration.
+func (s UsageSummary) MeanLatency() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Requests)
+}
+
+// add accounts for r.
+func (s *UsageSummary) add(r Result) {
+	s.Requests++
+	s.TotalLatency += r.Duration
+	s.MaxLatency = max(s.MaxLatency, r.Duration)
+	if r.Error != nil {
+		s.Errors++
+		return
+	}
+	if usage := r.Response.Usage; usage != nil {
+		s.PromptTokens += usage.PromptTokens
+		s.CompletionTokens += usage.CompletionTokens
+	}
+	if cost, ok := r.EstimatedCost(); ok {
+		s.Cost += cost
+	} else {
+		s.Unpriced++
+	}
+}
+
+// Summary is the aggregate usage, cost and latency of a set of results.
+type Summary struct {
+	Total UsageSummary
+	// Targets holds a summary per provider and model, in order of their
+	// first result.
+	Targets []UsageSummary
+}
+
+// Summarize totals the tokens, cost, latency and errors of results, such as
+// those of a Broadcast, overall and per target.
+func Summarize(results []Result) Summary {
+	var summary Summary
+	index := make(map[statsKey]int)
+	for _, r := range results {
+		key := statsKey{r.Target.Provider.Endpoint, r.Target.Model}
+		i, ok := index[key]
+		if !ok {
+			i = len(summary.Targets)
+			index[key] = i
+			summary.Targets = append(summary.Targets, UsageSummary{Target: r.Target})
+		}
+		summary.Targets[i].add(r)
+		summary.Total.add(r)
+	}
+	return summary
+}
+
+// EstimatedCost returns the USD cost of r as reported by the provider, or
+// else estimated from the DefaultCatalog prices of its model. It reports
+// false when r has no usage or its model is not in the catalog.
+func (r Result) EstimatedCost() (float64, bool) {
+	return estimateCost(r.Target, r.Response.Usage)
+}
+
+// estimateCost returns the USD cost reported in usage, or else an estimate
+// from the catalog prices of target.
+func estimateCost(target Target, usage *Usage) (float64, bool) {
+	if usage == nil {
+		return 0, false
+	}
+	if usage.Cost > 0 {
+		return usage.Cost, true
+	}
+	details, ok := ModelInfo(target.Provider.Name(), target.Model)
+	if !ok {
+		return 0, false
+	}
+	return details.Pricing.Cost(*usage), true
+}
@@ -0,0 +1,189 @@
+package general
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Names of the tiktoken encodings whose splitting rules Encoding knows.
+const (
+	EncodingCL100K = "cl100k_base"
+	EncodingO200K  = "o200k_base"
+)
+
+// Pre-tokenization patterns of the tiktoken encodings. tiktoken ends both
+// with `\s+(?!\S)|\s+`; RE2 has no lookahead, so Encoding drops the last
+// whitespace character of such runs itself.
+var encodingPatterns = map[string]*regexp.Regexp{
+	EncodingCL100K: regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`),
+	EncodingO200K: regexp.MustCompile(`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`),
+}
+
+// Encoding is a byte-pair encoding compatible with tiktoken, loaded from
+// a tiktoken rank file. The vocabularies are not bundled; download
+// cl100k_base.tiktoken or o200k_base.tiktoken from OpenAI's public
+// encodings and load them with LoadEncodingFile. An Encoding is a
+// Tokenizer and is safe for concurrent use.
+type Encoding struct {
+	name    string
+	ranks   map[string]int
+	pattern *regexp.Regexp
+}
+
+// LoadEncoding reads a tiktoken rank file, one base64 token and its rank
+// per line, for the encoding called name.
+func LoadEncoding(name string, r io.Reader) (*Encoding, error) {
+	pattern, ok := encodingPatterns[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	e := &Encoding{name: name, ranks: make(map[string]int), pattern: pattern}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid encoding line %q", line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encoding token %q: %w", token, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encoding rank %q: %w", rank, err)
+		}
+		e.ranks[string(decoded)] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read encoding: %w", err)
+	}
+	return e, nil
+}
+
+// LoadEncodingFile loads the encoding called name from a tiktoken file.
+func LoadEncodingFile(name, path string) (*Encoding, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open encoding: %w", err)
+	}
+	defer f.Close()
+	return LoadEncoding(name, f)
+}
+
+// Name returns the name of the encoding.
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Encode returns the token ranks of text.
+func (e *Encoding) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range e.split(text) {
+		if rank, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+		tokens = append(tokens, e.bytePairMerge(piece)...)
+	}
+	return tokens
+}
+
+// Count returns the number of tokens in text.
+func (e *Encoding) Count(text string) int {
+	return len(e.Encode(text))
+}
+
+// split pre-tokenizes text into the pieces that are encoded separately.
+func (e *Encoding) split(text string) []string {
+	var pieces []string
+	for start := 0; start < len(text); {
+		loc := e.pattern.FindStringIndex(text[start:])
+		if loc == nil {
+			break
+		}
+		end := start + loc[1]
+		piece := text[start:end]
+		// Emulate \s+(?!\S): a whitespace run followed by a non-space
+		// leaves its last character to the next piece.
+		if end < len(text) && isSpaceRun(piece) && utf8.RuneCountInString(piece) > 1 {
+			next, _ := utf8.DecodeRuneInString(text[end:])
+			if !unicode.IsSpace(next) {
+				_, size := utf8.DecodeLastRuneInString(piece)
+				end -= size
+				piece = text[start:end]
+			}
+		}
+		pieces = append(pieces, piece)
+		start = end
+	}
+	return pieces
+}
+
+// isSpaceRun reports whether s is whitespace that does not end a line.
+func isSpaceRun(s string) bool {
+	if strings.HasSuffix(s, "\n") || strings.HasSuffix(s, "\r") {
+		return false
+	}
+	return strings.TrimSpace(s) == ""
+}
+
+// bytePairMerge encodes piece by repeatedly merging the adjacent pair of
+// parts with the lowest rank.
+func (e *Encoding) bytePairMerge(piece string) []int {
+	parts := make([]string, len(piece))
+	for i := range piece {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i < len(parts)-1; i++ {
+			if rank, ok := e.ranks[parts[i]+parts[i+1]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+
+	tokens := make([]int, 0, len(parts))
+	for _, part := range parts {
+		if rank, ok := e.ranks[part]; ok {
+			tokens = append(tokens, rank)
+		}
+	}
+	return tokens
+}
+
+// EncodingForModel returns the tiktoken encoding OpenAI models use: o200k
+// for the GPT-4o, GPT-4.1, GPT-5 and o-series models and cl100k for older
+// GPT-4 and GPT-3.5 models. It returns "" for other models.
+func EncodingForModel(model string) string {
+	name := baseModelName(model)
+	switch {
+	case strings.HasPrefix(name, "gpt-4o"), strings.HasPrefix(name, "gpt-4.1"), strings.HasPrefix(name, "gpt-5"),
+		strings.HasPrefix(name, "chatgpt-4o"), strings.HasPrefix(name, "o1"), strings.HasPrefix(name, "o3"),
+		strings.HasPrefix(name, "o4"), strings.HasPrefix(name, "gpt-oss"):
+		return EncodingO200K
+	case strings.HasPrefix(name, "gpt-4"), strings.HasPrefix(name, "gpt-3.5"), strings.HasPrefix(name, "text-embedding"):
+		return EncodingCL100K
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package general
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrHeaderTimeout is returned when a provider accepts the connection but
+// does not send response headers within Timeouts.ResponseHeader.
+var ErrHeaderTimeout = errors.New("timed out waiting for response headers")
+
+// ErrRequestTimeout is returned when a request, including reading its whole
+// response, exceeds Timeouts.Total or, for streams, Timeouts.Stream.
+var ErrRequestTimeout = errors.New("request timed out")
+
+// Timeouts bounds the phases of each HTTP request. Zero fields impose no
+// limit, except that a zero Stream falls back to Total.
+type Timeouts struct {
+	// Dial bounds establishing the TCP connection.
+	Dial time.Duration
+	// TLSHandshake bounds the TLS handshake.
+	TLSHandshake time.Duration
+	// ResponseHeader bounds the wait for response headers after the request
+	// is sent: the time a provider may queue or prefill before answering.
+	ResponseHeader time.Duration
+	// Total bounds a non-streaming request from start to the end of its body.
+	Total time.Duration
+	// Stream bounds a streaming request from start to its last chunk, so
+	// long generations can get a larger budget than plain requests.
+	Stream time.Duration
+}
+
+// WithTimeouts sets per-phase timeouts, replacing the WithTimeout default.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(c *Command) { c.timeouts = timeouts }
+}
+
+// connection returns the timeouts applied by the transport.
+func (t Timeouts) connection() Timeouts {
+	return Timeouts{Dial: t.Dial, TLSHandshake: t.TLSHandshake, ResponseHeader: t.ResponseHeader}
+}
+
+// apply sets the connection timeouts on transport.
+func (t Timeouts) apply(transport *http.Transport) {
+	if t.Dial > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: t.Dial, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if t.TLSHandshake > 0 {
+		transport.TLSHandshakeTimeout = t.TLSHandshake
+	}
+	if t.ResponseHeader > 0 {
+		transport.ResponseHeaderTimeout = t.ResponseHeader
+	}
+}
+
+// requestContext bounds ctx by the total timeout of a plain or streaming
+// request. The returned cancel function must always be called.
+func (c *Command) requestContext(ctx context.Context, stream bool) (context.Context, context.CancelFunc) {
+	total := c.timeouts.Total
+	if stream && c.timeouts.Stream > 0 {
+		total = c.timeouts.Stream
+	}
+	if total <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, total, ErrRequestTimeout)
+}
+
+// timeoutCause replaces err with ErrRequestTimeout or ErrHeaderTimeout if
+// one of the Command's timeouts caused it.
+func timeoutCause(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(context.Cause(ctx), ErrRequestTimeout):
+		return ErrRequestTimeout
+	case strings.Contains(err.Error(), "timeout awaiting response headers"):
+		return ErrHeaderTimeout
+	}
+	return err
+}
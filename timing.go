@@ -0,0 +1,143 @@
+package general
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing breaks down the duration of the HTTP request that produced a
+// response. With retries, it covers the last attempt only. DNS, Connect and
+// TLS are zero when the connection was reused.
+type Timing struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// TTFB is the time from the start of the request to the first response
+	// byte, connection setup included.
+	TTFB time.Duration
+	// BodyRead is the time from the first response byte to the end of the
+	// body: the generation time of a stream.
+	BodyRead time.Duration
+	Total    time.Duration
+	Reused   bool
+	// Generation is the time from the first to the last generated token of
+	// a stream. It is zero for plain requests.
+	Generation time.Duration
+}
+
+// Timing returns the phase timing of the request behind r, or nil if the
+// response was not fetched over HTTP, as with cache hits.
+func (r Result) Timing() *Timing {
+	return r.Response.Timing
+}
+
+// TokensPerSecond returns the decode throughput of r: completion tokens per
+// second of generation. Generation time is the provider-reported completion
+// time if any, else the time between the first and last token of a stream,
+// else the whole request duration, which understates plain requests by
+// including the prompt processing. It returns 0 without usage.
+func (r Result) TokensPerSecond() float64 {
+	usage := r.Response.Usage
+	if usage == nil || usage.CompletionTokens == 0 {
+		return 0
+	}
+	generation := r.Duration
+	switch {
+	case r.Response.Diagnostics != nil && r.Response.Diagnostics.CompletionTime > 0:
+		generation = r.Response.Diagnostics.CompletionTime
+	case r.Response.Timing != nil && r.Response.Timing.Generation > 0:
+		generation = r.Response.Timing.Generation
+	}
+	if generation <= 0 {
+		return 0
+	}
+	return float64(usage.CompletionTokens) / generation.Seconds()
+}
+
+// phaseTrace records the phase boundaries of one request from httptrace hooks,
+// which may run on different goroutines.
+type phaseTrace struct {
+	mu                     sync.Mutex
+	start                  time.Time
+	dnsStart, dnsDone      time.Time
+	connectStart, connDone time.Time
+	tlsStart, tlsDone      time.Time
+	firstByte              time.Time
+	firstToken, lastToken  time.Time
+	reused                 bool
+}
+
+// traceRequest returns ctx instrumented to record the phases of a request
+// started now.
+func traceRequest(ctx context.Context) (context.Context, *phaseTrace) {
+	t := &phaseTrace{start: time.Now()}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn:  func(info httptrace.GotConnInfo) { t.record(func() { t.reused = info.Reused }) },
+		DNSStart: func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		ConnectStart: func(string, string) {
+			t.record(func() {
+				// Dual-stack dialing may start several connects; keep the first.
+				if t.connectStart.IsZero() {
+					t.connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone:          func(string, string, error) { t.mark(&t.connDone) },
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.mark(&t.tlsDone) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+	}), t
+}
+
+func (t *phaseTrace) record(f func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f()
+}
+
+func (t *phaseTrace) mark(at *time.Time) {
+	t.record(func() { *at = time.Now() })
+}
+
+// token records the arrival of a chunk carrying generated tokens.
+func (t *phaseTrace) token() {
+	t.record(func() {
+		t.lastToken = time.Now()
+		if t.firstToken.IsZero() {
+			t.firstToken = t.lastToken
+		}
+	})
+}
+
+// timing returns the phases of the request, ending now.
+func (t *phaseTrace) timing() *Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	end := time.Now()
+	timing := &Timing{
+		DNS:     between(t.dnsStart, t.dnsDone),
+		Connect: between(t.connectStart, t.connDone),
+		TLS:     between(t.tlsStart, t.tlsDone),
+		TTFB:    between(t.start, t.firstByte),
+		Total:   end.Sub(t.start),
+		Reused:  t.reused,
+
+		Generation: between(t.firstToken, t.lastToken),
+	}
+	if !t.firstByte.IsZero() {
+		timing.BodyRead = end.Sub(t.firstByte)
+	}
+	return timing
+}
+
+// between returns the time from start to end, or 0 unless both are set.
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
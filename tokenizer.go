@@ -0,0 +1,330 @@
+package general
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Model families with built-in tokenizer heuristics.
+const (
+	FamilyGPT      = "gpt"
+	FamilyClaude   = "claude"
+	FamilyGemini   = "gemini"
+	FamilyGemma    = "gemma"
+	FamilyLlama    = "llama"
+	FamilyQwen     = "qwen"
+	FamilyMistral  = "mistral"
+	FamilyDeepSeek = "deepseek"
+)
+
+const (
+	defaultCharsPerToken = 4.0
+	calibrationWeight    = 0.2
+	minCalibration       = 0.25
+	maxCalibration       = 4.0
+)
+
+// Tokenizer counts the tokens a model's vocabulary needs to encode a text.
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// TokenizerFunc adapts an ordinary function to the Tokenizer interface.
+type TokenizerFunc func(text string) int
+
+// Count calls f(text).
+func (f TokenizerFunc) Count(text string) int {
+	return f(text)
+}
+
+// HeuristicTokenizer estimates token counts from the number of characters.
+type HeuristicTokenizer struct {
+	CharsPerToken float64
+}
+
+// Count returns the estimated number of tokens in text.
+func (h HeuristicTokenizer) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	ratio := h.CharsPerToken
+	if ratio <= 0 {
+		ratio = defaultCharsPerToken
+	}
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / ratio))
+}
+
+// familyPatterns maps substrings of model names to their family, checked in
+// order. Patterns marked segment only match a whole segment of the name
+// delimited by "-", "_", "." or ":", so that "o1" matches "o1-mini" but
+// not "falcon-40b-pro1".
+var familyPatterns = []struct {
+	pattern string
+	family  string
+	segment bool
+}{
+	{"gemma", FamilyGemma, false},
+	{"gemini", FamilyGemini, false},
+	{"llama", FamilyLlama, false},
+	{"qwen", FamilyQwen, false},
+	{"qwq", FamilyQwen, false},
+	{"mistral", FamilyMistral, false},
+	{"mixtral", FamilyMistral, false},
+	{"deepseek", FamilyDeepSeek, false},
+	{"claude", FamilyClaude, false},
+	{"gpt", FamilyGPT, false},
+	{"o1", FamilyGPT, true},
+	{"o3", FamilyGPT, true},
+	{"o4", FamilyGPT, true},
+}
+
+// ModelFamily returns the tokenizer family of a model name, or "" if unknown.
+// Vendor prefixes such as "meta-llama/" are ignored.
+func ModelFamily(model string) string {
+	name := baseModelName(model)
+	for _, p := range familyPatterns {
+		if p.segment && containsSegment(name, p.pattern) || !p.segment && strings.Contains(name, p.pattern) {
+			return p.family
+		}
+	}
+	return ""
+}
+
+// containsSegment reports whether segment is one of the parts of name
+// delimited by "-", "_", "." or ":".
+func containsSegment(name, segment string) bool {
+	return slices.Contains(strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_' || r == '.' || r == ':'
+	}), segment)
+}
+
+// TokenizerRegistry holds tokenizers per model family.
+// Calibration, when enabled, compares local counts against provider-reported
+// usage and scales future counts for that family accordingly.
+type TokenizerRegistry struct {
+	mu          sync.RWMutex
+	tokenizers  map[string]Tokenizer
+	encodings   map[string]*Encoding
+	calibrate   bool
+	calibration map[string]calibration
+}
+
+type calibration struct {
+	factor  float64
+	samples int
+}
+
+// NewTokenizerRegistry creates a registry with heuristics for the built-in families.
+func NewTokenizerRegistry() *TokenizerRegistry {
+	return &TokenizerRegistry{
+		tokenizers: map[string]Tokenizer{
+			FamilyGPT:      HeuristicTokenizer{CharsPerToken: 4.0},
+			FamilyClaude:   HeuristicTokenizer{CharsPerToken: 3.5},
+			FamilyGemini:   HeuristicTokenizer{CharsPerToken: 4.0},
+			FamilyGemma:    HeuristicTokenizer{CharsPerToken: 4.0},
+			FamilyLlama:    HeuristicTokenizer{CharsPerToken: 3.8},
+			FamilyQwen:     HeuristicTokenizer{CharsPerToken: 3.7},
+			FamilyMistral:  HeuristicTokenizer{CharsPerToken: 3.5},
+			FamilyDeepSeek: HeuristicTokenizer{CharsPerToken: 3.7},
+		},
+		encodings:   make(map[string]*Encoding),
+		calibration: make(map[string]calibration),
+	}
+}
+
+// DefaultTokenizers is the registry used by package-level helpers.
+var DefaultTokenizers = NewTokenizerRegistry()
+
+// RegisterTokenizer registers t for a model family in DefaultTokenizers.
+func RegisterTokenizer(family string, t Tokenizer) {
+	DefaultTokenizers.Register(family, t)
+}
+
+// RegisterEncoding registers a tiktoken encoding in DefaultTokenizers.
+func RegisterEncoding(e *Encoding) {
+	DefaultTokenizers.RegisterEncoding(e)
+}
+
+// TokenizerFor returns the tokenizer for model from DefaultTokenizers.
+func TokenizerFor(model string) Tokenizer {
+	return DefaultTokenizers.For(model)
+}
+
+// Register sets the tokenizer for a model family, replacing any existing one.
+func (r *TokenizerRegistry) Register(family string, t Tokenizer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokenizers[family] = t
+}
+
+// RegisterEncoding registers a tiktoken encoding, used instead of the family
+// tokenizer for the models EncodingForModel maps to it.
+func (r *TokenizerRegistry) RegisterEncoding(e *Encoding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.encodings[e.Name()] = e
+}
+
+// For returns the registered encoding of model if there is one, and
+// otherwise the tokenizer for model's family, falling back to a generic
+// heuristic. Family tokenizers apply the current calibration factor.
+func (r *TokenizerRegistry) For(model string) Tokenizer {
+	family := ModelFamily(model)
+
+	r.mu.RLock()
+	e, exact := r.encodings[EncodingForModel(model)]
+	t, ok := r.tokenizers[family]
+	r.mu.RUnlock()
+	if exact {
+		return e
+	}
+	if !ok {
+		t = HeuristicTokenizer{CharsPerToken: defaultCharsPerToken}
+	}
+
+	return TokenizerFunc(func(text string) int {
+		n := t.Count(text)
+		if factor := r.factor(family); factor != 1 {
+			n = int(math.Ceil(float64(n) * factor))
+		}
+		return n
+	})
+}
+
+// SetCalibration enables or disables calibration against reported usage.
+// Disabling keeps learned factors; use ResetCalibration to discard them.
+func (r *TokenizerRegistry) SetCalibration(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calibrate = enabled
+}
+
+// ResetCalibration discards all learned calibration factors.
+func (r *TokenizerRegistry) ResetCalibration() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calibration = make(map[string]calibration)
+}
+
+// Observe records a provider-reported token count for a text that the
+// tokenizer returned by For(model) counted as localCount.
+// It is a no-op unless calibration is enabled.
+func (r *TokenizerRegistry) Observe(model string, localCount, reportedCount int) {
+	if localCount <= 0 || reportedCount <= 0 {
+		return
+	}
+	family := ModelFamily(model)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.calibrate {
+		return
+	}
+
+	cal, ok := r.calibration[family]
+	if !ok {
+		cal.factor = 1
+	}
+	// localCount already includes the current factor, so scale the correction onto it.
+	observed := cal.factor * float64(reportedCount) / float64(localCount)
+	cal.factor = cal.factor*(1-calibrationWeight) + observed*calibrationWeight
+	cal.factor = math.Min(math.Max(cal.factor, minCalibration), maxCalibration)
+	cal.samples++
+	r.calibration[family] = cal
+}
+
+// Calibration returns the learned correction factor for model's family and
+// the number of observations it is based on. The factor is 1 with no samples.
+func (r *TokenizerRegistry) Calibration(model string) (factor float64, samples int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cal, ok := r.calibration[ModelFamily(model)]
+	if !ok {
+		return 1, 0
+	}
+	return cal.factor, cal.samples
+}
+
+func (r *TokenizerRegistry) factor(family string) float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if cal, ok := r.calibration[family]; ok {
+		return cal.factor
+	}
+	return 1
+}
+
+// observeUsage feeds a successful response's prompt usage into calibration.
+// The reported count covers roles and the framing of the chat format, which
+// are subtracted as constants so that only the counts of the tokenizer are
+// compared, and the factor then settles where CountTokens matches the
+// provider. Models with a registered encoding are exact and not calibrated,
+// and requests with tools are skipped, as their definitions are not counted
+// locally.
+func (r *TokenizerRegistry) observeUsage(model string, req ChatCompletionRequest, usage *Usage) {
+	if usage == nil || usage.PromptTokens == 0 || len(req.Tools) > 0 {
+		return
+	}
+	r.mu.RLock()
+	enabled := r.calibrate
+	_, exact := r.encodings[EncodingForModel(model)]
+	r.mu.RUnlock()
+	if !enabled || exact {
+		return
+	}
+
+	counted, framing := countMessages(r.For(model), req.Messages)
+	r.Observe(model, counted, usage.PromptTokens-framing)
+}
+
+// Overhead of the OpenAI chat format: each message is framed by three
+// tokens and the reply is primed with three more. An image part is counted
+// as a 1024x1024 image at high detail.
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+	tokensPerImage   = 765
+)
+
+// CountTokens estimates the prompt tokens of messages for model with
+// DefaultTokenizers.
+func CountTokens(model string, messages []ChatCompletionMessage) int {
+	return DefaultTokenizers.CountTokens(model, messages)
+}
+
+// CountTokens estimates the prompt tokens of messages for model: their
+// role, text and tool calls counted by For(model), plus the framing of the
+// chat format. It is exact for OpenAI models with a registered encoding and
+// text-only messages, and an estimate otherwise.
+func (r *TokenizerRegistry) CountTokens(model string, messages []ChatCompletionMessage) int {
+	counted, framing := countMessages(r.For(model), messages)
+	return counted + framing
+}
+
+// countMessages returns the tokens of messages counted by t and the fixed
+// tokens of the chat format and of images, which t does not count.
+func countMessages(t Tokenizer, messages []ChatCompletionMessage) (counted, framing int) {
+	if len(messages) == 0 {
+		return 0, 0
+	}
+	framing = tokensPerReply
+	for _, m := range messages {
+		framing += tokensPerMessage
+		counted += t.Count(string(m.Role)) + t.Count(m.Text())
+		for _, p := range m.Parts {
+			if p.Type == "image_url" {
+				framing += tokensPerImage
+			}
+		}
+		for _, call := range m.ToolCalls {
+			counted += t.Count(call.Function.Name) + t.Count(call.Function.Arguments)
+		}
+		if m.ToolCallID != "" {
+			counted += t.Count(m.ToolCallID)
+		}
+	}
+	return counted, framing
+}
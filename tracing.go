@@ -0,0 +1,132 @@
+package general
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// TracerProvider, Tracer and Span are the subset of the OpenTelemetry trace
+// API used by Command, so that the module needs no OpenTelemetry dependency.
+// An adapter over go.opentelemetry.io/otel/trace implements them in a few
+// lines: Start maps to Tracer.Start with the attributes set on the span,
+// and SpanContext copies the IDs and sampled flag of the span's context.
+type TracerProvider interface {
+	Tracer(name string) Tracer
+}
+
+// Tracer starts spans.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is one traced operation.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	// RecordError marks the span as failed with err.
+	RecordError(err error)
+	End()
+	SpanContext() SpanContext
+}
+
+// Attribute is a key-value pair attached to a span. Value is a string,
+// int or bool.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// SpanContext identifies a span for propagation to the provider.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether sc has non-zero IDs.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// traceParent formats sc as a W3C traceparent header value.
+func (sc SpanContext) traceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// tracerName is the instrumentation name passed to TracerProvider.Tracer.
+const tracerName = "github.com/festeh/general"
+
+// WithTracerProvider emits a span for every request attempt, with the
+// provider, model, HTTP status, retry count and token usage as attributes
+// following the OpenTelemetry GenAI and HTTP conventions. Requests carry a
+// traceparent header so gateways that support it can join the trace.
+func WithTracerProvider(provider TracerProvider) Option {
+	return func(c *Command) { c.tracer = provider.Tracer(tracerName) }
+}
+
+type spanKey struct{}
+
+// startAttempt starts the span of one request attempt to target. The
+// returned function ends it with the outcome of the attempt.
+func (c *Command) startAttempt(ctx context.Context, target Target, attempt int, stream bool) (context.Context, func(ChatCompletionResponse, error)) {
+	if c.tracer == nil {
+		return ctx, func(ChatCompletionResponse, error) {}
+	}
+
+	ctx, span := c.tracer.Start(ctx, "chat "+target.Model)
+	system := target.Provider.Name()
+	if system == "" {
+		system = "openai_compatible"
+	}
+	attrs := []Attribute{
+		{Key: "gen_ai.operation.name", Value: "chat"},
+		{Key: "gen_ai.system", Value: system},
+		{Key: "gen_ai.request.model", Value: target.Model},
+		{Key: "http.request.resend_count", Value: attempt},
+		{Key: "general.stream", Value: stream},
+	}
+	if u, err := url.Parse(target.Provider.Endpoint); err == nil {
+		attrs = append(attrs, Attribute{Key: "server.address", Value: u.Hostname()})
+	}
+	span.SetAttributes(attrs...)
+
+	return context.WithValue(ctx, spanKey{}, span), func(resp ChatCompletionResponse, err error) {
+		var apiErr *APIError
+		switch {
+		case err == nil:
+			span.SetAttributes(Attribute{Key: "http.response.status_code", Value: http.StatusOK})
+		case errors.As(err, &apiErr):
+			span.SetAttributes(Attribute{Key: "http.response.status_code", Value: apiErr.StatusCode})
+		}
+		if usage := resp.Usage; usage != nil {
+			span.SetAttributes(
+				Attribute{Key: "gen_ai.usage.input_tokens", Value: usage.PromptTokens},
+				Attribute{Key: "gen_ai.usage.output_tokens", Value: usage.CompletionTokens},
+			)
+		}
+		if len(resp.Choices) > 0 && resp.Choices[0].FinishReason != "" {
+			span.SetAttributes(Attribute{Key: "gen_ai.response.finish_reasons", Value: resp.Choices[0].FinishReason})
+		}
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}
+}
+
+// setTraceHeaders propagates the attempt span of ctx, if any, to the provider.
+func setTraceHeaders(ctx context.Context, h http.Header) {
+	span, ok := ctx.Value(spanKey{}).(Span)
+	if !ok {
+		return
+	}
+	if sc := span.SpanContext(); sc.IsValid() {
+		h.Set("traceparent", sc.traceParent())
+	}
+}
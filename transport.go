@@ -0,0 +1,278 @@
+package general
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// NoProxy as a Provider.Proxy connects directly, bypassing the Command proxy
+// and proxy environment variables.
+const NoProxy = "direct"
+
+// transportKey identifies an HTTP client configuration that providers can share.
+type transportKey struct {
+	proxy     string
+	tls       TLSConfig
+	transport TransportConfig
+	timeouts  Timeouts
+}
+
+// HTTP protocol choices for TransportConfig.Protocol.
+const (
+	ProtocolAuto  = ""      // HTTP/2 where the server supports it, else HTTP/1.1
+	ProtocolHTTP1 = "http1" // HTTP/1.1 only
+	ProtocolHTTP2 = "http2" // HTTP/2 only, with prior knowledge over plain TCP
+)
+
+// TransportConfig tunes the connections of a Command. Zero fields keep the
+// net/http defaults.
+type TransportConfig struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost bounds all connections to a host, idle or not.
+	MaxConnsPerHost int
+	IdleConnTimeout time.Duration
+	Protocol        string
+	// CompressRequests gzips request bodies, which helps with long prompts
+	// on slow uplinks. The provider must accept Content-Encoding: gzip.
+	CompressRequests bool
+}
+
+// WithTransport tunes the connection pool and protocol of the Command. High
+// request volumes to few hosts want a MaxIdleConnsPerHost close to their
+// concurrency, since the default of 2 closes most connections after use.
+func WithTransport(cfg TransportConfig) Option {
+	return func(c *Command) { c.transport = cfg }
+}
+
+// TLSConfig customizes TLS for providers behind internal gateways.
+// Paths point to PEM files; empty fields keep the system defaults.
+type TLSConfig struct {
+	// CAFile holds root certificates trusted in addition to the system pool.
+	CAFile string
+	// CertFile and KeyFile hold a client certificate for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables server certificate verification.
+	InsecureSkipVerify bool
+}
+
+// SetProxy routes requests through the proxy at rawURL (http, https or socks5)
+// for providers without their own Proxy. An empty URL restores the
+// HTTP_PROXY/HTTPS_PROXY environment defaults.
+func (c *Command) SetProxy(rawURL string) error {
+	if rawURL != "" && rawURL != NoProxy {
+		if _, err := parseProxy(rawURL); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.proxy = rawURL
+	return nil
+}
+
+// SetTLS applies cfg to providers without their own TLS configuration.
+// The certificate files are loaded immediately so errors surface here.
+func (c *Command) SetTLS(cfg TLSConfig) error {
+	if _, err := cfg.load(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tls = cfg
+	return nil
+}
+
+// httpClient returns the client for requests to p, creating a dedicated
+// transport the first time a configuration is seen. The transport derives
+// from the one given with WithHTTPClient; a RoundTripper other than an
+// *http.Transport is kept as is, since it manages its own connections.
+func (c *Command) httpClient(p Provider) (*http.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := transportKey{proxy: p.Proxy}
+	if key.proxy == "" {
+		key.proxy = c.proxy
+	}
+	key.tls = c.tls
+	key.transport = c.transport
+	key.timeouts = c.timeouts.connection()
+	if p.TLS != nil {
+		key.tls = *p.TLS
+	}
+	if key == (transportKey{}) {
+		return c.client, nil
+	}
+	if client, ok := c.clients[key]; ok {
+		return client, nil
+	}
+
+	client := *c.client
+	base, ok := c.client.Transport.(*http.Transport)
+	if c.client.Transport == nil {
+		base, ok = http.DefaultTransport.(*http.Transport), true
+	}
+	if ok {
+		transport, err := newTransport(base, key)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+	}
+	if key.transport.CompressRequests {
+		client.Transport = gzipTransport{client.Transport}
+	}
+	if c.clients == nil {
+		c.clients = make(map[transportKey]*http.Client)
+	}
+	c.clients[key] = &client
+	return &client, nil
+}
+
+// newTransport returns a copy of base configured for key.
+func newTransport(base *http.Transport, key transportKey) (*http.Transport, error) {
+	transport := base.Clone()
+
+	switch key.proxy {
+	case "":
+	case NoProxy:
+		transport.Proxy = nil
+	default:
+		proxyURL, err := parseProxy(key.proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if key.tls != (TLSConfig{}) {
+		tlsConfig, err := key.tls.load()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	key.timeouts.apply(transport)
+	if err := key.transport.apply(transport); err != nil {
+		return nil, err
+	}
+	return transport, nil
+}
+
+// apply sets the tuned fields of cfg on transport.
+func (cfg TransportConfig) apply(transport *http.Transport) error {
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	}
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+
+	var protocols http.Protocols
+	switch cfg.Protocol {
+	case ProtocolAuto:
+		return nil
+	case ProtocolHTTP1:
+		protocols.SetHTTP1(true)
+	case ProtocolHTTP2:
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	default:
+		return fmt.Errorf("unknown HTTP protocol %q", cfg.Protocol)
+	}
+	transport.Protocols = &protocols
+	return nil
+}
+
+// gzipTransport compresses request bodies before sending them.
+type gzipTransport struct {
+	base http.RoundTripper
+}
+
+func (t gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+		return t.base.RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(body)
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress request body: %w", err)
+	}
+	compressed := buf.Bytes()
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Content-Encoding", "gzip")
+	req.ContentLength = int64(len(compressed))
+	req.Body = io.NopCloser(bytes.NewReader(compressed))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(compressed)), nil
+	}
+	return t.base.RoundTrip(req)
+}
+
+// load builds a *tls.Config from the configured files.
+func (t TLSConfig) load() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+func parseProxy(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", rawURL, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return proxyURL, nil
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: unsupported scheme %q", rawURL, proxyURL.Scheme)
+	}
+}
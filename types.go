@@ -1,40 +1,166 @@
 package general
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // ChatCompletionRequest represents an OpenAI-compatible chat completion request.
 type ChatCompletionRequest struct {
-	Model       string                  `json:"model"`
-	Messages    []ChatCompletionMessage `json:"messages"`
-	MaxTokens   int                     `json:"max_tokens,omitempty"`
-	Temperature float64                 `json:"temperature,omitempty"`
-	Tools       []Tool                  `json:"tools,omitempty"`
-	ToolChoice  any                     `json:"tool_choice,omitempty"`
+	Model               string                  `json:"model"`
+	Messages            []ChatCompletionMessage `json:"messages"`
+	MaxTokens           int                     `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                     `json:"max_completion_tokens,omitempty"`
+	Temperature         float64                 `json:"temperature,omitempty"`
+	TopP                float64                 `json:"top_p,omitempty"`
+	Seed                *int                    `json:"seed,omitempty"`
+	Stop                []string                `json:"stop,omitempty"`
+	LogitBias           map[string]int          `json:"logit_bias,omitempty"`
+	N                   int                     `json:"n,omitempty"`
+	Tools               []Tool                  `json:"tools,omitempty"`
+	ToolChoice          any                     `json:"tool_choice,omitempty"`
+	Logprobs            bool                    `json:"logprobs,omitempty"`
+	TopLogprobs         int                     `json:"top_logprobs,omitempty"`
+
+	// ReasoningEffort ("low", "medium", "high") and ThinkingBudget (tokens)
+	// tune reasoning models; they are translated to each provider's own
+	// parameters. ThinkingBudget takes precedence where both are supported.
+	ReasoningEffort string `json:"-"`
+	ThinkingBudget  int    `json:"-"`
+
+	// Gemini carries Gemini-only parameters; other providers ignore it.
+	Gemini *GeminiOptions `json:"-"`
+	// Groq carries Groq-only parameters; other providers ignore it.
+	Groq *GroqOptions `json:"-"`
+
+	// Extra holds provider-specific fields merged into the top-level JSON body,
+	// overriding typed fields of the same name. Unknown fields of a decoded
+	// request are collected here.
+	Extra map[string]any `json:"-"`
+
+	// Prompt and Suffix are used only by text-completion providers.
+	// When Prompt is empty, Messages are flattened into a prompt instead.
+	Prompt string `json:"-"`
+	Suffix string `json:"-"`
 }
 
 // ChatCompletionMessage represents a message in the conversation.
 type ChatCompletionMessage struct {
-	Role       string     `json:"role"`
+	Role       Role       `json:"role"`
 	Content    string     `json:"content,omitempty"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
+
+	// Parts, when set, is sent as the content array instead of Content.
+	// CacheControl marks a plain Content message as a prompt-caching breakpoint.
+	Parts        []ContentPart `json:"-"`
+	CacheControl *CacheControl `json:"-"`
+
+	// Reasoning is the reasoning text some providers return in a separate
+	// field (reasoning_content or reasoning). It is not sent back.
+	Reasoning string `json:"-"`
+	// Refusal is the explanation OpenAI returns instead of content when the
+	// model declines a request. It is not sent back.
+	Refusal string `json:"-"`
+	// Provenance records which target produced a reply added by
+	// Command.Send or Command.Retry. It is not sent.
+	Provenance *Provenance `json:"-"`
+}
+
+// ContentPart is one block of a multi-part message content.
+type ContentPart struct {
+	Type         string        `json:"type"`
+	Text         string        `json:"text,omitempty"`
+	ImageURL     *ImageURL     `json:"image_url,omitempty"`
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+
+	// FileURI and MIMEType reference an uploaded file; see GeminiFilePart.
+	FileURI  string `json:"-"`
+	MIMEType string `json:"-"`
+}
+
+// ImageURL references an image by URL or data URI.
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// CacheControl is an Anthropic-style prompt caching hint.
+type CacheControl struct {
+	Type string `json:"type"`
+	TTL  string `json:"ttl,omitempty"`
 }
 
 // ChatCompletionResponse represents an OpenAI-compatible chat completion response.
 type ChatCompletionResponse struct {
 	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   *Usage                 `json:"usage,omitempty"`
+
+	// Diagnostics are the provider's details of how the request was served,
+	// when it reports them.
+	Diagnostics *Diagnostics `json:"-"`
+	// Timing is the phase timing of the HTTP request, when there was one.
+	Timing *Timing `json:"-"`
+	// Cached is set when the response was served from the Command's cache.
+	Cached bool `json:"-"`
+}
+
+// Usage reports token consumption as returned by the provider.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+
+	// Anthropic-style cache accounting, reported by some gateways.
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+
+	// Cost is the USD cost reported by the provider (OpenRouter), or 0.
+	Cost float64 `json:"cost,omitempty"`
+}
+
+// PromptTokensDetails breaks down prompt tokens by cache status.
+type PromptTokensDetails struct {
+	CachedTokens     int `json:"cached_tokens,omitempty"`
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
 }
 
 // ChatCompletionChoice represents a single choice in the response.
 type ChatCompletionChoice struct {
 	Message      ChatCompletionMessage `json:"message"`
 	FinishReason string                `json:"finish_reason,omitempty"`
+	Logprobs     *Logprobs             `json:"logprobs,omitempty"`
+
+	// Raw holds fields of the choice that have no typed counterpart.
+	Raw map[string]json.RawMessage `json:"-"`
+}
+
+// Logprobs holds per-token log probabilities for a choice.
+type Logprobs struct {
+	Content []TokenLogprob `json:"content"`
+}
+
+// TokenLogprob is the log probability of a sampled token and its top alternatives.
+type TokenLogprob struct {
+	Token       string       `json:"token"`
+	Logprob     float64      `json:"logprob"`
+	Bytes       []int        `json:"bytes,omitempty"`
+	TopLogprobs []TopLogprob `json:"top_logprobs,omitempty"`
+}
+
+// TopLogprob is one of the most likely tokens at a position.
+type TopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	Bytes   []int   `json:"bytes,omitempty"`
 }
 
 // ToolCall represents a tool call made by the model.
 type ToolCall struct {
 	ID       string           `json:"id"`
-	Type     string           `json:"type"`
+	Type     ToolType         `json:"type"`
 	Function ToolCallFunction `json:"function"`
 }
 
@@ -46,7 +172,7 @@ type ToolCallFunction struct {
 
 // Tool represents a tool definition for the model.
 type Tool struct {
-	Type     string   `json:"type"`
+	Type     ToolType `json:"type"`
 	Function ToolFunc `json:"function"`
 }
 
@@ -75,12 +201,42 @@ type ToolParameterProperty struct {
 type Provider struct {
 	Endpoint string
 	APIKey   string
+
+	// APIKeys is a pool of keys used instead of APIKey when non-empty.
+	// KeyRotation selects how requests are spread across the pool.
+	APIKeys     []string
+	KeyRotation KeyRotation
+
+	// TextCompletion marks Endpoint as a legacy /completions endpoint
+	// (prompt string in, text out) instead of a chat completions endpoint.
+	TextCompletion bool
+
+	// GeminiNative marks Endpoint as the root of the native Gemini API
+	// (GeminiNativeEndpoint) instead of an OpenAI-compatible endpoint.
+	GeminiNative bool
+
+	// Headers are extra HTTP headers sent with every request. They override
+	// the defaults, so gateways with their own auth scheme can leave APIKey
+	// empty and set e.g. "api-key" here instead.
+	Headers map[string]string
+
+	// Proxy is the URL of an HTTP or SOCKS5 proxy for this provider,
+	// overriding the Command proxy. Use NoProxy to connect directly.
+	Proxy string
+
+	// TLS overrides the Command TLS configuration for this provider.
+	TLS *TLSConfig
 }
 
 // Target is a specific provider + model combination.
 type Target struct {
 	Provider Provider
 	Model    string
+
+	// Extra holds request fields merged into the body for this target only,
+	// after the request's own Extra. Use it for per-target parameters such as
+	// {"temperature": 0}.
+	Extra map[string]any
 }
 
 // Result wraps a response with target info and timing.